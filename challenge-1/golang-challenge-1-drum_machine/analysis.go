@@ -0,0 +1,286 @@
+package drum
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Hint names a rhythm found in a pattern which is typical of some genres.
+type Hint string
+
+const (
+
+	// FourOnTheFloor is a kick on every beat, as in house and disco.
+	FourOnTheFloor Hint = "four-on-the-floor"
+
+	// Backbeat is a snare or clap on the second and fourth beats and on
+	// none of the others, as in rock, funk and pop.
+	Backbeat Hint = "backbeat"
+)
+
+// Analysis describes the rhythm of a pattern, see Analyze.
+type Analysis struct {
+	Steps  int             `json:"steps"`
+	Tracks []TrackAnalysis `json:"tracks"`
+
+	// Hits is the number of steps played by every track.
+	Hits int `json:"hits"`
+
+	// Density is the share of the steps of every track which play.
+	Density float64 `json:"density"`
+
+	// Syncopation is the syncopation of the steps on which any track
+	// plays, see TrackAnalysis.
+	Syncopation float64 `json:"syncopation"`
+
+	// Onsets holds the number of tracks playing on each step.
+	Onsets []int `json:"onsets"`
+
+	// CoOccurrence holds the number of steps on which two tracks both
+	// play, by the index of the tracks. The diagonal holds the hits of
+	// each track.
+	CoOccurrence [][]int `json:"coOccurrence"`
+
+	// Hints lists the rhythms typical of some genres found in the
+	// pattern.
+	Hints []Hint `json:"hints"`
+}
+
+// TrackAnalysis describes the rhythm of a track.
+type TrackAnalysis struct {
+	ID      uint8   `json:"id"`
+	Name    string  `json:"name"`
+	Hits    int     `json:"hits"`
+	Density float64 `json:"density"`
+
+	// Syncopation is the mean syncopation of the hits, from the metrical
+	// weights of Longuet-Higgins and Lee: a hit followed by a rest on a
+	// stronger step of the bar, before the next hit, is syncopated by the
+	// difference of their weights. Steps are weighted by how far the bar
+	// is divided before they start a division, so the first step of the
+	// bar weighs most and, in 16 steps of 16th notes, steps 8, 4 and 12,
+	// then the 8th and the 16th notes follow. The pattern loops, so the
+	// rests after the last hit run up to the first one.
+	Syncopation float64 `json:"syncopation"`
+
+	// Onsets holds the velocity of each step from 0 to 1, an accent
+	// playing at 1.
+	Onsets []float64 `json:"onsets"`
+}
+
+// Analyze describes the rhythm of the pattern. The steps are counted from
+// its tracks, see analyzedSteps.
+func Analyze(p Pattern) Analysis {
+	steps := analyzedSteps(p)
+	weights := metricalWeights(steps, p.Header.stepsPerBeat())
+	a := Analysis{
+		Steps:        steps,
+		Tracks:       []TrackAnalysis{},
+		Onsets:       make([]int, steps),
+		CoOccurrence: make([][]int, len(p.Tracks)),
+		Hints:        []Hint{},
+	}
+
+	for i, t := range p.Tracks {
+		ta := TrackAnalysis{ID: t.ID, Name: t.Name, Onsets: make([]float64, steps)}
+		on := make([]bool, steps)
+		for s := 0; s < steps && s < len(t.Steps); s++ {
+			v := t.Velocity(s)
+			if v == 0 {
+				continue
+			}
+			on[s] = true
+			ta.Hits++
+			ta.Onsets[s] = float64(v) / AccentVelocity
+			a.Onsets[s]++
+		}
+		ta.Density = float64(ta.Hits) / float64(steps)
+		ta.Syncopation = syncopation(on, weights)
+		a.Hits += ta.Hits
+		a.Tracks = append(a.Tracks, ta)
+
+		a.CoOccurrence[i] = make([]int, len(p.Tracks))
+		for j, u := range p.Tracks {
+			for s := 0; s < steps && s < len(t.Steps) && s < len(u.Steps); s++ {
+				if t.Velocity(s) > 0 && u.Velocity(s) > 0 {
+					a.CoOccurrence[i][j]++
+				}
+			}
+		}
+	}
+
+	if len(p.Tracks) > 0 {
+		a.Density = float64(a.Hits) / float64(len(p.Tracks)*steps)
+	}
+	on := make([]bool, steps)
+	for s, n := range a.Onsets {
+		on[s] = n > 0
+	}
+	a.Syncopation = syncopation(on, weights)
+	a.Hints = hints(p)
+
+	return a
+}
+
+// String formats the analysis as a report, the tracks following the
+// figures of the whole pattern.
+func (a Analysis) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Steps: %d\n", a.Steps)
+	fmt.Fprintf(&sb, "Hits: %d\n", a.Hits)
+	fmt.Fprintf(&sb, "Density: %.1f%%\n", a.Density*100)
+	fmt.Fprintf(&sb, "Syncopation: %.2f\n", a.Syncopation)
+	if len(a.Hints) > 0 {
+		hints := make([]string, len(a.Hints))
+		for i, h := range a.Hints {
+			hints[i] = string(h)
+		}
+		fmt.Fprintf(&sb, "Hints: %s\n", strings.Join(hints, ", "))
+	}
+
+	for i, t := range a.Tracks {
+		fmt.Fprintf(&sb, "(%d) %s\thits %d, density %.1f%%, syncopation %.2f", t.ID, t.Name, t.Hits, t.Density*100, t.Syncopation)
+		var with []string
+		for j, n := range a.CoOccurrence[i] {
+			if j != i && n > 0 {
+				with = append(with, fmt.Sprintf("%s %d", a.Tracks[j].Name, n))
+			}
+		}
+		if len(with) > 0 {
+			fmt.Fprintf(&sb, ", with %s", strings.Join(with, ", "))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// metricalWeights returns the weight of each step of the bar, 0 for the
+// first step and one less for each division of the bar it takes to start
+// on the step. The bar is divided into its beats, then the beats into
+// their steps, by the smallest prime factor first so a bar of four beats
+// is halved twice.
+func metricalWeights(steps, stepsPerBeat int) []int {
+	units := []int{steps}
+	unit := steps
+	divide := func(n int) {
+		for n > 1 {
+			f := 2
+			for n%f != 0 {
+				f++
+			}
+			n /= f
+			unit /= f
+			units = append(units, unit)
+		}
+	}
+	if stepsPerBeat > 0 && steps%stepsPerBeat == 0 {
+		divide(steps / stepsPerBeat)
+		divide(stepsPerBeat)
+	} else {
+		divide(steps)
+	}
+
+	weights := make([]int, steps)
+	for s := range weights {
+		for level, u := range units {
+			if s%u == 0 {
+				weights[s] = -level
+				break
+			}
+		}
+	}
+	return weights
+}
+
+// analyzedSteps returns the number of steps of the first track, which a
+// pattern built without setting its grid may have more of than its header
+// says, or the steps of the header when there are no tracks.
+func analyzedSteps(p Pattern) int {
+	if len(p.Tracks) > 0 && len(p.Tracks[0].Steps) > 0 {
+		return len(p.Tracks[0].Steps)
+	}
+	return p.steps()
+}
+
+// syncopation returns the mean syncopation of the steps which are on, see
+// TrackAnalysis.
+func syncopation(on []bool, weights []int) float64 {
+	var hits []int
+	for s, ok := range on {
+		if ok {
+			hits = append(hits, s)
+		}
+	}
+	if len(hits) == 0 {
+		return 0
+	}
+
+	total := 0
+	for i, s := range hits {
+		next := hits[0] + len(on)
+		if i+1 < len(hits) {
+			next = hits[i+1]
+		}
+		strongest := weights[s]
+		for r := s + 1; r < next; r++ {
+			if w := weights[r%len(on)]; w > strongest {
+				strongest = w
+			}
+		}
+		total += strongest - weights[s]
+	}
+	return float64(total) / float64(len(hits))
+}
+
+// hints returns the rhythms typical of some genres found in the pattern.
+func hints(p Pattern) []Hint {
+	found := []Hint{}
+	steps, stepsPerBeat := analyzedSteps(p), p.Header.stepsPerBeat()
+	if steps%stepsPerBeat != 0 || steps/stepsPerBeat < 2 {
+		return found
+	}
+	beats := steps / stepsPerBeat
+
+	// onBeats reports whether the track plays on the beats for which
+	// want returns true, and on none of the others.
+	onBeats := func(t Track, want func(beat int) bool) bool {
+		for b := 0; b < beats; b++ {
+			if (t.Velocity(b*stepsPerBeat) > 0) != want(b) {
+				return false
+			}
+		}
+		return true
+	}
+
+	kick, snare := false, false
+	for _, t := range p.Tracks {
+		switch instrument(t) {
+		case "kick":
+			kick = kick || onBeats(t, func(int) bool { return true })
+		case "snare":
+			snare = snare || beats%2 == 0 && onBeats(t, func(b int) bool { return b%2 == 1 })
+		}
+	}
+	if kick {
+		found = append(found, FourOnTheFloor)
+	}
+	if snare {
+		found = append(found, Backbeat)
+	}
+	return found
+}
+
+// instrument returns "kick" or "snare" for the tracks which play them,
+// from their General MIDI note or their name, claps and rimshots counting
+// as snares.
+func instrument(t Track) string {
+	name := strings.ToLower(t.Name)
+	note, ok := GMNotes[name]
+	switch {
+	case ok && (note == 35 || note == 36), strings.Contains(name, "kick"):
+		return "kick"
+	case ok && note >= 37 && note <= 39, strings.Contains(name, "snare"), strings.Contains(name, "clap"):
+		return "snare"
+	}
+	return ""
+}
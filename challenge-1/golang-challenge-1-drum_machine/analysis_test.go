@@ -0,0 +1,125 @@
+package drum
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	p, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	a := Analyze(p)
+
+	if a.Steps != 16 || a.Hits != 18 || a.Density != 18.0/96 {
+		t.Fatalf("unexpected totals: %d steps, %d hits and a density of %v", a.Steps, a.Hits, a.Density)
+	}
+	if !reflect.DeepEqual(a.Hints, []Hint{FourOnTheFloor, Backbeat}) {
+		t.Fatalf("expected four on the floor and a backbeat, got %v", a.Hints)
+	}
+
+	hits := []int{4, 2, 2, 5, 4, 1}
+	for i, exp := range hits {
+		if a.Tracks[i].Hits != exp || a.CoOccurrence[i][i] != exp {
+			t.Fatalf("track %d: expected %d hits, got %d", i, exp, a.Tracks[i].Hits)
+		}
+	}
+	if a.Tracks[0].Syncopation != 0 {
+		t.Fatalf("expected the kick on the beats not to be syncopated, got %v", a.Tracks[0].Syncopation)
+	}
+	if a.CoOccurrence[0][1] != 2 || a.CoOccurrence[1][0] != 2 || a.CoOccurrence[0][5] != 0 {
+		t.Fatalf("unexpected co-occurrence of the kick: %v", a.CoOccurrence[0])
+	}
+	onsets := []int{2, 0, 1, 0, 4, 0, 2, 0, 2, 0, 2, 0, 3, 0, 1, 1}
+	if !reflect.DeepEqual(a.Onsets, onsets) {
+		t.Fatalf("expected the onsets %v, got %v", onsets, a.Onsets)
+	}
+	if v := a.Tracks[0].Onsets[4]; v != float64(NormalVelocity)/AccentVelocity {
+		t.Fatalf("expected a plain step at %v, got %v", float64(NormalVelocity)/AccentVelocity, v)
+	}
+
+	report := a.String()
+	for _, line := range []string{
+		"Hints: four-on-the-floor, backbeat\n",
+		"(0) kick\thits 4, density 25.0%, syncopation 0.00, with snare 2, clap 1, hh-open 1, hh-close 3\n",
+	} {
+		if !strings.Contains(report, line) {
+			t.Fatalf("expected %q in the report:\n%s", line, report)
+		}
+	}
+
+	b, err := json.Marshal(a)
+	if err != nil {
+		t.Fatalf("something went wrong marshaling - %v", err)
+	}
+	if !strings.Contains(string(b), `"hints":["four-on-the-floor","backbeat"]`) {
+		t.Fatalf("unexpected JSON: %s", b)
+	}
+}
+
+func TestSyncopation(t *testing.T) {
+	tData := []struct {
+		steps string
+		exp   float64
+	}{
+		{"x---|----|----|----", 0},
+		{"x---|x---|x---|x---", 0},
+		{"-x--|----|----|----", 4},
+		{"x---|--x-|----|----", 1},
+		{"x--x|--x-|----|----", 4.0 / 3},
+		{"----|----|----|----", 0},
+	}
+
+	for _, exp := range tData {
+		p, err := ParsePattern("Saved with HW Version: 0.909\nTempo: 120\n(0) rim\t|" + exp.steps + "|\n")
+		if err != nil {
+			t.Fatalf("something went wrong parsing %s - %v", exp.steps, err)
+		}
+		if got := Analyze(p).Syncopation; got != exp.exp {
+			t.Fatalf("%s: expected a syncopation of %v, got %v", exp.steps, exp.exp, got)
+		}
+	}
+}
+
+func TestMetricalWeights(t *testing.T) {
+	tData := []struct {
+		steps, stepsPerBeat int
+		exp                 []int
+	}{
+		{16, 4, []int{0, -4, -3, -4, -2, -4, -3, -4, -1, -4, -3, -4, -2, -4, -3, -4}},
+		{12, 3, []int{0, -3, -3, -2, -3, -3, -1, -3, -3, -2, -3, -3}},
+		{6, 4, []int{0, -2, -2, -1, -2, -2}},
+	}
+
+	for _, exp := range tData {
+		if got := metricalWeights(exp.steps, exp.stepsPerBeat); !reflect.DeepEqual(got, exp.exp) {
+			t.Fatalf("%d steps at %d per beat: expected %v, got %v", exp.steps, exp.stepsPerBeat, exp.exp, got)
+		}
+	}
+}
+
+func TestHints(t *testing.T) {
+	tData := []struct {
+		text string
+		exp  []Hint
+	}{
+		{"(0) Kick\t|x---|x---|x---|x---|\n(1) rimshot\t|----|x---|----|x---|\n", []Hint{FourOnTheFloor, Backbeat}},
+		{"(0) kick\t|x---|----|x---|----|\n(1) snare\t|----|x---|----|x---|\n", []Hint{Backbeat}},
+		{"(0) kick\t|x---|x---|x---|x---|\n(1) snare\t|x---|x---|x---|x---|\n", []Hint{FourOnTheFloor}},
+		{"(0) bass drum\t|x---|x---|x---|x---|\n", []Hint{}},
+	}
+
+	for i, exp := range tData {
+		p, err := ParsePattern("Saved with HW Version: 0.909\nTempo: 120\n" + exp.text)
+		if err != nil {
+			t.Fatalf("pattern %d: something went wrong parsing - %v", i, err)
+		}
+		if got := Analyze(p).Hints; !reflect.DeepEqual(got, exp.exp) {
+			t.Fatalf("pattern %d: expected %v, got %v", i, exp.exp, got)
+		}
+	}
+}
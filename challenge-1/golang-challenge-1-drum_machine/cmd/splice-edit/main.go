@@ -0,0 +1,91 @@
+// Command splice-edit edits a .splice drum pattern file in the terminal.
+//
+// Usage:
+//
+//	splice-edit [-check] FILE
+//
+// The tracks are shown as in "splice show" with a cursor over the steps.
+// Arrows or hjkl move the cursor, space or x toggles the step, X toggles
+// an accent, r renames the track, t sets the tempo and + and - change it by
+// one, p plays the pattern with a moving cursor, u and ctrl-r undo and redo,
+// s saves and q quits. With -check the pattern is only saved when it follows
+// the rules of its hardware version.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	drum "github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine"
+	"github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine/tui"
+)
+
+func main() {
+	check := flag.Bool("check", false, "check the rules of the hardware version before saving")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: splice-edit [-check] FILE")
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0), *check); err != nil {
+		fmt.Fprintf(os.Stderr, "splice-edit: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run opens the pattern and edits it with the terminal in raw mode.
+func run(path string, check bool) error {
+	p, err := drum.DecodeFile(path)
+	if err != nil {
+		return err
+	}
+
+	restore, err := rawMode()
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	// Hide the terminal cursor while editing.
+	fmt.Print("\x1b[?25l")
+	defer fmt.Print("\x1b[?25h")
+
+	e := tui.NewEditor(path, p)
+	if check {
+		e.Registry = drum.DefaultRegistry
+	}
+	return e.Run(readWriter{os.Stdin, os.Stdout})
+}
+
+// readWriter reads keys from one file and draws on another.
+type readWriter struct {
+	r *os.File
+	w *os.File
+}
+
+func (rw readWriter) Read(p []byte) (int, error)  { return rw.r.Read(p) }
+func (rw readWriter) Write(p []byte) (int, error) { return rw.w.Write(p) }
+
+// rawMode puts the terminal in raw mode with stty, so keys are read as
+// they are pressed, and returns a function restoring its settings.
+func rawMode() (func(), error) {
+	state, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("reading the terminal settings failed: %v", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, fmt.Errorf("setting raw mode failed: %v", err)
+	}
+	return func() { stty(strings.TrimSpace(state)) }, nil
+}
+
+// stty runs stty on the terminal of the standard input.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
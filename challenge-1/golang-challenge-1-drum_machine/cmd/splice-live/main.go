@@ -0,0 +1,87 @@
+// Command splice-live plays a drum pattern to external gear, as OSC
+// messages over UDP, raw MIDI bytes written to a device file, or both. See
+// the live package for the messages sent.
+//
+// Usage:
+//
+//	splice-live [-osc HOST:PORT] [-midi DEVICE] [-loops N] [-swing PERCENT] FILE
+//
+// For example, to play a pattern four times on the first MIDI port:
+//
+//	splice-live -midi /dev/snd/midiC1D0 -loops 4 pattern.splice
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	drum "github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine"
+	"github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine/live"
+)
+
+func main() {
+	oscAddr := flag.String("osc", "", "send OSC messages over UDP to `HOST:PORT`")
+	device := flag.String("midi", "", "write MIDI bytes to the `DEVICE` file")
+	loops := flag.Int("loops", 0, "number of times to play the pattern, 0 plays until interrupted")
+	swing := flag.Float64("swing", 0, "share of each pair of steps taken by the first one, from 50 to 75 `PERCENT`")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: splice-live [-osc HOST:PORT] [-midi DEVICE] [-loops N] [-swing PERCENT] FILE")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || (*oscAddr == "" && *device == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := play(flag.Arg(0), *oscAddr, *device, *loops, *swing); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// play plays the pattern file to the outputs until the loops are played or
+// the command is interrupted.
+func play(path, oscAddr, device string, loops int, swing float64) error {
+	p, err := drum.LoadPattern(path)
+	if err != nil {
+		return err
+	}
+
+	var outputs []live.Output
+	if oscAddr != "" {
+		out, err := live.DialOSC(oscAddr)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		outputs = append(outputs, out)
+	}
+	if device != "" {
+		fd, err := os.OpenFile(device, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+		outputs = append(outputs, live.NewMIDIOutput(fd))
+	}
+
+	pl := live.NewPlayer(p, outputs...)
+	pl.Loops = loops
+	pl.Swing = float32(swing)
+	if err := pl.Start(); err != nil {
+		return err
+	}
+
+	// Stop on an interrupt so the gear gets the stop message.
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		pl.Stop()
+	}()
+
+	return pl.Wait()
+}
@@ -0,0 +1,36 @@
+// Command splice-server serves the decoding, encoding and rendering of
+// .splice drum patterns over HTTP. See the server package for the
+// endpoints.
+//
+// Usage:
+//
+//	splice-server [-addr :8080] [-max-upload BYTES] [-check]
+//
+// With -check the uploaded patterns must follow the rules of their
+// hardware version.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	drum "github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine"
+	"github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine/server"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	maxUpload := flag.Int64("max-upload", server.DefaultMaxUpload, "largest request body in bytes")
+	check := flag.Bool("check", false, "check the rules of the hardware version of uploads")
+	flag.Parse()
+
+	s := server.New()
+	s.MaxUpload = *maxUpload
+	if *check {
+		s.Registry = drum.DefaultRegistry
+	}
+
+	log.Printf("listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, s))
+}
@@ -0,0 +1,504 @@
+// Command splice inspects and converts .splice drum pattern files.
+//
+// Usage:
+//
+//	splice show FILE...
+//	splice info FILE...
+//	splice json FILE...
+//	splice analyze [--json] FILE...
+//	splice convert --to midi|wav|text|splice|splice2 [-o OUT] [--kit DIR] FILE...
+//	splice set-tempo [--check] TEMPO FILE...
+//	splice validate FILE...
+//	splice diff OLD NEW
+//	splice merge [-o OUT] BASE OURS THEIRS
+//	splice transcribe [--tempo TEMPO] [--threshold T] [-o OUT] FILE.wav...
+//
+// The diff and merge commands can be used as git drivers for .splice files
+// with these lines in .gitattributes:
+//
+//	*.splice diff=splice merge=splice
+//
+// and these in the git configuration:
+//
+//	[diff "splice"]
+//		command = splice diff
+//	[merge "splice"]
+//		name = splice pattern merge
+//		driver = splice merge %O %A %B
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	drum "github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine"
+	"github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine/transcribe"
+)
+
+// Exit codes.
+const (
+	exitOK    = 0
+	exitFail  = 1
+	exitUsage = 2
+)
+
+// errUsage is returned by commands given invalid arguments.
+var errUsage = errors.New("invalid usage")
+
+// command runs a subcommand with its arguments.
+type command struct {
+	usage string
+	run   func(args []string, stdout, stderr io.Writer) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"show":       {"show FILE...", show},
+		"info":       {"info FILE...", info},
+		"json":       {"json FILE...", toJSON},
+		"analyze":    {"analyze [--json] FILE...", analyze},
+		"convert":    {"convert --to midi|wav|text|splice|splice2 [-o OUT] [--kit DIR] FILE...", convert},
+		"set-tempo":  {"set-tempo [--check] TEMPO FILE...", setTempo},
+		"validate":   {"validate FILE...", validate},
+		"diff":       {"diff OLD NEW", diff},
+		"merge":      {"merge [-o OUT] BASE OURS THEIRS", merge},
+		"transcribe": {"transcribe [--tempo TEMPO] [--threshold T] [-o OUT] FILE.wav...", transcribeWAV},
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command named by the first argument and returns the exit
+// code of the program.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "splice: unknown command %q\n", args[0])
+		usage(stderr)
+		return exitUsage
+	}
+
+	if err := cmd.run(args[1:], stdout, stderr); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(stderr, "usage: splice %s\n", cmd.usage)
+			return exitUsage
+		}
+		fmt.Fprintf(stderr, "splice %s: %v\n", args[0], err)
+		return exitFail
+	}
+
+	return exitOK
+}
+
+// usage prints the list of commands.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage:")
+	for _, name := range []string{"show", "info", "json", "analyze", "convert", "set-tempo", "validate", "diff", "merge", "transcribe"} {
+		fmt.Fprintf(w, "\tsplice %s\n", commands[name].usage)
+	}
+}
+
+// forEach decodes each file and calls fn with the pattern. Every file is
+// tried even if some fail, their errors are written to stderr and the
+// returned error reports how many did.
+func forEach(files []string, stderr io.Writer, fn func(path string, p drum.Pattern) error) error {
+	if len(files) == 0 {
+		return errUsage
+	}
+
+	failed := 0
+	for _, path := range files {
+		p, err := drum.DecodeFile(path)
+		if err == nil {
+			err = fn(path, p)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", path, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed", failed, len(files))
+	}
+	return nil
+}
+
+// header prints the name of the file when more than one is given.
+func header(w io.Writer, files []string, path string) {
+	if len(files) > 1 {
+		fmt.Fprintf(w, "==> %s <==\n", path)
+	}
+}
+
+// show prints each pattern in the grid format.
+func show(args []string, stdout, stderr io.Writer) error {
+	return forEach(args, stderr, func(path string, p drum.Pattern) error {
+		header(stdout, args, path)
+		fmt.Fprint(stdout, p)
+		return nil
+	})
+}
+
+// info prints a summary of each pattern.
+func info(args []string, stdout, stderr io.Writer) error {
+	return forEach(args, stderr, func(path string, p drum.Pattern) error {
+		length, err := payloadLength(path)
+		if err != nil {
+			return err
+		}
+
+		header(stdout, args, path)
+		fmt.Fprint(stdout, p.Header)
+		fmt.Fprintf(stdout, "Tracks: %d\n", len(p.Tracks))
+		fmt.Fprintf(stdout, "Payload: %d bytes\n", length)
+		if len(p.Trailing) > 0 {
+			fmt.Fprintf(stdout, "Trailing: %d bytes\n", len(p.Trailing))
+		}
+		return nil
+	})
+}
+
+// payloadLength returns the payload length declared in the format section
+// of the file, which follows its 6 byte magic. It doesn't count the
+// extension chunks after the payload.
+func payloadLength(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var format struct {
+		Magic  [6]byte
+		Length uint64
+	}
+	if err := binary.Read(f, binary.BigEndian, &format); err != nil {
+		return 0, err
+	}
+	return format.Length, nil
+}
+
+// toJSON prints each pattern as JSON.
+func toJSON(args []string, stdout, stderr io.Writer) error {
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	return forEach(args, stderr, func(path string, p drum.Pattern) error {
+		return enc.Encode(p)
+	})
+}
+
+// analyze prints a report of the rhythm of each pattern, or prints the
+// reports as JSON with --json.
+func analyze(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	asJSON := fs.Bool("json", false, "print the reports as JSON")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	files := fs.Args()
+
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	return forEach(files, stderr, func(path string, p drum.Pattern) error {
+		a := drum.Analyze(p)
+		if *asJSON {
+			return enc.Encode(a)
+		}
+		header(stdout, files, path)
+		fmt.Fprint(stdout, a)
+		return nil
+	})
+}
+
+// convert writes each pattern, or pattern in text or MIDI form, in another
+// format next to the original or to the file given with -o.
+func convert(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	to := fs.String("to", "", "output format: midi, wav, text, splice or splice2")
+	out := fs.String("o", "", "output file, only with a single input file")
+	kitDir := fs.String("kit", "", "directory of .wav samples for wav output")
+	loops := fs.Int("loops", 1, "number of times the pattern is played")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	files := fs.Args()
+	if len(files) == 0 || (*out != "" && len(files) > 1) {
+		return errUsage
+	}
+
+	exts := map[string]string{"midi": ".mid", "wav": ".wav", "text": ".txt", "splice": ".splice", "splice2": ".splice"}
+	ext, ok := exts[*to]
+	if !ok {
+		return errUsage
+	}
+
+	var kit drum.Kit
+	if *to == "wav" {
+		if *kitDir == "" {
+			return fmt.Errorf("--kit is needed to render wav files")
+		}
+		var err error
+		if kit, err = drum.LoadKit(*kitDir); err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	for _, path := range files {
+		p, err := drum.LoadPattern(path)
+		if err == nil {
+			dst := *out
+			if dst == "" {
+				dst = strings.TrimSuffix(path, filepath.Ext(path)) + ext
+			}
+			if dst == path {
+				err = fmt.Errorf("refusing to overwrite the input file")
+			} else {
+				err = write(dst, *to, p, kit, *loops)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", path, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed", failed, len(files))
+	}
+	return nil
+}
+
+// write writes the pattern to path in the given format.
+func write(path, format string, p drum.Pattern, kit drum.Kit, loops int) error {
+	fd, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "midi":
+		err = drum.EncodeMIDI(fd, p, drum.MIDIOptions{Format: 1, Loops: loops})
+	case "wav":
+		err = drum.RenderWAV(fd, p, kit, drum.RenderOptions{Loops: loops})
+	case "text":
+		_, err = io.WriteString(fd, p.String())
+	case "splice":
+		err = drum.Encode(fd, p)
+	case "splice2":
+		err = drum.EncodeFormat(fd, p, drum.FormatV2)
+	}
+	if err != nil {
+		fd.Close()
+		return err
+	}
+
+	return fd.Close()
+}
+
+// setTempo rewrites each file with a new tempo. With --check the files
+// are only written when the tempo follows the rules of their hardware
+// version.
+func setTempo(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("set-tempo", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	check := fs.Bool("check", false, "check the rules of the hardware version")
+	if err := fs.Parse(args); err != nil || fs.NArg() < 2 {
+		return errUsage
+	}
+	args = fs.Args()
+	tempo, err := strconv.ParseFloat(args[0], 32)
+	if err != nil || !(tempo > 0) {
+		return fmt.Errorf("invalid tempo %q", args[0])
+	}
+
+	return forEach(args[1:], stderr, func(path string, p drum.Pattern) error {
+		p.Header.Tempo = float32(tempo)
+		if *check {
+			if err := drum.DefaultRegistry.Validate(p); err != nil {
+				return err
+			}
+		}
+		return drum.EncodeFile(path, p)
+	})
+}
+
+// validate decodes each file and reports whether it follows the rules of
+// its hardware version.
+func validate(args []string, stdout, stderr io.Writer) error {
+	return forEach(args, stderr, func(path string, p drum.Pattern) error {
+		if err := drum.DefaultRegistry.Validate(p); err != nil {
+			return err
+		}
+
+		msg := "ok"
+		if len(p.Trailing) > 0 {
+			msg += fmt.Sprintf(", %d trailing bytes ignored", len(p.Trailing))
+		}
+		fmt.Fprintf(stdout, "%s: %s\n", path, msg)
+		return nil
+	})
+}
+
+// diff prints the changes between two patterns. It also accepts the seven
+// arguments git passes to an external diff command, the path followed by
+// the file, hash and mode of the old and new versions.
+func diff(args []string, stdout, stderr io.Writer) error {
+	var name, oldPath, newPath string
+	switch len(args) {
+	case 2:
+		oldPath, newPath = args[0], args[1]
+	case 7:
+		name, oldPath, newPath = args[0], args[1], args[4]
+	default:
+		return errUsage
+	}
+
+	a, err := loadOrEmpty(oldPath)
+	if err != nil {
+		return err
+	}
+	b, err := loadOrEmpty(newPath)
+	if err != nil {
+		return err
+	}
+
+	d := drum.Diff(a, b)
+	if d.Empty() {
+		return nil
+	}
+	if name != "" {
+		fmt.Fprintf(stdout, "diff --splice a/%s b/%s\n", name, name)
+		oldPath, newPath = "a/"+name, "b/"+name
+	}
+	fmt.Fprintf(stdout, "--- %s\n+++ %s\n", oldPath, newPath)
+	fmt.Fprint(stdout, d)
+	return nil
+}
+
+// loadOrEmpty is drum.LoadPattern, reading the null device, which git uses
+// for added and removed files, as a pattern without tracks.
+func loadOrEmpty(path string) (drum.Pattern, error) {
+	if path == os.DevNull {
+		return drum.Pattern{}, nil
+	}
+	return drum.LoadPattern(path)
+}
+
+// merge merges the changes made to BASE in OURS and THEIRS and writes the
+// result to OURS, or the file given with -o, in the format of its
+// extension. Conflicts are listed and make the command fail, the merged
+// pattern keeping our side of them.
+func merge(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	out := fs.String("o", "", "output file, OURS by default")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != 3 {
+		return errUsage
+	}
+
+	var patterns [3]drum.Pattern
+	for i, path := range fs.Args() {
+		p, err := drum.LoadPattern(path)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		patterns[i] = p
+	}
+
+	merged, conflicts, err := drum.Merge(patterns[0], patterns[1], patterns[2])
+	if err != nil {
+		return err
+	}
+
+	dst := *out
+	if dst == "" {
+		dst = fs.Arg(1)
+	}
+	formats := map[string]string{".mid": "midi", ".midi": "midi", ".txt": "text"}
+	format, ok := formats[strings.ToLower(filepath.Ext(dst))]
+	if !ok {
+		format = "splice"
+	}
+	if err := write(dst, format, merged, drum.Kit{}, 1); err != nil {
+		return err
+	}
+
+	for _, c := range conflicts {
+		fmt.Fprintf(stdout, "CONFLICT %s\n", c)
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("%d conflicts, our side was kept", len(conflicts))
+	}
+	return nil
+}
+
+// transcribeWAV transcribes each drum loop to a pattern, printed in the grid
+// format and written next to the loop or to the file given with -o.
+func transcribeWAV(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("transcribe", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	tempo := fs.Float64("tempo", 0, "tempo of the loops, estimated by default")
+	threshold := fs.Float64("threshold", transcribe.DefaultThreshold, "smallest rise of energy taken for a hit")
+	out := fs.String("o", "", "output file, only with a single input file")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	files := fs.Args()
+	if len(files) == 0 || (*out != "" && len(files) > 1) || *tempo < 0 || *threshold <= 0 {
+		return errUsage
+	}
+	opts := transcribe.Options{Tempo: float32(*tempo), Threshold: *threshold}
+
+	failed := 0
+	for _, path := range files {
+		p, err := transcribe.TranscribeFile(path, opts)
+		if err == nil {
+			dst := *out
+			if dst == "" {
+				dst = strings.TrimSuffix(path, filepath.Ext(path)) + ".splice"
+			}
+			if dst == path {
+				err = fmt.Errorf("refusing to overwrite the input file")
+			} else {
+				err = drum.EncodeFile(dst, p)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", path, err)
+			failed++
+			continue
+		}
+		header(stdout, files, path)
+		fmt.Fprint(stdout, p)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed", failed, len(files))
+	}
+	return nil
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	drum "github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine"
+	"github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine/wav"
+)
+
+const fixtures = "../../fixtures"
+
+func TestRun(t *testing.T) {
+	tData := []struct {
+		args   []string
+		code   int
+		output string
+	}{
+		{
+			[]string{"show", filepath.Join(fixtures, "pattern_2.splice")},
+			exitOK,
+			`Saved with HW Version: 0.808-alpha
+Tempo: 98.4
+(0) kick	|x---|----|x---|----|
+(1) snare	|----|x---|----|x---|
+(3) hh-open	|--x-|--x-|x-x-|--x-|
+(5) cowbell	|----|----|x---|----|
+`,
+		},
+		{
+			[]string{"info", filepath.Join(fixtures, "pattern_5.splice")},
+			exitOK,
+			`Saved with HW Version: 0.708-alpha
+Tempo: 999
+Tracks: 2
+Payload: 87 bytes
+Trailing: 31 bytes
+`,
+		},
+		{
+			[]string{"analyze", filepath.Join(fixtures, "pattern_2.splice")},
+			exitOK,
+			`Steps: 16
+Hits: 10
+Density: 15.6%
+Syncopation: 0.00
+Hints: backbeat
+(0) kick	hits 2, density 12.5%, syncopation 0.00, with hh-open 1, cowbell 1
+(1) snare	hits 2, density 12.5%, syncopation 1.50
+(3) hh-open	hits 5, density 31.2%, syncopation 1.00, with kick 1, cowbell 1
+(5) cowbell	hits 1, density 6.2%, syncopation 1.00, with kick 1, hh-open 1
+`,
+		},
+		{[]string{"analyze", "--json"}, exitUsage, ""},
+		{
+			[]string{"validate", filepath.Join(fixtures, "pattern_1.splice"), filepath.Join(fixtures, "pattern_4.splice")},
+			exitOK,
+			filepath.Join(fixtures, "pattern_1.splice") + ": ok\n" +
+				filepath.Join(fixtures, "pattern_4.splice") + ": ok\n",
+		},
+		{
+			[]string{"validate", filepath.Join(fixtures, "pattern_5.splice")},
+			exitOK,
+			filepath.Join(fixtures, "pattern_5.splice") + ": ok, 31 trailing bytes ignored\n",
+		},
+		{
+			[]string{"validate", filepath.Join(fixtures, "malformed", "tempo_999.splice")},
+			exitFail,
+			"",
+		},
+		{
+			[]string{"validate", filepath.Join(fixtures, "missing.splice")},
+			exitFail,
+			"",
+		},
+		{[]string{"show"}, exitUsage, ""},
+		{[]string{"dance"}, exitUsage, ""},
+		{[]string{}, exitUsage, ""},
+	}
+
+	for _, exp := range tData {
+		var stdout, stderr bytes.Buffer
+		code := run(exp.args, &stdout, &stderr)
+		if code != exp.code {
+			t.Fatalf("%v: expected exit code %d, got %d. Stderr:\n%s", exp.args, exp.code, code, stderr.String())
+		}
+		if exp.output != "" && stdout.String() != exp.output {
+			t.Fatalf("%v: unexpected output.\nGot:\n%s\nExpected:\n%s", exp.args, stdout.String(), exp.output)
+		}
+	}
+}
+
+func TestErrorsOnStderr(t *testing.T) {
+	missing := filepath.Join(fixtures, "missing.splice")
+	for _, args := range [][]string{
+		{"json", missing, filepath.Join(fixtures, "pattern_2.splice")},
+		{"analyze", "--json", missing, filepath.Join(fixtures, "pattern_2.splice")},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := run(args, &stdout, &stderr); code != exitFail {
+			t.Fatalf("%v: expected exit code %d, got %d", args, exitFail, code)
+		}
+		if !json.Valid(stdout.Bytes()) {
+			t.Fatalf("%v: expected JSON output, got:\n%s", args, stdout.String())
+		}
+		if !strings.Contains(stderr.String(), missing+": ") {
+			t.Fatalf("%v: expected the error on stderr, got:\n%s", args, stderr.String())
+		}
+	}
+}
+
+func TestInfoPayload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "splice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The timing extension follows the payload and isn't part of it.
+	p, err := drum.DecodeFile(filepath.Join(fixtures, "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	var straight bytes.Buffer
+	if err := drum.Encode(&straight, p); err != nil {
+		t.Fatalf("something went wrong encoding - %v", err)
+	}
+	p.Timing.Swing = 60
+	file := filepath.Join(dir, "swing.splice")
+	if err := drum.EncodeFile(file, p); err != nil {
+		t.Fatalf("something went wrong encoding - %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"info", file}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("expected exit code %d, got %d. Stderr:\n%s", exitOK, code, stderr.String())
+	}
+	if exp := fmt.Sprintf("Payload: %d bytes\n", straight.Len()-14); !strings.Contains(stdout.String(), exp) {
+		t.Fatalf("expected %q, got:\n%s", exp, stdout.String())
+	}
+}
+
+func TestConvertAndSetTempo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "splice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	original, err := drum.DecodeFile(filepath.Join(fixtures, "pattern_3.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "pattern_3.splice")
+	if err := drum.EncodeFile(src, original); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"set-tempo", "128.5", src}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("set-tempo failed with %d: %s%s", code, stdout.String(), stderr.String())
+	}
+
+	// The rules of the hardware version are only checked when asked for.
+	if code := run([]string{"set-tempo", "--check", "400", src}, &stdout, &stderr); code != exitFail {
+		t.Fatalf("expected set-tempo --check to fail with %d, got %d", exitFail, code)
+	}
+	if p, err := drum.DecodeFile(src); err != nil || p.Header.Tempo != 128.5 {
+		t.Fatalf("expected the file to be left alone, got %v and %v", p.Header, err)
+	}
+
+	// Go to text and back again.
+	if code := run([]string{"convert", "--to", "text", src}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("convert failed with %d: %s%s", code, stdout.String(), stderr.String())
+	}
+	text, err := ioutil.ReadFile(filepath.Join(dir, "pattern_3.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(text), "Tempo: 128.5\n") {
+		t.Fatalf("tempo wasn't changed:\n%s", text)
+	}
+
+	back := filepath.Join(dir, "back.splice")
+	args := []string{"convert", "--to", "splice", "-o", back, filepath.Join(dir, "pattern_3.txt")}
+	if code := run(args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("convert failed with %d: %s%s", code, stdout.String(), stderr.String())
+	}
+	p, err := drum.DecodeFile(back)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != string(text) {
+		t.Fatalf("pattern changed converting to text and back.\nGot:\n%s\nExpected:\n%s", p, text)
+	}
+
+	if code := run([]string{"convert", "--to", "midi", src}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("convert failed with %d: %s%s", code, stdout.String(), stderr.String())
+	}
+	if _, err := drum.DecodeMIDIFile(filepath.Join(dir, "pattern_3.mid")); err != nil {
+		t.Fatalf("converted MIDI file can't be read - %v", err)
+	}
+
+	if code := run([]string{"convert", "--to", "wav", src}, &stdout, &stderr); code != exitFail {
+		t.Fatalf("expected wav output without a kit to fail, got %d", code)
+	}
+	if code := run([]string{"convert", "--to", "flac", src}, &stdout, &stderr); code != exitUsage {
+		t.Fatalf("expected an unknown format to be a usage error, got %d", code)
+	}
+}
+
+func TestDiffAndMerge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "splice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	base, err := drum.DecodeFile(filepath.Join(fixtures, "pattern_2.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	save := func(name string, p drum.Pattern) string {
+		path := filepath.Join(dir, name)
+		if err := drum.EncodeFile(path, p); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	ours := base.Clone()
+	if err := ours.SetStep(0, 2, drum.StepOn); err != nil {
+		t.Fatal(err)
+	}
+	theirs := base.Clone()
+	if err := theirs.SetTempo(120); err != nil {
+		t.Fatal(err)
+	}
+	basePath, oursPath, theirsPath := save("base.splice", base), save("ours.splice", ours), save("theirs.splice", theirs)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"diff", basePath, oursPath}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("diff failed with %d: %s", code, stderr.String())
+	}
+	expected := "--- " + basePath + "\n+++ " + oursPath + `
+-(0) kick	|x---|----|x---|----|
++(0) kick	|x-x-|----|x---|----|
+`
+	if stdout.String() != expected {
+		t.Fatalf("unexpected diff.\nGot:\n%s\nExpected:\n%s", stdout.String(), expected)
+	}
+
+	// The arguments of a git external diff, for an added file.
+	stdout.Reset()
+	args := []string{"diff", "p.splice", os.DevNull, ".", ".", oursPath, "abc123", "100644"}
+	if code := run(args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("diff failed with %d: %s", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "diff --splice a/p.splice b/p.splice\n--- a/p.splice\n+++ b/p.splice\n") ||
+		!strings.Contains(stdout.String(), "+(5) cowbell\t|----|----|x---|----|\n") {
+		t.Fatalf("unexpected diff of an added file:\n%s", stdout.String())
+	}
+
+	stdout.Reset()
+	if code := run([]string{"merge", basePath, oursPath, theirsPath}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("merge failed with %d: %s%s", code, stdout.String(), stderr.String())
+	}
+	merged, err := drum.DecodeFile(oursPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.Header.Tempo != 120 || merged.Tracks[0].Velocity(2) == 0 {
+		t.Fatalf("merge lost changes:\n%s", merged)
+	}
+
+	// Conflicts make the merge fail and keep our side.
+	if err := theirs.SetStep(0, 2, drum.AccentVelocity); err != nil {
+		t.Fatal(err)
+	}
+	save("theirs.splice", theirs)
+	save("ours.splice", ours)
+	out := filepath.Join(dir, "merged.txt")
+	stdout.Reset()
+	if code := run([]string{"merge", "-o", out, basePath, oursPath, theirsPath}, &stdout, &stderr); code != exitFail {
+		t.Fatalf("expected a conflicting merge to fail, got %d", code)
+	}
+	if stdout.String() != "CONFLICT track 0 step 2: base -, ours x, theirs X\n" {
+		t.Fatalf("unexpected conflicts:\n%s", stdout.String())
+	}
+	text, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(text), "(0) kick\t|x-x-|----|x---|----|\n") {
+		t.Fatalf("merge didn't keep our side:\n%s", text)
+	}
+
+	if code := run([]string{"merge", basePath, oursPath}, &stdout, &stderr); code != exitUsage {
+		t.Fatalf("expected a usage error, got %d", code)
+	}
+}
+
+func TestTranscribe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "splice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A bar of kicks on the beats at 120 BPM.
+	const rate = 44100
+	a := wav.Audio{SampleRate: rate, Channels: 1, Samples: make([]float64, 2*rate)}
+	for i := range a.Samples {
+		at := math.Mod(float64(i)/rate, 0.5)
+		a.Samples[i] = 0.8 * math.Exp(-at/0.05) * math.Sin(2*math.Pi*60*at)
+	}
+	src := filepath.Join(dir, "loop.wav")
+	if err := wav.EncodeFile(src, a); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"transcribe", src}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("transcribe failed with %d: %s%s", code, stdout.String(), stderr.String())
+	}
+	p, err := drum.DecodeFile(filepath.Join(dir, "loop.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != p.String() || !strings.Contains(p.String(), "Tempo: 120\n(0) kick\t|x---|x---|x---|x---|\n") {
+		t.Fatalf("unexpected pattern:\n%s", stdout.String())
+	}
+
+	// Given half the tempo, the kicks are 8th notes.
+	out := filepath.Join(dir, "slow.splice")
+	if code := run([]string{"transcribe", "--tempo", "60", "-o", out, src}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("transcribe failed with %d: %s%s", code, stdout.String(), stderr.String())
+	}
+	if p, err = drum.DecodeFile(out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(p.String(), "(0) kick\t|x-x-|x-x-|----|----|\n") {
+		t.Fatalf("unexpected pattern:\n%s", p)
+	}
+
+	if code := run([]string{"transcribe", filepath.Join(dir, "missing.wav")}, &stdout, &stderr); code != exitFail {
+		t.Fatalf("expected a missing file to fail, got %d", code)
+	}
+	if code := run([]string{"transcribe", "--tempo", "-1", src}, &stdout, &stderr); code != exitUsage {
+		t.Fatalf("expected a usage error, got %d", code)
+	}
+}
@@ -0,0 +1,325 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"unicode/utf8"
+)
+
+var (
+	// ErrUnsupportedFormat is returned when the magic names a later
+	// version of the container format than the package can read.
+	ErrUnsupportedFormat = errors.New("drum: unsupported container format")
+
+	// ErrBadChunk is returned when the chunks of a chunked file are out of
+	// order, repeated or critical to a pattern the package can't read.
+	ErrBadChunk = errors.New("drum: invalid chunk")
+)
+
+// Versions of the container format, see Encode.
+const (
+
+	// FormatV1 is the format saved by the hardware, a fixed header
+	// followed by the track records, and its extended form.
+	FormatV1 = 1
+
+	// FormatV2 is the chunked format. Its payload is a list of chunks, each
+	// a four letter chunk ID followed by the big endian length of the
+	// chunk data and the data.
+	FormatV2 = 2
+)
+
+// The chunked format starts with its own magic, the last byte of which is
+// the version of the container. Readers of an earlier version stop at the
+// magic rather than misreading the payload.
+const chunkedMagic = "SPLIC2"
+
+// The chunks of the chunked format. A header chunk comes first, the others
+// may follow in any order, each of them once.
+const (
+
+	// headerChunk holds the version, tempo and grid as in the extended
+	// format. Bytes after the grid are left to later versions and skipped.
+	headerChunk = "HEAD"
+
+	// tracksChunk holds the track records as in the original format.
+	tracksChunk = "TRKS"
+
+	// metadataChunk holds the Metadata of a pattern sorted by key, each
+	// entry the big endian length of the key as a uint16, the key, the
+	// length of the value as a uint32 and the value.
+	metadataChunk = "META"
+)
+
+// Chunk is a chunk of a file in the chunked format which the package
+// doesn't know about.
+//
+// As in PNG files, the case of the first letter of the ID tells whether
+// the pattern can be read without the chunk: decoding fails on an unknown
+// chunk whose ID starts with an upper case letter, and keeps any other.
+type Chunk struct {
+	ID   string `json:"id" yaml:"id"`
+	Data []byte `json:"data" yaml:"data"`
+}
+
+// Critical reports whether the pattern can't be read without the chunk.
+func (c Chunk) Critical() bool {
+	return c.ID != "" && c.ID[0] >= 'A' && c.ID[0] <= 'Z'
+}
+
+// Format returns the version of the container format Encode writes the
+// pattern in: FormatV2 when it was decoded from the chunked format or has
+// metadata or chunks which only the chunked format can hold, FormatV1
+// otherwise.
+func (p Pattern) Format() int {
+	if p.SourceFormat == FormatV2 || p.chunked() {
+		return FormatV2
+	}
+	return FormatV1
+}
+
+// chunked reports whether the pattern has metadata or chunks, which only
+// the chunked format can hold.
+func (p Pattern) chunked() bool {
+	return len(p.Metadata) > 0 || len(p.Chunks) > 0
+}
+
+// cloneChunks returns a copy of the chunks which shares no memory with them.
+func cloneChunks(chunks []Chunk) []Chunk {
+	if chunks == nil {
+		return nil
+	}
+	c := make([]Chunk, len(chunks))
+	for i, ch := range chunks {
+		c[i] = Chunk{ID: ch.ID, Data: append([]byte(nil), ch.Data...)}
+	}
+	return c
+}
+
+// cloneMetadata returns a copy of the metadata.
+func cloneMetadata(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// encodeChunks encodes the payload of the chunked format: the header and
+// the tracks, the timing and metadata when the pattern has any, and the
+// chunks kept from decoding in their original order.
+func encodeChunks(buffer *bytes.Buffer, p Pattern) error {
+	var data bytes.Buffer
+	if err := encodeHeader(&data, p.Header, true); err != nil {
+		return err
+	}
+	if err := encodeChunk(buffer, headerChunk, data.Bytes()); err != nil {
+		return err
+	}
+
+	data.Reset()
+	if err := encodeTracks(&data, p.Tracks); err != nil {
+		return err
+	}
+	if err := encodeChunk(buffer, tracksChunk, data.Bytes()); err != nil {
+		return err
+	}
+
+	if !p.Timing.IsZero() {
+		if err := encodeChunk(buffer, timingChunk, p.Timing.encode()); err != nil {
+			return err
+		}
+	}
+
+	if len(p.Metadata) > 0 {
+		data.Reset()
+		if err := encodeMetadata(&data, p.Metadata); err != nil {
+			return err
+		}
+		if err := encodeChunk(buffer, metadataChunk, data.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range p.Chunks {
+		switch c.ID {
+		case headerChunk, tracksChunk, timingChunk, metadataChunk:
+			return fmt.Errorf("drum: chunk %q is written from the pattern", c.ID)
+		}
+		if err := encodeChunk(buffer, c.ID, c.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeChunk writes a chunk of the chunked format.
+func encodeChunk(buffer *bytes.Buffer, id string, data []byte) error {
+	if len(id) != 4 {
+		return fmt.Errorf("drum: chunk ID %q is not four bytes", id)
+	}
+	if uint64(len(data)) > math.MaxUint32 {
+		return fmt.Errorf("drum: %s chunk of %d bytes is too large", id, len(data))
+	}
+	buffer.WriteString(id)
+	binary.Write(buffer, binary.BigEndian, uint32(len(data)))
+	buffer.Write(data)
+	return nil
+}
+
+// encodeMetadata encodes the metadata entries sorted by key.
+func encodeMetadata(buffer *bytes.Buffer, m map[string]string) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := m[k]
+		if k == "" || len(k) > math.MaxUint16 || uint64(len(v)) > math.MaxUint32 {
+			return fmt.Errorf("drum: invalid metadata key %q", k)
+		}
+		binary.Write(buffer, binary.BigEndian, uint16(len(k)))
+		buffer.WriteString(k)
+		binary.Write(buffer, binary.BigEndian, uint32(len(v)))
+		buffer.WriteString(v)
+	}
+	return nil
+}
+
+// decodeChunks decodes the payload of the chunked format. Unknown chunks
+// which aren't critical are kept in Pattern.Chunks.
+func decodeChunks(payload *payloadReader, limits Limits) (Pattern, error) {
+	var p Pattern
+	seen := map[string]bool{}
+
+	for payload.N > 0 {
+		offset := payload.offset()
+		var header struct {
+			ID     [4]byte
+			Length uint32
+		}
+		if err := payload.read("chunk header", binary.BigEndian, &header); err != nil {
+			return Pattern{}, err
+		}
+		id := string(header.ID[:])
+		field := fmt.Sprintf("%q chunk", id)
+
+		// The data is read as it arrives, as the names of the tracks, so
+		// a bogus length can't claim more memory than the data holds.
+		if int64(header.Length) > payload.N {
+			return Pattern{}, &DecodeError{Offset: offset, Field: field, Err: ErrLengthMismatch}
+		}
+		start := payload.offset()
+		var data bytes.Buffer
+		if n, _ := io.CopyN(&data, payload, int64(header.Length)); n != int64(header.Length) {
+			return Pattern{}, &DecodeError{Offset: start, Field: field, Err: ErrTruncated}
+		}
+
+		switch {
+		case seen[id]:
+			return Pattern{}, &DecodeError{Offset: offset, Field: field, Err: fmt.Errorf(
+				"%w: the chunk is repeated", ErrBadChunk)}
+		case !seen[headerChunk] && id != headerChunk:
+			return Pattern{}, &DecodeError{Offset: offset, Field: field, Err: fmt.Errorf(
+				"%w: expected the %s chunk first", ErrBadChunk, headerChunk)}
+		}
+		seen[id] = true
+
+		switch id {
+		case headerChunk:
+			h, err := decodeHeader(chunkReader(data.Bytes(), start), true)
+			if err != nil {
+				return Pattern{}, err
+			}
+			p.Header = h
+		case tracksChunk:
+			tracks, err := decodeTracks(chunkReader(data.Bytes(), start), p.Header.steps(), limits)
+			if err != nil {
+				return Pattern{}, err
+			}
+			p.Tracks = tracks
+		case timingChunk:
+			t, err := decodeTiming(data.Bytes())
+			if err != nil {
+				return Pattern{}, &DecodeError{Offset: start, Field: "timing", Err: err}
+			}
+			p.Timing = t
+		case metadataChunk:
+			m, err := decodeMetadata(chunkReader(data.Bytes(), start))
+			if err != nil {
+				return Pattern{}, err
+			}
+			p.Metadata = m
+		default:
+			c := Chunk{ID: id, Data: data.Bytes()}
+			if c.Critical() {
+				return Pattern{}, &DecodeError{Offset: offset, Field: field, Err: fmt.Errorf(
+					"%w: unknown critical chunk", ErrBadChunk)}
+			}
+			p.Chunks = append(p.Chunks, c)
+		}
+	}
+
+	if !seen[headerChunk] {
+		return Pattern{}, &DecodeError{Offset: payload.offset(), Field: "chunks", Err: fmt.Errorf(
+			"%w: no %s chunk", ErrBadChunk, headerChunk)}
+	}
+	return p, nil
+}
+
+// decodeMetadata decodes the entries of the metadata chunk.
+func decodeMetadata(r *payloadReader) (map[string]string, error) {
+	m := map[string]string{}
+	for r.N > 0 {
+		offset := r.offset()
+		var keyLength uint16
+		if err := r.read("metadata key length", binary.BigEndian, &keyLength); err != nil {
+			return nil, err
+		}
+		key := make([]byte, keyLength)
+		if err := r.read("metadata key", binary.BigEndian, key); err != nil {
+			return nil, err
+		}
+		var valueLength uint32
+		if err := r.read("metadata value length", binary.BigEndian, &valueLength); err != nil {
+			return nil, err
+		}
+		if int64(valueLength) > r.N {
+			return nil, &DecodeError{Offset: r.offset(), Field: "metadata value", Err: ErrLengthMismatch}
+		}
+		value := make([]byte, valueLength)
+		if err := r.read("metadata value", binary.BigEndian, value); err != nil {
+			return nil, err
+		}
+
+		field := fmt.Sprintf("metadata %q", key)
+		if len(key) == 0 || !utf8.Valid(key) || !utf8.Valid(value) {
+			return nil, &DecodeError{Offset: offset, Field: field, Err: fmt.Errorf(
+				"%w: metadata must be non empty UTF-8 keys and UTF-8 values", ErrBadChunk)}
+		}
+		if _, ok := m[string(key)]; ok {
+			return nil, &DecodeError{Offset: offset, Field: field, Err: fmt.Errorf(
+				"%w: the key is repeated", ErrBadChunk)}
+		}
+		m[string(key)] = string(value)
+	}
+	return m, nil
+}
+
+// chunkReader returns a reader of the data of a chunk which starts at the
+// given offset of the stream, so errors tell where in the stream the
+// fields of the chunk are.
+func chunkReader(data []byte, offset int64) *payloadReader {
+	stream := &offsetReader{r: bytes.NewReader(data), n: offset}
+	return &payloadReader{LimitedReader: io.LimitedReader{R: stream, N: int64(len(data))}, stream: stream}
+}
@@ -0,0 +1,311 @@
+package drum
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChunkedFormat(t *testing.T) {
+	p, err := DecodeFile(path.Join("fixtures", "pattern_6.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	if p.Format() != FormatV2 {
+		t.Fatalf("expected format %d, got %d", FormatV2, p.Format())
+	}
+	expected := map[string]string{"author": "splice", "title": "pattern 6"}
+	if !reflect.DeepEqual(p.Metadata, expected) {
+		t.Fatalf("expected the metadata %v, got %v", expected, p.Metadata)
+	}
+	if len(p.Chunks) != 1 || p.Chunks[0].ID != "cues" || p.Chunks[0].Critical() {
+		t.Fatalf("expected the cues chunk to be kept, got %+v", p.Chunks)
+	}
+	if p.Timing.Swing != 58 || len(p.Tracks) != 6 {
+		t.Fatalf("unexpected pattern:\n%s", p)
+	}
+
+	// The unknown chunk survives an edit.
+	p.Header.Tempo = 140
+	var buf bytes.Buffer
+	if err := Encode(&buf, p); err != nil {
+		t.Fatalf("something went wrong encoding - %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte(chunkedMagic)) {
+		t.Fatalf("expected the chunked format, got %q", buf.Bytes()[:6])
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	if decoded.Header.Tempo != 140 || !reflect.DeepEqual(decoded.Chunks, p.Chunks) {
+		t.Fatalf("unexpected pattern after an edit: %+v", decoded)
+	}
+
+	// Without metadata or chunks the pattern is still written in the
+	// format it was read from.
+	p.Metadata, p.Chunks = nil, nil
+	buf.Reset()
+	if err := Encode(&buf, p); err != nil {
+		t.Fatalf("something went wrong encoding - %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte(chunkedMagic)) {
+		t.Fatalf("expected the chunked format, got %q", buf.Bytes()[:6])
+	}
+	decoded, err = Decode(&buf)
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	if decoded.Format() != FormatV2 {
+		t.Fatalf("expected format %d after a round trip, got %d", FormatV2, decoded.Format())
+	}
+
+	// A pattern which wasn't decoded is written as before.
+	p.SourceFormat = 0
+	buf.Reset()
+	if err := Encode(&buf, p); err != nil {
+		t.Fatalf("something went wrong encoding - %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte(spliceMagic)) {
+		t.Fatalf("expected the original format, got %q", buf.Bytes()[:6])
+	}
+}
+
+func TestEncodeFormat(t *testing.T) {
+	files := []string{
+		"pattern_1.splice",
+		"pattern_2.splice",
+		"pattern_3.splice",
+		"pattern_4.splice",
+		"pattern_5.splice",
+	}
+
+	// Every fixture can be written in the chunked format, and a stream
+	// may mix both versions.
+	var stream bytes.Buffer
+	var patterns []Pattern
+	for _, f := range files {
+		p, err := DecodeFile(path.Join("fixtures", f))
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", f, err)
+		}
+		p.Trailing = nil
+		patterns = append(patterns, p)
+
+		if err := EncodeFormat(&stream, p, FormatV2); err != nil {
+			t.Fatalf("something went wrong encoding %s - %v", f, err)
+		}
+		if err := EncodeFormat(&stream, p, FormatV1); err != nil {
+			t.Fatalf("something went wrong encoding %s - %v", f, err)
+		}
+	}
+
+	dec := NewDecoder(&stream)
+	for i := 0; i < 2*len(files); i++ {
+		got, err := dec.Decode()
+		if err != nil {
+			t.Fatalf("pattern %d: something went wrong decoding - %v", i, err)
+		}
+		if exp := patterns[i/2]; got.String() != exp.String() || !Diff(exp, got).Empty() {
+			t.Fatalf("pattern %d changed.\nGot:\n%s\nExpected:\n%s", i, got, exp)
+		}
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Fatalf("expected io.EOF after the last pattern, got %v", err)
+	}
+
+	p := patterns[0]
+	p.Metadata = map[string]string{"author": "me"}
+	if err := EncodeFormat(ioutil.Discard, p, FormatV1); err == nil {
+		t.Fatalf("expected an error writing metadata in format %d", FormatV1)
+	}
+	if err := EncodeFormat(ioutil.Discard, p, 3); err == nil {
+		t.Fatalf("expected an error writing format 3")
+	}
+
+	tData := []Chunk{
+		{ID: "cue", Data: []byte{1}},
+		{ID: headerChunk},
+		{ID: metadataChunk},
+	}
+	for _, c := range tData {
+		p.Chunks = []Chunk{c}
+		if err := Encode(ioutil.Discard, p); err == nil {
+			t.Fatalf("expected an error writing the chunk %q", c.ID)
+		}
+	}
+}
+
+func TestChunkErrors(t *testing.T) {
+	p := Pattern{Header: Header{Tempo: 120}, Chunks: []Chunk{{ID: "cues", Data: []byte{1}}}}
+	var buf bytes.Buffer
+	if err := Encode(&buf, p); err != nil {
+		t.Fatalf("something went wrong encoding - %v", err)
+	}
+	valid := buf.Bytes()
+
+	// withChunk returns the pattern with a chunk appended to its payload.
+	withChunk := func(id, data string) []byte {
+		var b bytes.Buffer
+		b.Write(valid[formatSize:])
+		encodeChunk(&b, id, []byte(data))
+		var out bytes.Buffer
+		out.WriteString(chunkedMagic)
+		out.Write([]byte{0, 0, 0, 0, 0, 0, 0, byte(b.Len())})
+		b.WriteTo(&out)
+		return out.Bytes()
+	}
+
+	tData := []struct {
+		data []byte
+		err  error
+	}{
+		{withChunk(metadataChunk, "\x00\x00\x00\x00\x00\x00"), ErrBadChunk},
+		{withChunk(metadataChunk, "\x00\x01a\x00\x00\x00\x09b"), ErrLengthMismatch},
+		{withChunk(headerChunk, string(valid[formatSize+8:formatSize+47])), ErrBadChunk},
+		{withChunk("Plug", ""), ErrBadChunk},
+		{withChunk(timingChunk, "\x00\x00\xc8\x42"), ErrInvalidTiming},
+		{[]byte("SPLIC9\x00\x00\x00\x00\x00\x00\x00\x00"), ErrUnsupportedFormat},
+		{[]byte("SPLICZ\x00\x00\x00\x00\x00\x00\x00\x00"), ErrBadMagic},
+	}
+
+	for i, exp := range tData {
+		if _, err := Decode(bytes.NewReader(exp.data)); !errors.Is(err, exp.err) {
+			t.Fatalf("data %d: expected %v, got %v", i, exp.err, err)
+		}
+	}
+
+	// Chunks unknown to the package which aren't critical are kept.
+	p, err := Decode(bytes.NewReader(withChunk("plug", "in")))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	if len(p.Chunks) != 2 || string(p.Chunks[1].Data) != "in" {
+		t.Fatalf("expected the plug chunk to be kept, got %+v", p.Chunks)
+	}
+}
+
+func TestMetadataMerge(t *testing.T) {
+	base, err := DecodeFile(path.Join("fixtures", "pattern_6.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+
+	ours := base.Clone()
+	ours.Metadata["author"] = "ours"
+	theirs := base.Clone()
+	delete(theirs.Metadata, "title")
+	theirs.Metadata["genre"] = "house"
+
+	merged, conflicts, err := Merge(base, ours, theirs)
+	if err != nil || len(conflicts) != 0 {
+		t.Fatalf("expected a clean merge, got %v and %v", conflicts, err)
+	}
+	expected := map[string]string{"author": "ours", "genre": "house"}
+	if !reflect.DeepEqual(merged.Metadata, expected) {
+		t.Fatalf("expected the metadata %v, got %v", expected, merged.Metadata)
+	}
+	if !reflect.DeepEqual(merged.Chunks, base.Chunks) {
+		t.Fatalf("expected the chunks to be kept, got %+v", merged.Chunks)
+	}
+
+	theirs.Metadata["author"] = "theirs"
+	merged, conflicts, err = Merge(base, ours, theirs)
+	if err != nil {
+		t.Fatalf("something went wrong merging - %v", err)
+	}
+	if len(conflicts) != 1 || !strings.Contains(conflicts[0].Msg, `"author"`) || merged.Metadata["author"] != "ours" {
+		t.Fatalf("expected a conflict keeping our author, got %v and %v", merged.Metadata, conflicts)
+	}
+}
+
+func TestMetadataDiff(t *testing.T) {
+	base, err := DecodeFile(path.Join("fixtures", "pattern_6.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+
+	p := base.Clone()
+	p.Metadata["author"] = "me"
+	delete(p.Metadata, "title")
+	p.Metadata["genre"] = "house"
+	d := Diff(base, p)
+	if d.Empty() || !d.MetadataChanged() || d.ChunksChanged() {
+		t.Fatalf("expected only the metadata to show in the diff")
+	}
+	expected := `-Metadata author: "splice"
++Metadata author: "me"
++Metadata genre: "house"
+-Metadata title: "pattern 6"
+`
+	if d.String() != expected {
+		t.Fatalf("unexpected diff.\nGot:\n%s\nExpected:\n%s", d, expected)
+	}
+
+	p = base.Clone()
+	p.Chunks[0].Data = append(p.Chunks[0].Data, 0)
+	d = Diff(base, p)
+	if d.Empty() || !d.ChunksChanged() || d.MetadataChanged() {
+		t.Fatalf("expected only the chunks to show in the diff")
+	}
+	if !strings.Contains(d.String(), fmt.Sprintf("+Chunk cues: %d bytes\n", len(p.Chunks[0].Data))) {
+		t.Fatalf("unexpected diff:\n%s", d)
+	}
+
+	// Metadata changed on one side doesn't stop a new grid being merged.
+	ours := base.Clone()
+	ours.Metadata["author"] = "ours"
+	theirs := base.Clone()
+	theirs.Header.Steps = 32
+	for i := range theirs.Tracks {
+		theirs.Tracks[i].Steps = append(theirs.Tracks[i].Steps, make([]byte, 16)...)
+	}
+	merged, conflicts, err := Merge(base, ours, theirs)
+	if err != nil || len(conflicts) != 0 {
+		t.Fatalf("expected a clean merge, got %v and %v", conflicts, err)
+	}
+	if merged.steps() != 32 || merged.Metadata["author"] != "ours" {
+		t.Fatalf("expected their grid and our author, got %d steps and %v", merged.steps(), merged.Metadata)
+	}
+}
+
+func TestMergeFormat(t *testing.T) {
+	base, err := DecodeFile(path.Join("fixtures", "pattern_6.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	base.Metadata, base.Chunks = nil, nil
+
+	// A pattern read from the chunked format is merged into it even
+	// without metadata or chunks.
+	ours := base.Clone()
+	ours.Header.Tempo = 140
+	theirs := base.Clone()
+	if err := theirs.ToggleStep(theirs.Tracks[0].ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	merged, conflicts, err := Merge(base, ours, theirs)
+	if err != nil || len(conflicts) != 0 {
+		t.Fatalf("expected a clean merge, got %v and %v", conflicts, err)
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, merged); err != nil {
+		t.Fatalf("something went wrong encoding - %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte(chunkedMagic)) {
+		t.Fatalf("expected the chunked format, got %q", buf.Bytes()[:6])
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	if !Diff(merged, decoded).Empty() || decoded.Format() != FormatV2 {
+		t.Fatalf("the merged pattern changed after a round trip.\nGot:\n%s\nExpected:\n%s", decoded, merged)
+	}
+}
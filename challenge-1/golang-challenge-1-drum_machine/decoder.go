@@ -1,69 +1,433 @@
 package drum
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
 	"os"
 	"strings"
 )
 
+var (
+	// ErrBadMagic is returned when the data does not start with the
+	// "SPLICE" identifier.
+	ErrBadMagic = errors.New("drum: not a splice file")
+
+	// ErrTruncated is returned when the data is shorter than the payload
+	// length declared in its header.
+	ErrTruncated = errors.New("drum: file is shorter than its declared length")
+
+	// ErrLengthMismatch is returned when the tracks do not exactly fill the
+	// payload length declared in the header.
+	ErrLengthMismatch = errors.New("drum: tracks do not match the declared length")
+
+	// ErrLimit is returned when the data goes over one of the Limits of
+	// the decoder.
+	ErrLimit = errors.New("drum: decoding limit exceeded")
+
+	// ErrInvalidName is returned when the name of a track is not valid
+	// UTF-8.
+	ErrInvalidName = errors.New("drum: track name is not valid UTF-8")
+)
+
+// DecodeError reports where in the data decoding failed. Err is one of the
+// errors of the package, which errors.Is finds through the DecodeError.
+type DecodeError struct {
+
+	// Offset is the position in the stream of the field which couldn't be
+	// decoded.
+	Offset int64
+
+	// Field names the field, such as "tempo" or "track 3 name".
+	Field string
+
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%v (%s at offset %d)", e.Err, e.Field, e.Offset)
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Limits bounds the resources used to decode a pattern, for data which
+// can't be trusted. A zero field sets no limit.
+type Limits struct {
+
+	// MaxSize is the largest pattern in bytes, counting the format section
+	// and the payload. Decode also counts the trailing data.
+	MaxSize int64
+
+	// MaxTracks is the largest number of tracks in a pattern.
+	MaxTracks int
+
+	// MaxNameLength is the longest track name in bytes.
+	MaxNameLength int
+}
+
+// DefaultLimits are the limits of a new Decoder. They leave plenty of room
+// for any pattern the hardware or this package can write.
+var DefaultLimits = Limits{
+	MaxSize:       1 << 20,
+	MaxTracks:     256,
+	MaxNameLength: 1024,
+}
+
 // Pattern is the high level representation of the drum pattern contained
 // in a .splice file.
 type Pattern struct {
 	Header Header
 	Tracks []Track
+
+	// Timing moves the steps off the grid. It is saved in an extension
+	// chunk after the declared payload, or in a chunk of the chunked
+	// format.
+	Timing Timing
+
+	// Metadata holds free form information about the pattern, such as its
+	// author. Only the chunked format can hold it.
+	Metadata map[string]string
+
+	// Chunks holds the chunks of a file in the chunked format which the
+	// package doesn't know about, in the order they were found. Encode
+	// writes them back after the chunks it knows.
+	Chunks []Chunk
+
+	// Trailing holds any bytes found after the declared payload and its
+	// extension chunks. They are not part of the pattern and are not
+	// written back out by Encode.
+	Trailing []byte
+
+	// SourceFormat is the version of the container format the pattern
+	// was decoded from, FormatV1 or FormatV2. It is zero for a pattern
+	// which wasn't read from a .splice file.
+	SourceFormat int
 }
 
 // String formats the return of the string method for the Patter struct.
 func (p Pattern) String() string {
 	var sb strings.Builder
 	sb.WriteString(p.Header.String())
+	if p.Timing.Swing != 0 {
+		fmt.Fprintf(&sb, "%s %s%%\n", swingPrefix, formatTempo(p.Timing.Swing))
+	}
 	for _, t := range p.Tracks {
-		sb.WriteString(t.String())
+		sb.WriteString(t.format(p.Header.stepsPerBeat()))
 	}
 	return sb.String()
 }
 
 // DecodeFile decodes the drum machine file found at the provided path
 // and returns a pointer to a parsed pattern which is the entry point to the
-// rest of the data.
+// rest of the data. The version of the container format is told by the
+// magic at the start of the file, so files of either version are read.
+// The pattern isn't checked against the rules of its hardware version, see
+// DecodeFileWith.
 func DecodeFile(path string) (Pattern, error) {
+	return DecodeFileWith(path, nil)
+}
+
+// DecodeFileWith decodes the file as DecodeFile does, then checks the
+// pattern, its trailing data included, against the rules of its hardware
+// version in the registry. It isn't checked when the registry is nil.
+func DecodeFileWith(path string, reg *Registry) (Pattern, error) {
 	fd, err := os.Open(path)
 	if err != nil {
 		return Pattern{}, fmt.Errorf("os.Read failed for file: %s. Error: %v", path, err)
 	}
 	defer fd.Close()
 
-	fi, err := os.Stat(path)
+	return DecodeWith(bufio.NewReader(fd), reg)
+}
+
+// Decode decodes a single pattern from r within the DefaultLimits. Any data
+// following the declared payload and its extension chunks is read to the
+// end and kept in Pattern.Trailing. The pattern isn't checked against the
+// rules of its hardware version, see DecodeWith.
+func Decode(r io.Reader) (Pattern, error) {
+	return DecodeWith(r, nil)
+}
+
+// DecodeWith decodes a single pattern from r as Decode does, then checks
+// the pattern, its trailing data included, against the rules of its
+// hardware version in the registry. It isn't checked when the registry is
+// nil.
+func DecodeWith(r io.Reader, reg *Registry) (Pattern, error) {
+	d := NewDecoder(r)
+	p, err := d.Decode()
+	if err == io.EOF {
+		return Pattern{}, ErrBadMagic
+	}
+	if err != nil {
+		return Pattern{}, err
+	}
+
+	// Anything left over is not part of the pattern, but still counts
+	// towards the size of the file.
+	left := int64(math.MaxInt64)
+	if d.Limits.MaxSize > 0 {
+		left = d.Limits.MaxSize - d.r.n
+	}
+	trailing, err := ioutil.ReadAll(io.LimitReader(d.r, left+1))
 	if err != nil {
-		return Pattern{}, fmt.Errorf("os.Stat failed: %v", err)
+		return Pattern{}, fmt.Errorf("reading trailing data failed: %v", err)
+	}
+	if int64(len(trailing)) > left {
+		return Pattern{}, &DecodeError{Offset: d.r.n, Field: "trailing data", Err: fmt.Errorf(
+			"%w: the file is larger than %d bytes", ErrLimit, d.Limits.MaxSize)}
+	}
+	if len(trailing) > 0 {
+		p.Trailing = trailing
 	}
 
-	// Pull in the entire contents of the file.
-	data := make([]byte, int(fi.Size()))
-	if _, err := fd.Read(data); err != nil {
-		return Pattern{}, fmt.Errorf("fd.Read failed: %v", err)
+	if reg != nil {
+		if err := reg.Validate(p); err != nil {
+			return Pattern{}, err
+		}
 	}
+	return p, nil
+}
 
-	// Place the raw data into a buffer for processing.
-	buffer := bytes.NewBuffer(data)
+// Decoder reads patterns from a stream of concatenated .splice data.
+type Decoder struct {
+
+	// Limits bounds each pattern read by the decoder.
+	Limits Limits
+
+	// Registry checks each pattern against the rules of its hardware
+	// version. Patterns aren't checked when it is nil, as for a new
+	// decoder. The patterns of a stream have no trailing data, the rules
+	// about it are only checked by DecodeWith.
+	Registry *Registry
+
+	r *offsetReader
+}
+
+// NewDecoder is a factory function for Decoder. The decoder starts with
+// the DefaultLimits and no Registry.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{Limits: DefaultLimits, r: &offsetReader{r: r}}
+}
+
+// Decode reads the next pattern from the stream. Only the declared payload
+// and the extension chunks following it are consumed so the stream is left
+// at the start of the next pattern.
+// io.EOF is returned when there are no more patterns to read.
+func (d *Decoder) Decode() (Pattern, error) {
+
+	// Decode the format section to find out how much data belongs
+	// to the pattern.
+	start := d.r.n
+	magic, length, err := decodeFormat(d.r)
+	if err == io.EOF {
+		return Pattern{}, io.EOF
+	}
+	if err != nil {
+		return Pattern{}, fmt.Errorf("decodeFormat failed: %w", err)
+	}
+	if max := d.Limits.MaxSize; max > 0 && (length > uint64(max) || length+formatSize > uint64(max)) {
+		return Pattern{}, fmt.Errorf("decodeFormat failed: %w", &DecodeError{
+			Offset: start + int64(len(magic)), Field: "length",
+			Err: fmt.Errorf("%w: payload of %d bytes, the pattern can't be larger than %d", ErrLimit, length, max)})
+	}
+
+	// Limit the reads to the payload so a short payload can't run into
+	// the data that follows it.
+	payload := &payloadReader{LimitedReader: io.LimitedReader{R: d.r, N: int64(length)}, stream: d.r}
+	if length > math.MaxInt64 {
+		payload.N = math.MaxInt64
+	}
+
+	p, err := d.decodePayload(payload, magic)
+	if err != nil {
+		return Pattern{}, err
+	}
+
+	// Decode the extension chunks following the payload.
+	if err := d.decodeExtensions(&p, start); err != nil {
+		return Pattern{}, fmt.Errorf("decodeExtensions failed: %w", err)
+	}
+
+	if d.Registry != nil {
+		if err := d.Registry.Validate(p); err != nil {
+			return Pattern{}, err
+		}
+	}
+
+	return p, nil
+}
+
+// decodePayload decodes the payload in the version of the container format
+// given by the magic.
+func (d *Decoder) decodePayload(payload *payloadReader, magic string) (Pattern, error) {
+	if magic == chunkedMagic {
+		p, err := decodeChunks(payload, d.Limits)
+		if err != nil {
+			return Pattern{}, fmt.Errorf("decodeChunks failed: %w", err)
+		}
+		p.SourceFormat = FormatV2
+		return p, nil
+	}
 
 	// Decode the header section of the data.
-	header, err := decodeHeader(buffer)
+	header, err := decodeHeader(payload, magic == extendedMagic)
 	if err != nil {
-		return Pattern{}, fmt.Errorf("decodeHeader failed: %v", err)
+		return Pattern{}, fmt.Errorf("decodeHeader failed: %w", err)
 	}
 
 	// Decode the track section of the data.
-	tracks, err := decodeTracks(buffer)
+	tracks, err := decodeTracks(payload, header.steps(), d.Limits)
 	if err != nil {
-		return Pattern{}, fmt.Errorf("decodeTracks failed: %v", err)
+		return Pattern{}, fmt.Errorf("decodeTracks failed: %w", err)
+	}
+
+	return Pattern{
+		Header:       header,
+		Tracks:       tracks,
+		SourceFormat: FormatV1,
+	}, nil
+}
+
+// decodeExtensions decodes the extension chunks following the payload of
+// a pattern which started at the given offset. Chunks added by later
+// versions of the package are skipped.
+func (d *Decoder) decodeExtensions(p *Pattern, start int64) error {
+	for {
+		magic, err := d.r.peek(len(extensionMagic))
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		if string(magic) != extensionMagic {
+			return nil
+		}
+
+		offset := d.r.n
+		var chunk struct {
+			Magic  [len(extensionMagic)]byte
+			ID     [4]byte
+			Length uint32
+		}
+		if err := binary.Read(d.r, binary.BigEndian, &chunk); err != nil {
+			return &DecodeError{Offset: offset, Field: "extension", Err: ErrTruncated}
+		}
+		field := fmt.Sprintf("%q extension", chunk.ID[:])
+		if max := d.Limits.MaxSize; max > 0 && d.r.n-start+int64(chunk.Length) > max {
+			return &DecodeError{Offset: offset, Field: field, Err: fmt.Errorf(
+				"%w: extension of %d bytes, the pattern can't be larger than %d", ErrLimit, chunk.Length, max)}
+		}
+
+		var data bytes.Buffer
+		if _, err := io.CopyN(&data, d.r, int64(chunk.Length)); err != nil {
+			return &DecodeError{Offset: offset, Field: field, Err: ErrTruncated}
+		}
+
+		switch string(chunk.ID[:]) {
+		case timingChunk:
+			t, err := decodeTiming(data.Bytes())
+			if err != nil {
+				return &DecodeError{Offset: offset, Field: "timing", Err: err}
+			}
+			p.Timing = t
+		}
+	}
+}
+
+// formatSize is the size of the format section, the magic followed by the
+// payload length.
+const formatSize = 14
+
+// decodeFormat validates the format section of the data and returns the
+// magic, which tells the original format from the extended and chunked
+// ones, and the length of the payload that follows it. io.EOF is returned
+// if there is no data at all.
+func decodeFormat(r *offsetReader) (string, uint64, error) {
+	offset := r.n
+	var magic [len(spliceMagic)]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		if err == io.EOF {
+			return "", 0, io.EOF
+		}
+		return "", 0, &DecodeError{Offset: offset, Field: "magic", Err: ErrBadMagic}
+	}
+	switch m := string(magic[:]); {
+	case m == spliceMagic || m == extendedMagic || m == chunkedMagic:
+	case m[:len(m)-1] == chunkedMagic[:len(m)-1] && m[len(m)-1] > chunkedMagic[len(m)-1] && m[len(m)-1] <= '9':
+		return "", 0, &DecodeError{Offset: offset, Field: "magic", Err: fmt.Errorf(
+			"%w: version %c, at most %d is supported", ErrUnsupportedFormat, m[len(m)-1], FormatV2)}
+	default:
+		return "", 0, &DecodeError{Offset: offset, Field: "magic", Err: ErrBadMagic}
 	}
 
-	p := Pattern{
-		Header: header,
-		Tracks: tracks,
+	// The magic is followed by the big endian length of the payload.
+	offset = r.n
+	var length uint64
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return "", 0, &DecodeError{Offset: offset, Field: "length", Err: ErrTruncated}
 	}
+	return string(magic[:]), length, nil
+}
 
-	return p, nil
+// offsetReader counts the bytes read from a stream so errors can tell where
+// they happened.
+type offsetReader struct {
+	r io.Reader
+	n int64
+
+	// unread holds the bytes peeked at, which are read again first.
+	unread []byte
+}
+
+func (o *offsetReader) Read(p []byte) (int, error) {
+	if len(o.unread) > 0 {
+		n := copy(p, o.unread)
+		o.unread = o.unread[n:]
+		o.n += int64(n)
+		return n, nil
+	}
+	n, err := o.r.Read(p)
+	o.n += int64(n)
+	return n, err
+}
+
+// peek returns the next n bytes of the stream without consuming them. Fewer
+// bytes are returned with the error when the stream ends before them.
+func (o *offsetReader) peek(n int) ([]byte, error) {
+	b := make([]byte, n)
+	m, err := io.ReadFull(o, b)
+	o.n -= int64(m)
+	o.unread = append(b[:m:m], o.unread...)
+	return b[:m], err
+}
+
+// payloadReader reads the payload of a pattern from a stream.
+type payloadReader struct {
+	io.LimitedReader
+	stream *offsetReader
+}
+
+// offset returns the position in the stream of the next byte read.
+func (p *payloadReader) offset() int64 {
+	return p.stream.n
+}
+
+// read reads a fixed size value from the payload. It tells apart a payload
+// that is too short to hold the value from a stream that ends before the
+// payload does, and annotates the error with the offset of the field.
+func (p *payloadReader) read(field string, order binary.ByteOrder, data interface{}) error {
+	offset := p.offset()
+	if int64(binary.Size(data)) > p.N {
+		return &DecodeError{Offset: offset, Field: field, Err: ErrLengthMismatch}
+	}
+	if err := binary.Read(p, order, data); err != nil {
+		return &DecodeError{Offset: offset, Field: field, Err: ErrTruncated}
+	}
+	return nil
 }
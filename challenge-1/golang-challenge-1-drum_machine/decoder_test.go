@@ -1,8 +1,16 @@
 package drum
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
 	"path"
+	"path/filepath"
 	"testing"
 )
 
@@ -73,3 +81,244 @@ Tempo: 999
 		}
 	}
 }
+
+func TestDecodeFileTrailing(t *testing.T) {
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_5.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	if len(decoded.Tracks) != 2 {
+		t.Fatalf("expected 2 tracks, got %d", len(decoded.Tracks))
+	}
+	if len(decoded.Trailing) != 31 {
+		t.Fatalf("expected 31 trailing bytes, got %d: %q", len(decoded.Trailing), decoded.Trailing)
+	}
+	if !bytes.HasPrefix(decoded.Trailing, []byte("SPLICE")) {
+		t.Fatalf("unexpected trailing bytes: %q", decoded.Trailing)
+	}
+
+	decoded, err = DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	if decoded.Trailing != nil {
+		t.Fatalf("expected no trailing bytes, got %q", decoded.Trailing)
+	}
+}
+
+func TestDecodeFileErrors(t *testing.T) {
+	original, err := ioutil.ReadFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// withLength returns a copy of the fixture declaring a different
+	// payload length.
+	withLength := func(length uint64) []byte {
+		data := append([]byte(nil), original...)
+		binary.BigEndian.PutUint64(data[6:14], length)
+		return data
+	}
+
+	// The name of the first track starts at offset 55.
+	invalidName := append([]byte(nil), original...)
+	invalidName[55] = 0xff
+
+	tData := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", []byte{}, ErrBadMagic},
+		{"bad magic", append([]byte("SPLICY"), original[6:]...), ErrBadMagic},
+		{"no length", []byte("SPLICE\x00\x00"), ErrTruncated},
+		{"truncated", original[:100], ErrTruncated},
+		{"declared too long", withLength(uint64(len(original))), ErrTruncated},
+		{"header too short", withLength(20), ErrLengthMismatch},
+		{"cuts into track", withLength(uint64(len(original) - 14 - 3)), ErrLengthMismatch},
+		{"declared huge", withLength(1 << 40), ErrLimit},
+		{"declared past int64", withLength(math.MaxUint64), ErrLimit},
+		{"invalid name", invalidName, ErrInvalidName},
+	}
+
+	dir, err := ioutil.TempDir("", "drum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, exp := range tData {
+		file := path.Join(dir, "bad.splice")
+		if err := ioutil.WriteFile(file, exp.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := DecodeFile(file)
+		if !errors.Is(err, exp.err) {
+			t.Fatalf("%s: expected error %v, got %v", exp.name, exp.err, err)
+		}
+	}
+}
+
+func TestDecoderConcatenated(t *testing.T) {
+	files := []string{"pattern_1.splice", "pattern_4.splice", "pattern_2.splice"}
+
+	var stream bytes.Buffer
+	var expected []string
+	for _, f := range files {
+		p, err := DecodeFile(path.Join("fixtures", f))
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", f, err)
+		}
+		if err := Encode(&stream, p); err != nil {
+			t.Fatalf("something went wrong encoding %s - %v", f, err)
+		}
+		expected = append(expected, p.String())
+	}
+
+	dec := NewDecoder(&stream)
+	for i, exp := range expected {
+		p, err := dec.Decode()
+		if err != nil {
+			t.Fatalf("pattern %d: something went wrong decoding - %v", i, err)
+		}
+		if p.String() != exp {
+			t.Fatalf("pattern %d wasn't decoded as expected.\nGot:\n%s\nExpected:\n%s", i, p, exp)
+		}
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Fatalf("expected io.EOF after the last pattern, got %v", err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	data, err := ioutil.ReadFile(path.Join("fixtures", "pattern_5.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	if len(p.Tracks) != 2 || len(p.Trailing) != 31 {
+		t.Fatalf("unexpected pattern: %d tracks, %d trailing bytes", len(p.Tracks), len(p.Trailing))
+	}
+
+	if _, err := Decode(bytes.NewReader(nil)); !errors.Is(err, ErrBadMagic) {
+		t.Fatalf("expected %v for empty input, got %v", ErrBadMagic, err)
+	}
+}
+
+func TestDecoderLimits(t *testing.T) {
+	original, err := ioutil.ReadFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tData := []struct {
+		name   string
+		data   []byte
+		limits Limits
+		err    error
+		field  string
+		offset int64
+	}{
+		{"defaults", original, DefaultLimits, nil, "", 0},
+		{"no limits", original, Limits{}, nil, "", 0},
+		{"tracks", original, Limits{MaxTracks: 2}, ErrLimit, "track", 101},
+		{"name", original, Limits{MaxNameLength: 4}, ErrLimit, "track 1 name", 80},
+		{"size", original, Limits{MaxSize: int64(len(original)) - 1}, ErrLimit, "length", 6},
+		{"truncated", original[:100], Limits{}, ErrTruncated, "track 1 steps", 85},
+		{"bad magic", []byte("SPLICY"), Limits{}, ErrBadMagic, "magic", 0},
+	}
+
+	for _, exp := range tData {
+		dec := NewDecoder(bytes.NewReader(exp.data))
+		dec.Limits = exp.limits
+		_, err := dec.Decode()
+		if exp.err == nil {
+			if err != nil {
+				t.Fatalf("%s: something went wrong decoding - %v", exp.name, err)
+			}
+			continue
+		}
+
+		if !errors.Is(err, exp.err) {
+			t.Fatalf("%s: expected error %v, got %v", exp.name, exp.err, err)
+		}
+		var de *DecodeError
+		if !errors.As(err, &de) {
+			t.Fatalf("%s: expected a DecodeError, got %T", exp.name, err)
+		}
+		if de.Field != exp.field || de.Offset != exp.offset {
+			t.Fatalf("%s: expected an error in %s at offset %d, got %v", exp.name, exp.field, exp.offset, err)
+		}
+	}
+}
+
+// seedFixtures adds every .splice fixture, the malformed ones included, to
+// the corpus of a fuzz target.
+func seedFixtures(f *testing.F) {
+	files, err := filepath.Glob(filepath.Join("fixtures", "*.splice"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	malformed, err := filepath.Glob(filepath.Join("fixtures", "malformed", "*.splice"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	files = append(files, malformed...)
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	seedFixtures(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		// Whatever decodes must encode and decode back to the same
+		// pattern.
+		var buf bytes.Buffer
+		if err := Encode(&buf, p); err != nil {
+			t.Fatalf("something went wrong encoding - %v", err)
+		}
+		again, err := Decode(&buf)
+		if err != nil {
+			t.Fatalf("something went wrong decoding the encoded pattern - %v", err)
+		}
+		if again.String() != p.String() {
+			t.Fatalf("pattern changed encoding it.\nGot:\n%s\nExpected:\n%s", again, p)
+		}
+	})
+}
+
+func FuzzDecoder(f *testing.F) {
+	seedFixtures(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		dec := NewDecoder(bytes.NewReader(data))
+		dec.Limits = Limits{MaxSize: 1 << 16, MaxTracks: 16, MaxNameLength: 64}
+		for {
+			p, err := dec.Decode()
+			if err != nil {
+				return
+			}
+			if len(p.Tracks) > 16 {
+				t.Fatalf("decoded %d tracks past the limit", len(p.Tracks))
+			}
+			for _, tr := range p.Tracks {
+				if len(tr.Name) > 64 {
+					t.Fatalf("decoded a name of %d bytes past the limit", len(tr.Name))
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,557 @@
+package drum
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PatternDiff describes the changes between two patterns.
+type PatternDiff struct {
+	Old, New Header
+
+	// OldTiming and NewTiming are the timing of the patterns.
+	OldTiming, NewTiming Timing
+
+	// OldMetadata and NewMetadata are the metadata of the patterns.
+	OldMetadata, NewMetadata map[string]string
+
+	// OldChunks and NewChunks are the chunks of the patterns which the
+	// package doesn't know about.
+	OldChunks, NewChunks []Chunk
+
+	// Added and Removed hold the tracks found in only one of the patterns.
+	Added   []Track
+	Removed []Track
+
+	// Changed holds the tracks found in both patterns which differ.
+	Changed []TrackDiff
+}
+
+// TrackDiff describes the changes to a track found in both patterns.
+type TrackDiff struct {
+	Old, New Track
+
+	// Steps holds the index of each step whose velocity changed.
+	Steps []int
+}
+
+// Empty reports whether the patterns are the same.
+func (d PatternDiff) Empty() bool {
+	return !d.VersionChanged() && !d.TempoChanged() && !d.GridChanged() && !d.TimingChanged() &&
+		!d.MetadataChanged() && !d.ChunksChanged() && len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// VersionChanged reports whether the hardware version changed.
+func (d PatternDiff) VersionChanged() bool {
+	return d.Old.Version != d.New.Version
+}
+
+// TempoChanged reports whether the tempo changed.
+func (d PatternDiff) TempoChanged() bool {
+	return d.Old.Tempo != d.New.Tempo
+}
+
+// GridChanged reports whether the number of steps or steps per beat
+// changed.
+func (d PatternDiff) GridChanged() bool {
+	return d.Old.steps() != d.New.steps() || d.Old.stepsPerBeat() != d.New.stepsPerBeat()
+}
+
+// TimingChanged reports whether the swing or the step offsets changed.
+func (d PatternDiff) TimingChanged() bool {
+	return !sameTiming(d.OldTiming, d.NewTiming)
+}
+
+// MetadataChanged reports whether a metadata key was added, removed or
+// given a new value.
+func (d PatternDiff) MetadataChanged() bool {
+	return len(metadataKeys(d.OldMetadata, d.NewMetadata)) > 0
+}
+
+// metadataKeys returns the sorted keys whose value differs between the
+// metadata a and b, a missing key differing from any value.
+func metadataKeys(a, b map[string]string) []string {
+	var keys []string
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			keys = append(keys, k)
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ChunksChanged reports whether the chunks unknown to the package, or
+// their order, changed.
+func (d PatternDiff) ChunksChanged() bool {
+	if len(d.OldChunks) != len(d.NewChunks) {
+		return true
+	}
+	for i, c := range d.OldChunks {
+		if c.ID != d.NewChunks[i].ID || !bytes.Equal(c.Data, d.NewChunks[i].Data) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameTiming reports whether two timings play the steps at the same time.
+func sameTiming(a, b Timing) bool {
+	swing := func(t Timing) float32 {
+		if t.Swing == 0 {
+			return MinSwing
+		}
+		return t.Swing
+	}
+	if swing(a) != swing(b) {
+		return false
+	}
+	offset := func(t Timing, step int) float32 {
+		if step < len(t.Offsets) {
+			return t.Offsets[step]
+		}
+		return 0
+	}
+	for s := 0; s < len(a.Offsets) || s < len(b.Offsets); s++ {
+		if offset(a, s) != offset(b, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the diff in the style of a unified diff, tracks being
+// printed as in Track.String with a "-" in front of old lines and a "+"
+// in front of new ones.
+func (d PatternDiff) String() string {
+	var sb strings.Builder
+	if d.VersionChanged() {
+		fmt.Fprintf(&sb, "-Saved with HW Version: %s\n", d.Old.version())
+		fmt.Fprintf(&sb, "+Saved with HW Version: %s\n", d.New.version())
+	}
+	if d.TempoChanged() {
+		fmt.Fprintf(&sb, "-Tempo: %s\n", formatTempo(d.Old.Tempo))
+		fmt.Fprintf(&sb, "+Tempo: %s\n", formatTempo(d.New.Tempo))
+	}
+	if d.GridChanged() {
+		fmt.Fprintf(&sb, "-Steps: %d (%d per beat)\n", d.Old.steps(), d.Old.stepsPerBeat())
+		fmt.Fprintf(&sb, "+Steps: %d (%d per beat)\n", d.New.steps(), d.New.stepsPerBeat())
+	}
+	if d.TimingChanged() {
+		fmt.Fprintf(&sb, "-%s %s%% %v\n", swingPrefix, formatTempo(d.OldTiming.Swing), d.OldTiming.Offsets)
+		fmt.Fprintf(&sb, "+%s %s%% %v\n", swingPrefix, formatTempo(d.NewTiming.Swing), d.NewTiming.Offsets)
+	}
+	for _, k := range metadataKeys(d.OldMetadata, d.NewMetadata) {
+		if v, ok := d.OldMetadata[k]; ok {
+			fmt.Fprintf(&sb, "-Metadata %s: %q\n", k, v)
+		}
+		if v, ok := d.NewMetadata[k]; ok {
+			fmt.Fprintf(&sb, "+Metadata %s: %q\n", k, v)
+		}
+	}
+	if d.ChunksChanged() {
+		for _, c := range d.OldChunks {
+			fmt.Fprintf(&sb, "-Chunk %s: %d bytes\n", c.ID, len(c.Data))
+		}
+		for _, c := range d.NewChunks {
+			fmt.Fprintf(&sb, "+Chunk %s: %d bytes\n", c.ID, len(c.Data))
+		}
+	}
+	for _, t := range d.Removed {
+		sb.WriteString("-" + t.format(d.Old.stepsPerBeat()))
+	}
+	for _, c := range d.Changed {
+		sb.WriteString("-" + c.Old.format(d.Old.stepsPerBeat()))
+		sb.WriteString("+" + c.New.format(d.New.stepsPerBeat()))
+	}
+	for _, t := range d.Added {
+		sb.WriteString("+" + t.format(d.New.stepsPerBeat()))
+	}
+	return sb.String()
+}
+
+// Diff compares two patterns. Tracks are matched by ID and name, then by
+// ID alone and last by name alone, so renamed tracks and tracks given a
+// new ID show up as changes rather than as a removal and an addition.
+func Diff(a, b Pattern) PatternDiff {
+	d := PatternDiff{
+		Old: a.Header, New: b.Header,
+		OldTiming: a.Timing, NewTiming: b.Timing,
+		OldMetadata: a.Metadata, NewMetadata: b.Metadata,
+		OldChunks: a.Chunks, NewChunks: b.Chunks,
+	}
+
+	matches, onlyA, onlyB := matchTracks(a.Tracks, b.Tracks)
+	for _, m := range matches {
+		old, new := a.Tracks[m[0]], b.Tracks[m[1]]
+		td := TrackDiff{Old: old, New: new}
+		for s := 0; s < len(old.Steps) || s < len(new.Steps); s++ {
+			if old.Velocity(s) != new.Velocity(s) {
+				td.Steps = append(td.Steps, s)
+			}
+		}
+		if old.ID != new.ID || old.Name != new.Name || len(td.Steps) > 0 {
+			d.Changed = append(d.Changed, td)
+		}
+	}
+	for _, i := range onlyA {
+		d.Removed = append(d.Removed, a.Tracks[i])
+	}
+	for _, i := range onlyB {
+		d.Added = append(d.Added, b.Tracks[i])
+	}
+
+	return d
+}
+
+// matchTracks pairs up the tracks of a and b, returning the index in a and
+// b of each pair followed by the index of the tracks left over in each.
+func matchTracks(a, b []Track) ([][2]int, []int, []int) {
+	usedA := make([]bool, len(a))
+	usedB := make([]bool, len(b))
+	var matches [][2]int
+
+	rules := []func(x, y Track) bool{
+		func(x, y Track) bool { return x.ID == y.ID && x.Name == y.Name },
+		func(x, y Track) bool { return x.ID == y.ID },
+		func(x, y Track) bool { return x.Name == y.Name },
+	}
+	for _, same := range rules {
+		for i := range a {
+			if usedA[i] {
+				continue
+			}
+			for j := range b {
+				if !usedB[j] && same(a[i], b[j]) {
+					usedA[i], usedB[j] = true, true
+					matches = append(matches, [2]int{i, j})
+					break
+				}
+			}
+		}
+	}
+
+	var onlyA, onlyB []int
+	for i := range a {
+		if !usedA[i] {
+			onlyA = append(onlyA, i)
+		}
+	}
+	for j := range b {
+		if !usedB[j] {
+			onlyB = append(onlyB, j)
+		}
+	}
+	return matches, onlyA, onlyB
+}
+
+// Conflict is a change made differently on both sides of a merge. The
+// merged pattern keeps our side of each conflict.
+type Conflict struct {
+
+	// Header is set for conflicts in the header rather than in a track.
+	Header bool
+
+	// Track is the ID of the track in conflict, as found in our pattern
+	// when it has the track.
+	Track uint8
+
+	// Step is the step in conflict, -1 when the conflict is about the
+	// track as a whole.
+	Step int
+
+	// Msg describes the conflict.
+	Msg string
+}
+
+func (c Conflict) String() string {
+	switch {
+	case c.Header:
+		return "header: " + c.Msg
+	case c.Step >= 0:
+		return fmt.Sprintf("track %d step %d: %s", c.Track, c.Step, c.Msg)
+	default:
+		return fmt.Sprintf("track %d: %s", c.Track, c.Msg)
+	}
+}
+
+// Merge merges the changes made in ours and theirs since base. Changes made
+// on one side only are applied. Changes made on both sides are kept when
+// they are the same and reported as a Conflict otherwise, the merged
+// pattern keeping our side. The three patterns must have the same number
+// of steps unless only one side changed it.
+func Merge(base, ours, theirs Pattern) (Pattern, []Conflict, error) {
+	var conflicts []Conflict
+	headerConflict := func(msg string) {
+		conflicts = append(conflicts, Conflict{Header: true, Step: -1, Msg: msg})
+	}
+
+	// The header is merged field by field, and the pattern is written in
+	// the later container format of the two sides.
+	merged := Pattern{Header: ours.Header, SourceFormat: ours.SourceFormat}
+	if theirs.SourceFormat > merged.SourceFormat {
+		merged.SourceFormat = theirs.SourceFormat
+	}
+	if ours.Header.Version == base.Header.Version {
+		merged.Header.Version = theirs.Header.Version
+	} else if theirs.Header.Version != base.Header.Version && theirs.Header.Version != ours.Header.Version {
+		headerConflict(fmt.Sprintf("version changed to %q and %q",
+			ours.Header.version(), theirs.Header.version()))
+	}
+	if ours.Header.Tempo == base.Header.Tempo {
+		merged.Header.Tempo = theirs.Header.Tempo
+	} else if theirs.Header.Tempo != base.Header.Tempo && theirs.Header.Tempo != ours.Header.Tempo {
+		headerConflict(fmt.Sprintf("tempo changed to %s and %s",
+			formatTempo(ours.Header.Tempo), formatTempo(theirs.Header.Tempo)))
+	}
+
+	if sameTiming(ours.Timing, base.Timing) {
+		merged.Timing = theirs.Timing.Clone()
+	} else {
+		merged.Timing = ours.Timing.Clone()
+		if !sameTiming(theirs.Timing, base.Timing) && !sameTiming(theirs.Timing, ours.Timing) {
+			headerConflict("swing or step offsets changed on both sides")
+		}
+	}
+
+	// The metadata is merged key by key, and the chunks the package
+	// doesn't know about are kept from our side.
+	merged.Metadata = mergeMetadata(base.Metadata, ours.Metadata, theirs.Metadata, headerConflict)
+	merged.Chunks = cloneChunks(ours.Chunks)
+
+	// A change of grid can't be merged step by step, it is only taken
+	// when the other side left the grid and the tracks alone. The
+	// metadata and chunks were merged above.
+	grid := func(p Pattern) [2]int { return [2]int{p.steps(), p.Header.stepsPerBeat()} }
+	unchanged := func(p Pattern) bool {
+		p.Metadata, p.Chunks = base.Metadata, base.Chunks
+		return Diff(base, p).Empty()
+	}
+	switch {
+	case grid(ours) == grid(base) && grid(theirs) == grid(base):
+	case grid(ours) == grid(base) && unchanged(ours):
+		p := theirs.Clone()
+		p.Metadata, p.Chunks, p.Trailing = merged.Metadata, merged.Chunks, nil
+		p.SourceFormat = merged.SourceFormat
+		return p, conflicts, nil
+	case grid(theirs) == grid(base) && unchanged(theirs):
+		p := ours.Clone()
+		p.Metadata, p.Chunks, p.Trailing = merged.Metadata, merged.Chunks, nil
+		p.SourceFormat = merged.SourceFormat
+		return p, conflicts, nil
+	default:
+		return Pattern{}, nil, fmt.Errorf("drum: can't merge patterns whose step counts changed")
+	}
+
+	oursMatches, _, oursAdded := matchTracks(base.Tracks, ours.Tracks)
+	theirsMatches, _, theirsAdded := matchTracks(base.Tracks, theirs.Tracks)
+
+	// side returns the index of the track matched to each base track, -1
+	// for removed tracks.
+	side := func(matches [][2]int) []int {
+		idx := make([]int, len(base.Tracks))
+		for i := range idx {
+			idx[i] = -1
+		}
+		for _, m := range matches {
+			idx[m[0]] = m[1]
+		}
+		return idx
+	}
+	oursIdx, theirsIdx := side(oursMatches), side(theirsMatches)
+
+	// Tracks are merged in our order, with the tracks only found on their
+	// side after them.
+	mergedTracks := map[int]Track{}
+	var theirsOnly []Track
+	for b, bt := range base.Tracks {
+		o, t := oursIdx[b], theirsIdx[b]
+		switch {
+		case o < 0 && t < 0:
+
+			// Removed on both sides.
+		case o < 0:
+			if !sameTrack(bt, theirs.Tracks[t]) {
+				conflicts = append(conflicts, Conflict{Track: bt.ID, Step: -1,
+					Msg: "removed in ours, changed in theirs"})
+			}
+		case t < 0:
+			if !sameTrack(bt, ours.Tracks[o]) {
+				conflicts = append(conflicts, Conflict{Track: ours.Tracks[o].ID, Step: -1,
+					Msg: "changed in ours, removed in theirs"})
+				mergedTracks[o] = ours.Tracks[o].Clone()
+			}
+		default:
+			mt, c := mergeTrack(bt, ours.Tracks[o], theirs.Tracks[t])
+			conflicts = append(conflicts, c...)
+			mergedTracks[o] = mt
+		}
+	}
+
+	// Tracks added on both sides with the same ID must be the same.
+	for _, o := range oursAdded {
+		mergedTracks[o] = ours.Tracks[o].Clone()
+	}
+	for _, t := range theirsAdded {
+		tt := theirs.Tracks[t]
+		clash := false
+		for _, o := range oursAdded {
+			ot := ours.Tracks[o]
+			if ot.ID != tt.ID {
+				continue
+			}
+			clash = true
+			if !sameTrack(ot, tt) {
+				conflicts = append(conflicts, Conflict{Track: ot.ID, Step: -1,
+					Msg: "added differently in ours and theirs"})
+			}
+		}
+		if !clash {
+			theirsOnly = append(theirsOnly, tt.Clone())
+		}
+	}
+
+	var oursIDs []uint8
+	for o := range ours.Tracks {
+		if t, ok := mergedTracks[o]; ok {
+			merged.Tracks = append(merged.Tracks, t)
+			oursIDs = append(oursIDs, ours.Tracks[o].ID)
+		}
+	}
+
+	// Track IDs must stay unique. A track given an ID on their side which
+	// another track uses keeps our ID, and a track added on their side
+	// with an ID in use is left out.
+	for {
+		i := duplicateID(merged.Tracks, oursIDs)
+		if i < 0 {
+			break
+		}
+		conflicts = append(conflicts, Conflict{Track: oursIDs[i], Step: -1,
+			Msg: fmt.Sprintf("ID changed to %d in theirs, which another track uses", merged.Tracks[i].ID)})
+		merged.Tracks[i].ID = oursIDs[i]
+	}
+	for _, tt := range theirsOnly {
+		if _, err := merged.track(tt.ID); err == nil {
+			conflicts = append(conflicts, Conflict{Track: tt.ID, Step: -1,
+				Msg: "added in theirs with an ID used in ours"})
+			continue
+		}
+		merged.Tracks = append(merged.Tracks, tt)
+	}
+
+	return merged, conflicts, nil
+}
+
+// duplicateID returns the index of a track which shares its ID with
+// another one and was given a new ID on their side, oursIDs holding our ID
+// of each track. It returns -1 when there is none.
+func duplicateID(tracks []Track, oursIDs []uint8) int {
+	seen := map[uint8]int{}
+	for i, t := range tracks {
+		j, ok := seen[t.ID]
+		if !ok {
+			seen[t.ID] = i
+			continue
+		}
+		switch {
+		case t.ID != oursIDs[i]:
+			return i
+		case tracks[j].ID != oursIDs[j]:
+			return j
+		}
+	}
+	return -1
+}
+
+// mergeMetadata merges the metadata changed on both sides, keeping our
+// value of the keys changed differently.
+func mergeMetadata(base, ours, theirs map[string]string, conflict func(msg string)) map[string]string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range []map[string]string{base, ours, theirs} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	var merged map[string]string
+	for _, k := range keys {
+		b, bok := base[k]
+		o, ook := ours[k]
+		t, tok := theirs[k]
+		v, ok := o, ook
+		if o == b && ook == bok {
+			v, ok = t, tok
+		} else if (t != b || tok != bok) && (t != o || tok != ook) {
+			conflict(fmt.Sprintf("metadata %q changed on both sides", k))
+		}
+		if ok {
+			if merged == nil {
+				merged = map[string]string{}
+			}
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// mergeTrack merges the changes to a track made on both sides.
+func mergeTrack(base, ours, theirs Track) (Track, []Conflict) {
+	var conflicts []Conflict
+	merged := ours.Clone()
+
+	if ours.ID == base.ID {
+		merged.ID = theirs.ID
+	} else if theirs.ID != base.ID && theirs.ID != ours.ID {
+		conflicts = append(conflicts, Conflict{Track: ours.ID, Step: -1,
+			Msg: fmt.Sprintf("ID changed to %d and %d", ours.ID, theirs.ID)})
+	}
+	if ours.Name == base.Name {
+		merged.Name = theirs.Name
+	} else if theirs.Name != base.Name && theirs.Name != ours.Name {
+		conflicts = append(conflicts, Conflict{Track: ours.ID, Step: -1,
+			Msg: fmt.Sprintf("renamed to %q and %q", ours.Name, theirs.Name)})
+	}
+
+	for s := range merged.Steps {
+		b, o, t := base.Velocity(s), ours.Velocity(s), theirs.Velocity(s)
+		switch {
+		case o == b:
+			merged.Steps[s] = theirs.Steps[s]
+		case t == b || t == o:
+		default:
+			conflicts = append(conflicts, Conflict{Track: ours.ID, Step: s,
+				Msg: fmt.Sprintf("base %s, ours %s, theirs %s",
+					stepLetter(base, s), stepLetter(ours, s), stepLetter(theirs, s))})
+		}
+	}
+
+	return merged, conflicts
+}
+
+// sameTrack reports whether the tracks have the same ID, name and steps.
+func sameTrack(a, b Track) bool {
+	return a.ID == b.ID && a.Name == b.Name && bytes.Equal(a.Steps, b.Steps)
+}
+
+// stepLetter returns the grid letter of a step, with its velocity when it
+// isn't one of the plain values.
+func stepLetter(t Track, step int) string {
+	letter := string(t.letters()[step])
+	if v := t.Steps[step]; v != 0 && v != StepOn && v != AccentVelocity {
+		return fmt.Sprintf("%s(%d)", letter, v)
+	}
+	return letter
+}
@@ -0,0 +1,173 @@
+package drum
+
+import (
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a, err := DecodeFile(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	if d := Diff(a, a.Clone()); !d.Empty() || d.String() != "" {
+		t.Fatalf("expected no differences between a pattern and its copy, got:\n%s", d)
+	}
+
+	b := a.Clone()
+	edits := []Edit{
+		func(p *Pattern) error { return p.SetTempo(120) },
+		func(p *Pattern) error { return p.SetStep(0, 2, StepOn) },
+		func(p *Pattern) error { return p.SetStep(0, 8, AccentVelocity) },
+		func(p *Pattern) error { return p.RenameTrack(1, "rim") },
+		func(p *Pattern) error { return p.RemoveTrack(5) },
+		func(p *Pattern) error { return p.AddTrack(Track{ID: 9, Name: "clap"}) },
+	}
+	for i, edit := range edits {
+		if err := edit(&b); err != nil {
+			t.Fatalf("edit %d failed - %v", i, err)
+		}
+	}
+
+	d := Diff(a, b)
+	if d.Empty() || !d.TempoChanged() || d.VersionChanged() || d.GridChanged() {
+		t.Fatalf("unexpected header changes: %+v", d)
+	}
+	if len(d.Changed) != 2 || !reflect.DeepEqual(d.Changed[0].Steps, []int{2, 8}) || d.Changed[1].Steps != nil {
+		t.Fatalf("unexpected track changes: %+v", d.Changed)
+	}
+
+	expected := `-Tempo: 98.4
++Tempo: 120
+-(5) cowbell	|----|----|x---|----|
+-(0) kick	|x---|----|x---|----|
++(0) kick	|x-x-|----|X---|----|
+-(1) snare	|----|x---|----|x---|
++(1) rim	|----|x---|----|x---|
++(9) clap	|----|----|----|----|
+`
+	if d.String() != expected {
+		t.Fatalf("unexpected diff.\nGot:\n%s\nExpected:\n%s", d, expected)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	base, err := DecodeFile(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+
+	edit := func(edits ...Edit) Pattern {
+		p := base.Clone()
+		for i, edit := range edits {
+			if err := edit(&p); err != nil {
+				t.Fatalf("edit %d failed - %v", i, err)
+			}
+		}
+		return p
+	}
+
+	ours := edit(
+		func(p *Pattern) error { return p.SetTempo(120) },
+		func(p *Pattern) error { return p.SetStep(0, 2, StepOn) },
+		func(p *Pattern) error { return p.SetStep(1, 4, AccentVelocity) },
+		func(p *Pattern) error { return p.AddTrack(Track{ID: 9, Name: "clap"}) },
+	)
+	theirs := edit(
+		func(p *Pattern) error { return p.SetStep(0, 14, StepOn) },
+		func(p *Pattern) error { return p.SetStep(1, 4, AccentVelocity) },
+		func(p *Pattern) error { return p.RenameTrack(3, "hh") },
+		func(p *Pattern) error { return p.RemoveTrack(5) },
+	)
+
+	merged, conflicts, err := Merge(base, ours, theirs)
+	if err != nil {
+		t.Fatalf("something went wrong merging - %v", err)
+	}
+	if len(conflicts) != 0 {
+		t.Fatalf("expected no conflicts, got %v", conflicts)
+	}
+	expected := `Saved with HW Version: 0.808-alpha
+Tempo: 120
+(0) kick	|x-x-|----|x---|--x-|
+(1) snare	|----|X---|----|x---|
+(3) hh	|--x-|--x-|x-x-|--x-|
+(9) clap	|----|----|----|----|
+`
+	if merged.String() != expected {
+		t.Fatalf("unexpected merge.\nGot:\n%s\nExpected:\n%s", merged, expected)
+	}
+
+	// Ours is kept when both sides change the same thing differently.
+	ours = edit(
+		func(p *Pattern) error { return p.SetTempo(120) },
+		func(p *Pattern) error { return p.SetStep(0, 1, AccentVelocity) },
+		func(p *Pattern) error { return p.RenameTrack(3, "hh") },
+	)
+	theirs = edit(
+		func(p *Pattern) error { return p.SetTempo(90) },
+		func(p *Pattern) error { return p.SetStep(0, 1, StepOn) },
+		func(p *Pattern) error { return p.RemoveTrack(3) },
+	)
+	merged, conflicts, err = Merge(base, ours, theirs)
+	if err != nil {
+		t.Fatalf("something went wrong merging - %v", err)
+	}
+	var got []string
+	for _, c := range conflicts {
+		got = append(got, c.String())
+	}
+	exp := []string{
+		"header: tempo changed to 120 and 90",
+		"track 0 step 1: base -, ours X, theirs x",
+		"track 3: changed in ours, removed in theirs",
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("unexpected conflicts.\nGot: %q\nExpected: %q", got, exp)
+	}
+	if merged.String() != ours.String() {
+		t.Fatalf("expected the merge to keep ours.\nGot:\n%s\nExpected:\n%s", merged, ours)
+	}
+
+	// Track IDs stay unique when one side takes the ID the other gives
+	// to a new track.
+	ours = edit(func(p *Pattern) error { return p.AddTrack(Track{ID: 7, Name: "clap"}) })
+	theirs = edit(func(p *Pattern) error {
+		i, err := p.track(3)
+		if err != nil {
+			return err
+		}
+		p.Tracks[i].ID = 7
+		return nil
+	})
+	merged, conflicts, err = Merge(base, ours, theirs)
+	if err != nil {
+		t.Fatalf("something went wrong merging - %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0].String() != "track 3: ID changed to 7 in theirs, which another track uses" {
+		t.Fatalf("expected a conflict about the ID of track 3, got %v", conflicts)
+	}
+	if merged.String() != ours.String() {
+		t.Fatalf("expected the merge to keep ours.\nGot:\n%s\nExpected:\n%s", merged, ours)
+	}
+	ours, theirs = theirs, ours
+	merged, conflicts, err = Merge(base, ours, theirs)
+	if err != nil {
+		t.Fatalf("something went wrong merging - %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0].String() != "track 7: added in theirs with an ID used in ours" {
+		t.Fatalf("expected a conflict about the added track, got %v", conflicts)
+	}
+	if merged.String() != ours.String() {
+		t.Fatalf("expected the merge to keep ours.\nGot:\n%s\nExpected:\n%s", merged, ours)
+	}
+
+	// Step counts changed on both sides can't be merged.
+	ours, theirs = base.Clone(), base.Clone()
+	ours.Header.Steps = 8
+	theirs.Header.Steps = 32
+	if _, _, err := Merge(base, ours, theirs); err == nil {
+		t.Fatalf("expected merging different step counts to fail")
+	}
+}
@@ -8,6 +8,29 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// defaultSteps is the number of steps in a track saved by the hardware.
+	defaultSteps = 16
+
+	// defaultStepsPerBeat makes each step a 16th note.
+	defaultStepsPerBeat = 4
+)
+
+const (
+	// StepOn is the value saved by the hardware for a step which plays. It
+	// carries no velocity and plays at NormalVelocity.
+	StepOn = 1
+
+	// NormalVelocity is the velocity of an unaccented step. Any step
+	// louder than it is an accent.
+	NormalVelocity = 200
+
+	// AccentVelocity is the velocity given to accented steps which have
+	// no velocity of their own, such as an "X" in the text form.
+	AccentVelocity = 255
 )
 
 // Header is the representation of the header of the drum pattern
@@ -15,117 +38,235 @@ import (
 type Header struct {
 	Version [32]byte
 	Tempo   float32
+
+	// Steps is the number of steps in every track of the pattern, 16 when
+	// zero.
+	Steps int
+
+	// StepsPerBeat is the number of steps in each beat, which is a
+	// quarter note, 4 when zero. Together with Steps it sets the time
+	// signature: 12 steps at 3 per beat is a bar of 4/4 in triplets.
+	StepsPerBeat int
 }
 
 // String formats the return of the string method for the Header struct.
 func (d Header) String() string {
-	return fmt.Sprintf("Saved with HW Version: %s\nTempo: %s\n",
-		bytes.Trim(d.Version[:], "\x00"),
-		strings.TrimSuffix(fmt.Sprintf("%.1f", d.Tempo), ".0"),
+	s := fmt.Sprintf("Saved with HW Version: %s\nTempo: %s\n",
+		d.version(),
+		formatTempo(d.Tempo),
 	)
+
+	// The step count is only shown for grids the hardware can't save.
+	switch {
+	case d.stepsPerBeat() != defaultStepsPerBeat:
+		s += fmt.Sprintf("Steps: %d (%d per beat)\n", d.steps(), d.stepsPerBeat())
+	case d.steps() != defaultSteps:
+		s += fmt.Sprintf("Steps: %d\n", d.steps())
+	}
+
+	return s
 }
 
-// decodeHeader decodes the header of the drum pattern into a Header struct.
-func decodeHeader(buffer *bytes.Buffer) (Header, error) {
+// formatTempo formats the tempo with a single decimal, which is left out
+// for whole numbers.
+func formatTempo(tempo float32) string {
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", tempo), ".0")
+}
 
-	// Extract the header bytes from the data.
-	var header struct {
-		Format  [14]byte
-		Version [32]byte
+// steps returns the number of steps in each track.
+func (d Header) steps() int {
+	if d.Steps <= 0 {
+		return defaultSteps
 	}
-	if err := binary.Read(buffer, binary.BigEndian, &header); err != nil {
+	return d.Steps
+}
+
+// stepsPerBeat returns the number of steps in each beat.
+func (d Header) stepsPerBeat() int {
+	if d.StepsPerBeat <= 0 {
+		return defaultStepsPerBeat
+	}
+	return d.StepsPerBeat
+}
+
+// Grid returns the number of steps in each track and in each beat, the
+// defaults for a header which leaves them unset.
+func (d Header) Grid() (steps, stepsPerBeat int) {
+	return d.steps(), d.stepsPerBeat()
+}
+
+// version returns the version without the padding around it.
+func (d Header) version() string {
+	return string(bytes.Trim(d.Version[:], "\x00"))
+}
+
+// decodeHeader decodes the header of the drum pattern into a Header struct.
+// Extended headers also hold the step count of the pattern.
+func decodeHeader(payload *payloadReader, extended bool) (Header, error) {
+
+	// Extract the version which is the first 32 bytes of the payload.
+	var version [32]byte
+	if err := payload.read("version", binary.BigEndian, &version); err != nil {
 		return Header{}, err
 	}
 
 	// Extract the tempo value which is the next four bytes.
 	var tempo float32
-	if err := binary.Read(buffer, binary.LittleEndian, &tempo); err != nil {
+	if err := payload.read("tempo", binary.LittleEndian, &tempo); err != nil {
 		return Header{}, err
 	}
 
 	h := Header{
-		Version: header.Version,
+		Version: version,
 		Tempo:   tempo,
 	}
 
+	if extended {
+		var grid struct {
+			Steps        uint16
+			StepsPerBeat uint8
+		}
+		offset := payload.offset()
+		if err := payload.read("grid", binary.BigEndian, &grid); err != nil {
+			return Header{}, err
+		}
+		if grid.Steps == 0 || grid.StepsPerBeat == 0 {
+			return Header{}, &DecodeError{Offset: offset, Field: "grid", Err: fmt.Errorf(
+				"%w: invalid grid of %d steps at %d per beat", ErrLengthMismatch, grid.Steps, grid.StepsPerBeat)}
+		}
+		h.Steps = int(grid.Steps)
+		h.StepsPerBeat = int(grid.StepsPerBeat)
+	}
+
 	return h, nil
 }
 
 // Track is the string representation of a track combining the ID, Name,
 // and formatted steps.
 type Track struct {
-	ID    uint8
-	Name  string
-	Steps [16]byte
+	ID   uint8
+	Name string
+
+	// Steps holds the velocity of each step from 0 to 255, a step with a
+	// velocity of 0 does not play. See StepOn for steps saved by the
+	// hardware.
+	Steps []byte
+}
+
+// Velocity returns the velocity of the step, 0 if the step doesn't play
+// or is past the end of the track.
+func (t Track) Velocity(step int) uint8 {
+	if step < 0 || step >= len(t.Steps) {
+		return 0
+	}
+	if t.Steps[step] == StepOn {
+		return NormalVelocity
+	}
+	return t.Steps[step]
 }
 
 // String formats the return of the string method for the Track struct.
 func (t Track) String() string {
+	return t.format(defaultStepsPerBeat)
+}
 
-	// Convert the bytes representation of the steps
-	// into the desired string format.
+// format formats the track with the steps of each beat grouped together.
+func (t Track) format(stepsPerBeat int) string {
 	var sb strings.Builder
+	fmt.Fprintf(&sb, "(%d) %s\t|", t.ID, t.Name)
+	for i, c := range t.letters() {
+		sb.WriteByte(c)
+		if (i+1)%stepsPerBeat == 0 || i == len(t.Steps)-1 {
+			sb.WriteString("|")
+		}
+	}
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+// Letters returns the grid letter of each step, as printed by String.
+func (t Track) Letters() string {
+	return string(t.letters())
+}
+
+// letters converts the bytes representation of the steps into the grid
+// letter of each step.
+func (t Track) letters() []byte {
+	letters := make([]byte, len(t.Steps))
 	for i := range t.Steps {
-		switch t.Steps[i] {
-		case 1:
+		switch v := t.Velocity(i); {
+		case v > NormalVelocity:
+
+			// "X" represents an accented sound being triggered in a step.
+			letters[i] = 'X'
+		case v > 0:
 
 			// "x" represents sound output being triggered in a step.
-			sb.WriteString("x")
+			letters[i] = 'x'
 		default:
 
 			// "-" represents no sound output being triggered in a step.
-			sb.WriteString("-")
+			letters[i] = '-'
 		}
 	}
-	steps := sb.String()
-
-	return fmt.Sprintf("(%d) %s\t|%s|%s|%s|%s|\n",
-		t.ID,
-		t.Name,
-		steps[0:4],
-		steps[4:8],
-		steps[8:12],
-		steps[12:16],
-	)
+	return letters
 }
 
 // decodeTracks decodes each track and appends all tracks into a single slice.
-func decodeTracks(buffer *bytes.Buffer) ([]Track, error) {
+// The tracks must exactly fill what is left of the payload.
+func decodeTracks(payload *payloadReader, steps int, limits Limits) ([]Track, error) {
 	var tracks []Track
 
-	for {
+	for payload.N > 0 {
+		if limits.MaxTracks > 0 && len(tracks) == limits.MaxTracks {
+			return nil, &DecodeError{Offset: payload.offset(), Field: "track", Err: fmt.Errorf(
+				"%w: more than %d tracks", ErrLimit, limits.MaxTracks)}
+		}
 
 		// Extract the header of the track.
 		var header struct {
 			ID     uint8
 			Length uint32
 		}
-		if err := binary.Read(buffer, binary.BigEndian, &header); err != nil {
-			if err == io.EOF {
-				return tracks, nil
-			}
+		if err := payload.read("track header", binary.BigEndian, &header); err != nil {
 			return nil, err
 		}
 
-		// Usee the value of the header.length to extract
-		// the name of the track.
-		name := make([]byte, header.Length)
-		buffer.Read(name)
-
-		// Extract the measure steps which are the next 16 bytes.
-		var steps [16]byte
-		if err := binary.Read(buffer, binary.BigEndian, &steps); err != nil {
-			if err == io.EOF {
-				return tracks, nil
-			}
-			return nil, err
+		// Use the value of the header.length to extract
+		// the name of the track. The name is read as it arrives rather
+		// than allocated up front, so a bogus length can't claim more
+		// memory than the data holds.
+		offset := payload.offset()
+		field := fmt.Sprintf("track %d name", header.ID)
+		if limits.MaxNameLength > 0 && int64(header.Length) > int64(limits.MaxNameLength) {
+			return nil, &DecodeError{Offset: offset, Field: field, Err: fmt.Errorf(
+				"%w: %d bytes, at most %d are allowed", ErrLimit, header.Length, limits.MaxNameLength)}
+		}
+		if int64(header.Length) > payload.N {
+			return nil, &DecodeError{Offset: offset, Field: field, Err: ErrLengthMismatch}
+		}
+		var name bytes.Buffer
+		if n, _ := io.CopyN(&name, payload, int64(header.Length)); n != int64(header.Length) {
+			return nil, &DecodeError{Offset: offset, Field: field, Err: ErrTruncated}
+		}
+		if !utf8.Valid(name.Bytes()) {
+			return nil, &DecodeError{Offset: offset, Field: field, Err: ErrInvalidName}
 		}
 
+		// Extract the measure steps which are the next 16 bytes, or
+		// as many as the extended header declares.
 		track := Track{
 			ID:    header.ID,
-			Name:  string(name),
-			Steps: steps,
+			Name:  name.String(),
+			Steps: make([]byte, steps),
+		}
+		if err := payload.read(fmt.Sprintf("track %d steps", header.ID), binary.BigEndian, track.Steps); err != nil {
+			return nil, err
 		}
+
 		tracks = append(tracks, track)
 	}
+
+	return tracks, nil
 }
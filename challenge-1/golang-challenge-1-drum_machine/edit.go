@@ -0,0 +1,206 @@
+package drum
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf8"
+)
+
+var (
+	// ErrNoTrack is returned when an edit names a track ID which is not in
+	// the pattern.
+	ErrNoTrack = errors.New("drum: no track with that ID")
+
+	// ErrDuplicateTrack is returned when adding a track whose ID is
+	// already used by another track of the pattern.
+	ErrDuplicateTrack = errors.New("drum: track ID already in use")
+)
+
+// Clone returns a copy of the pattern which shares no memory with it.
+func (p Pattern) Clone() Pattern {
+	c := p
+	c.Tracks = nil
+	for _, t := range p.Tracks {
+		c.Tracks = append(c.Tracks, t.Clone())
+	}
+	c.Timing = p.Timing.Clone()
+	c.Metadata = cloneMetadata(p.Metadata)
+	c.Chunks = cloneChunks(p.Chunks)
+	if p.Trailing != nil {
+		c.Trailing = append([]byte(nil), p.Trailing...)
+	}
+	return c
+}
+
+// Clone returns a copy of the track which shares no memory with it.
+func (t Track) Clone() Track {
+	c := t
+	if t.Steps != nil {
+		c.Steps = append([]byte(nil), t.Steps...)
+	}
+	return c
+}
+
+// track returns the index of the track with the given ID.
+func (p *Pattern) track(id uint8) (int, error) {
+	for i := range p.Tracks {
+		if p.Tracks[i].ID == id {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %d", ErrNoTrack, id)
+}
+
+// SetStep sets the velocity of a step of the track, 0 to silence it or
+// StepOn for a plain hit.
+func (p *Pattern) SetStep(id uint8, step int, velocity uint8) error {
+	i, err := p.track(id)
+	if err != nil {
+		return err
+	}
+	if step < 0 || step >= len(p.Tracks[i].Steps) {
+		return fmt.Errorf("drum: step %d is out of range, track %d has %d steps",
+			step, id, len(p.Tracks[i].Steps))
+	}
+	p.Tracks[i].Steps[step] = velocity
+	return nil
+}
+
+// SetSteps replaces every step of the track, such as with the steps made
+// by Euclid. There must be as many steps as in the pattern.
+func (p *Pattern) SetSteps(id uint8, steps []byte) error {
+	i, err := p.track(id)
+	if err != nil {
+		return err
+	}
+	if len(steps) != p.steps() {
+		return fmt.Errorf("drum: %d steps given, the pattern has %d", len(steps), p.steps())
+	}
+	p.Tracks[i].Steps = append([]byte(nil), steps...)
+	return nil
+}
+
+// ToggleStep turns a silent step on with StepOn and any other step off.
+func (p *Pattern) ToggleStep(id uint8, step int) error {
+	i, err := p.track(id)
+	if err != nil {
+		return err
+	}
+	var v uint8
+	if p.Tracks[i].Velocity(step) == 0 {
+		v = StepOn
+	}
+	return p.SetStep(id, step, v)
+}
+
+// ClearTrack silences every step of the track.
+func (p *Pattern) ClearTrack(id uint8) error {
+	i, err := p.track(id)
+	if err != nil {
+		return err
+	}
+	for s := range p.Tracks[i].Steps {
+		p.Tracks[i].Steps[s] = 0
+	}
+	return nil
+}
+
+// AddTrack appends a track to the pattern. A track without steps gets a
+// silent step for each step of the pattern, otherwise it must have as many
+// steps as the pattern.
+func (p *Pattern) AddTrack(t Track) error {
+	if _, err := p.track(t.ID); err == nil {
+		return fmt.Errorf("%w: %d", ErrDuplicateTrack, t.ID)
+	}
+	if err := validName(t.Name); err != nil {
+		return err
+	}
+
+	t = t.Clone()
+	if t.Steps == nil {
+		t.Steps = make([]byte, p.steps())
+	}
+	if len(t.Steps) != p.steps() {
+		return fmt.Errorf("drum: track %d has %d steps, the pattern has %d", t.ID, len(t.Steps), p.steps())
+	}
+
+	p.Tracks = append(p.Tracks, t)
+	return nil
+}
+
+// RemoveTrack removes the track from the pattern.
+func (p *Pattern) RemoveTrack(id uint8) error {
+	i, err := p.track(id)
+	if err != nil {
+		return err
+	}
+	p.Tracks = append(p.Tracks[:i:i], p.Tracks[i+1:]...)
+	return nil
+}
+
+// MoveTrack moves the track to the given position in the pattern, the
+// other tracks keeping their order.
+func (p *Pattern) MoveTrack(id uint8, index int) error {
+	i, err := p.track(id)
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= len(p.Tracks) {
+		return fmt.Errorf("drum: position %d is out of range, the pattern has %d tracks", index, len(p.Tracks))
+	}
+
+	t := p.Tracks[i]
+	tracks := append(p.Tracks[:i:i], p.Tracks[i+1:]...)
+	tracks = append(tracks[:index:index], append([]Track{t}, tracks[index:]...)...)
+	p.Tracks = tracks
+	return nil
+}
+
+// RenameTrack changes the name of the track.
+func (p *Pattern) RenameTrack(id uint8, name string) error {
+	i, err := p.track(id)
+	if err != nil {
+		return err
+	}
+	if err := validName(name); err != nil {
+		return err
+	}
+	p.Tracks[i].Name = name
+	return nil
+}
+
+// SetTempo changes the tempo of the pattern which must be a positive
+// number.
+func (p *Pattern) SetTempo(tempo float32) error {
+	if !(tempo > 0) || math.IsInf(float64(tempo), 1) {
+		return fmt.Errorf("%w: %v", ErrInvalidTempo, tempo)
+	}
+	p.Header.Tempo = tempo
+	return nil
+}
+
+// SetVersion changes the hardware version of the pattern, which can't be
+// longer than 32 bytes.
+func (p *Pattern) SetVersion(version string) error {
+	var v [32]byte
+	if len(version) > len(v) {
+		return fmt.Errorf("drum: version %q is %d bytes, it can't be longer than %d",
+			version, len(version), len(v))
+	}
+	copy(v[:], version)
+	p.Header.Version = v
+	return nil
+}
+
+// validName checks that a track name can be decoded again: it must be
+// valid UTF-8 and no longer than the MaxNameLength of the DefaultLimits.
+func validName(name string) error {
+	if !utf8.ValidString(name) {
+		return ErrInvalidName
+	}
+	if max := DefaultLimits.MaxNameLength; max > 0 && len(name) > max {
+		return fmt.Errorf("%w: track name of %d bytes, at most %d are allowed", ErrLimit, len(name), max)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package drum
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestEdits(t *testing.T) {
+	p, err := DecodeFile(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+
+	edits := []Edit{
+		func(p *Pattern) error { return p.SetStep(0, 2, StepOn) },
+		func(p *Pattern) error { return p.ToggleStep(0, 0) },
+		func(p *Pattern) error { return p.SetStep(1, 15, AccentVelocity) },
+		func(p *Pattern) error { return p.ClearTrack(5) },
+		func(p *Pattern) error { return p.AddTrack(Track{ID: 9, Name: "clap"}) },
+		func(p *Pattern) error { return p.ToggleStep(9, 4) },
+		func(p *Pattern) error { return p.RemoveTrack(3) },
+		func(p *Pattern) error { return p.MoveTrack(9, 0) },
+		func(p *Pattern) error { return p.RenameTrack(1, "rim") },
+		func(p *Pattern) error { return p.SetTempo(133.5) },
+		func(p *Pattern) error { return p.SetVersion("0.909") },
+	}
+	for i, edit := range edits {
+		if err := edit(&p); err != nil {
+			t.Fatalf("edit %d failed - %v", i, err)
+		}
+	}
+
+	expected := `Saved with HW Version: 0.909
+Tempo: 133.5
+(9) clap	|----|x---|----|----|
+(0) kick	|--x-|----|x---|----|
+(1) rim	|----|x---|----|x--X|
+(5) cowbell	|----|----|----|----|
+`
+	if p.String() != expected {
+		t.Fatalf("pattern wasn't edited as expected.\nGot:\n%s\nExpected:\n%s", p, expected)
+	}
+}
+
+func TestEditErrors(t *testing.T) {
+	p, err := DecodeFile(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	before := p.String()
+
+	tData := []struct {
+		edit Edit
+		err  error
+		msg  string
+	}{
+		{func(p *Pattern) error { return p.SetStep(4, 0, StepOn) }, ErrNoTrack, ""},
+		{func(p *Pattern) error { return p.SetStep(0, 16, StepOn) }, nil, "out of range"},
+		{func(p *Pattern) error { return p.ClearTrack(2) }, ErrNoTrack, ""},
+		{func(p *Pattern) error { return p.SetSteps(0, make([]byte, 8)) }, nil, "8 steps"},
+		{func(p *Pattern) error { return p.AddTrack(Track{ID: 3, Name: "clap"}) }, ErrDuplicateTrack, ""},
+		{func(p *Pattern) error { return p.AddTrack(Track{ID: 7, Name: "clap", Steps: make([]byte, 8)}) }, nil, "8 steps"},
+		{func(p *Pattern) error { return p.RemoveTrack(2) }, ErrNoTrack, ""},
+		{func(p *Pattern) error { return p.MoveTrack(0, 4) }, nil, "out of range"},
+		{func(p *Pattern) error { return p.SetTempo(0) }, ErrInvalidTempo, ""},
+		{func(p *Pattern) error { return p.SetTempo(-120) }, ErrInvalidTempo, ""},
+		{func(p *Pattern) error { return p.SetVersion(strings.Repeat("9", 33)) }, nil, "longer than 32"},
+		{func(p *Pattern) error { return p.AddTrack(Track{ID: 7, Name: strings.Repeat("a", 2000)}) }, ErrLimit, ""},
+		{func(p *Pattern) error { return p.RenameTrack(0, "\xff") }, ErrInvalidName, ""},
+	}
+
+	for i, exp := range tData {
+		err := exp.edit(&p)
+		if err == nil {
+			t.Fatalf("edit %d: expected an error", i)
+		}
+		if exp.err != nil && !errors.Is(err, exp.err) {
+			t.Fatalf("edit %d: expected %v, got %v", i, exp.err, err)
+		}
+		if !strings.Contains(err.Error(), exp.msg) {
+			t.Fatalf("edit %d: expected an error containing %q, got %v", i, exp.msg, err)
+		}
+	}
+
+	if p.String() != before {
+		t.Fatalf("failed edits changed the pattern.\nGot:\n%s\nExpected:\n%s", p, before)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	p, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	original := p.String()
+
+	h := NewHistory(p)
+	if h.CanUndo() || h.Undo() {
+		t.Fatal("expected nothing to undo")
+	}
+
+	if err := h.Apply(func(p *Pattern) error { return p.SetTempo(90) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Apply(func(p *Pattern) error { return p.RemoveTrack(5) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Apply(func(p *Pattern) error { return p.RemoveTrack(5) }); err == nil {
+		t.Fatal("expected removing a missing track to fail")
+	}
+	edited := h.Pattern().String()
+
+	// Changing the returned pattern doesn't change the history.
+	returned := h.Pattern()
+	returned.Tracks[0].Steps[1] = StepOn
+	if h.Pattern().String() != edited {
+		t.Fatal("the history shares memory with the returned pattern")
+	}
+
+	if !h.Undo() || !h.Undo() {
+		t.Fatal("expected two edits to undo")
+	}
+	if h.Undo() {
+		t.Fatal("the failed edit was recorded")
+	}
+	if h.Pattern().String() != original {
+		t.Fatalf("undo didn't restore the pattern.\nGot:\n%s\nExpected:\n%s", h.Pattern(), original)
+	}
+
+	if !h.Redo() || !h.Redo() || h.CanRedo() {
+		t.Fatal("expected two edits to redo")
+	}
+	if h.Pattern().String() != edited {
+		t.Fatalf("redo didn't restore the edits.\nGot:\n%s\nExpected:\n%s", h.Pattern(), edited)
+	}
+
+	// A new edit forgets what was undone.
+	h.Undo()
+	if err := h.Apply(func(p *Pattern) error { return p.SetTempo(100) }); err != nil {
+		t.Fatal(err)
+	}
+	if h.CanRedo() {
+		t.Fatal("expected nothing to redo after a new edit")
+	}
+
+	h = NewHistory(p)
+	h.Limit = 2
+	for i := 0; i < 5; i++ {
+		tempo := float32(100 + i)
+		if err := h.Apply(func(p *Pattern) error { return p.SetTempo(tempo) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	undone := 0
+	for h.Undo() {
+		undone++
+	}
+	if undone != 2 || h.Pattern().Header.Tempo != 102 {
+		t.Fatalf("expected 2 edits undone back to 102, got %d back to %v", undone, h.Pattern().Header.Tempo)
+	}
+}
@@ -0,0 +1,183 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+const (
+	// spliceMagic is the identifier found at the start of every .splice
+	// file saved by the hardware.
+	spliceMagic = "SPLICE"
+
+	// extendedMagic identifies files in the extended format which adds
+	// the step count to the header and allows for velocities.
+	extendedMagic = "SPLICX"
+)
+
+// Encode writes the pattern to w in the .splice binary format, in the
+// version of the container format given by Pattern.Format. Patterns the
+// hardware can't represent, those which don't have 16 steps of 16th notes
+// or have velocities, are written in the extended format. The timing of
+// patterns which don't play straight follows in an extension chunk.
+func Encode(w io.Writer, p Pattern) error {
+	return EncodeFormat(w, p, p.Format())
+}
+
+// EncodeFormat writes the pattern to w in the given version of the
+// container format, FormatV1 or FormatV2. The metadata and chunks of a
+// pattern can't be written in FormatV1.
+func EncodeFormat(w io.Writer, p Pattern, version int) error {
+	steps := p.Header.steps()
+	for _, t := range p.Tracks {
+		if len(t.Steps) != steps {
+			return fmt.Errorf("drum: track %d has %d steps, the pattern has %d", t.ID, len(t.Steps), steps)
+		}
+	}
+	if steps > math.MaxUint16 || p.Header.stepsPerBeat() > math.MaxUint8 {
+		return fmt.Errorf("drum: grid of %d steps at %d per beat is too large", steps, p.Header.stepsPerBeat())
+	}
+	if !p.Timing.IsZero() {
+		if err := p.Timing.Validate(); err != nil {
+			return err
+		}
+	}
+
+	var magic string
+	var payload, extensions bytes.Buffer
+	switch version {
+	case FormatV1:
+		if p.chunked() {
+			return fmt.Errorf("drum: metadata and chunks can't be written in format %d", FormatV1)
+		}
+		magic = spliceMagic
+		if p.extended() {
+			magic = extendedMagic
+		}
+
+		// Encode the header section of the data.
+		if err := encodeHeader(&payload, p.Header, magic == extendedMagic); err != nil {
+			return fmt.Errorf("encodeHeader failed: %v", err)
+		}
+
+		// Encode the track section of the data.
+		if err := encodeTracks(&payload, p.Tracks); err != nil {
+			return fmt.Errorf("encodeTracks failed: %v", err)
+		}
+
+		// The timing follows the payload in an extension chunk.
+		if !p.Timing.IsZero() {
+			if err := encodeExtension(&extensions, timingChunk, p.Timing.encode()); err != nil {
+				return err
+			}
+		}
+	case FormatV2:
+		magic = chunkedMagic
+		if err := encodeChunks(&payload, p); err != nil {
+			return fmt.Errorf("encodeChunks failed: %v", err)
+		}
+	default:
+		return fmt.Errorf("drum: unknown format version %d", version)
+	}
+
+	// The format block is the magic followed by the length of the
+	// payload which comes after it.
+	var format struct {
+		Magic  [6]byte
+		Length uint64
+	}
+	copy(format.Magic[:], magic)
+	format.Length = uint64(payload.Len())
+	if err := binary.Write(w, binary.BigEndian, format); err != nil {
+		return err
+	}
+
+	if _, err := payload.WriteTo(w); err != nil {
+		return err
+	}
+	_, err := extensions.WriteTo(w)
+	return err
+}
+
+// EncodeFile encodes the pattern and writes it to the file found at the
+// provided path, creating or truncating it as needed.
+func EncodeFile(path string, p Pattern) error {
+	fd, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("os.Create failed for file: %s. Error: %v", path, err)
+	}
+
+	if err := Encode(fd, p); err != nil {
+		fd.Close()
+		return err
+	}
+
+	return fd.Close()
+}
+
+// encodeHeader encodes the version and tempo of the Header struct, and
+// the step count for the extended format.
+func encodeHeader(buffer *bytes.Buffer, h Header, extended bool) error {
+	if err := binary.Write(buffer, binary.BigEndian, h.Version); err != nil {
+		return err
+	}
+
+	// The tempo is the only little endian value in the file.
+	if err := binary.Write(buffer, binary.LittleEndian, h.Tempo); err != nil {
+		return err
+	}
+
+	if !extended {
+		return nil
+	}
+	grid := struct {
+		Steps        uint16
+		StepsPerBeat uint8
+	}{
+		Steps:        uint16(h.steps()),
+		StepsPerBeat: uint8(h.stepsPerBeat()),
+	}
+	return binary.Write(buffer, binary.BigEndian, grid)
+}
+
+// encodeTracks encodes each track one after another.
+func encodeTracks(buffer *bytes.Buffer, tracks []Track) error {
+	for _, t := range tracks {
+		header := struct {
+			ID     uint8
+			Length uint32
+		}{
+			ID:     t.ID,
+			Length: uint32(len(t.Name)),
+		}
+		if err := binary.Write(buffer, binary.BigEndian, header); err != nil {
+			return err
+		}
+
+		buffer.WriteString(t.Name)
+
+		if err := binary.Write(buffer, binary.BigEndian, t.Steps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extended reports whether the pattern needs the extended format.
+func (p Pattern) extended() bool {
+	if p.Header.steps() != defaultSteps || p.Header.stepsPerBeat() != defaultStepsPerBeat {
+		return true
+	}
+	for _, t := range p.Tracks {
+		for _, v := range t.Steps {
+			if v > StepOn {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestEncodeRoundTrip(t *testing.T) {
+	files := []string{
+		"pattern_1.splice",
+		"pattern_2.splice",
+		"pattern_3.splice",
+		"pattern_4.splice",
+		"pattern_5.splice",
+		"pattern_6.splice",
+	}
+
+	for _, f := range files {
+		original, err := ioutil.ReadFile(path.Join("fixtures", f))
+		if err != nil {
+			t.Fatalf("reading %s failed - %v", f, err)
+		}
+
+		decoded, err := DecodeFile(path.Join("fixtures", f))
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", f, err)
+		}
+
+		var buf bytes.Buffer
+		if err := Encode(&buf, decoded); err != nil {
+			t.Fatalf("something went wrong encoding %s - %v", f, err)
+		}
+
+		// Only the declared payload is expected to round trip, anything
+		// after it is not part of the pattern.
+		length := binary.BigEndian.Uint64(original[6:14])
+		expected := original[:14+length]
+		if !bytes.Equal(buf.Bytes(), expected) {
+			t.Fatalf("%s wasn't encoded as expected.\nGot:\n%x\nExpected:\n%x",
+				f, buf.Bytes(), expected)
+		}
+	}
+}
+
+func TestEncodeFile(t *testing.T) {
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "drum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := path.Join(dir, "pattern_1.splice")
+	if err := EncodeFile(out, decoded); err != nil {
+		t.Fatalf("something went wrong encoding - %v", err)
+	}
+
+	reread, err := DecodeFile(out)
+	if err != nil {
+		t.Fatalf("something went wrong decoding %s - %v", out, err)
+	}
+	if reread.String() != decoded.String() {
+		t.Fatalf("pattern changed after EncodeFile.\nGot:\n%s\nExpected:\n%s",
+			reread, decoded)
+	}
+}
+
+func TestEncodeExtended(t *testing.T) {
+	p := Pattern{
+		Header: Header{Tempo: 96, Steps: 12, StepsPerBeat: 3},
+		Tracks: []Track{
+			{ID: 0, Name: "kick", Steps: []byte{255, 0, 0, 1, 0, 0, 255, 0, 0, 1, 0, 0}},
+			{ID: 1, Name: "ride", Steps: []byte{1, 0, 90, 1, 0, 90, 1, 0, 90, 1, 0, 90}},
+		},
+	}
+	copy(p.Header.Version[:], "0.909")
+
+	expected := `Saved with HW Version: 0.909
+Tempo: 96
+Steps: 12 (3 per beat)
+(0) kick	|X--|x--|X--|x--|
+(1) ride	|x-x|x-x|x-x|x-x|
+`
+	if p.String() != expected {
+		t.Fatalf("extended pattern wasn't formatted as expected.\nGot:\n%s\nExpected:\n%s", p, expected)
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, p); err != nil {
+		t.Fatalf("something went wrong encoding - %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte(extendedMagic)) {
+		t.Fatalf("expected the extended format, got %q", buf.Bytes()[:6])
+	}
+
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	if decoded.Header.Steps != 12 || decoded.Header.StepsPerBeat != 3 {
+		t.Fatalf("grid wasn't decoded, got %d steps at %d per beat",
+			decoded.Header.Steps, decoded.Header.StepsPerBeat)
+	}
+	for i := range p.Tracks {
+		if !bytes.Equal(decoded.Tracks[i].Steps, p.Tracks[i].Steps) {
+			t.Fatalf("track %d: expected velocities %v, got %v", i, p.Tracks[i].Steps, decoded.Tracks[i].Steps)
+		}
+	}
+
+	parsed, err := ParsePattern(expected)
+	if err != nil {
+		t.Fatalf("something went wrong parsing - %v", err)
+	}
+	if parsed.String() != expected {
+		t.Fatalf("extended pattern wasn't parsed as expected.\nGot:\n%s\nExpected:\n%s", parsed, expected)
+	}
+
+	// A track which doesn't match the step count can't be encoded.
+	p.Tracks[1].Steps = p.Tracks[1].Steps[:11]
+	if err := Encode(&buf, p); err == nil {
+		t.Fatal("expected an error for a track with the wrong number of steps")
+	}
+}
+
+func TestEncodeLegacyWithAccents(t *testing.T) {
+	p, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+
+	// An accent needs the extended format even on a 16 step grid.
+	p.Tracks[0].Steps[0] = AccentVelocity
+	var buf bytes.Buffer
+	if err := Encode(&buf, p); err != nil {
+		t.Fatalf("something went wrong encoding - %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte(extendedMagic)) {
+		t.Fatalf("expected the extended format, got %q", buf.Bytes()[:6])
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	if got := decoded.Tracks[0].String(); got != "(0) kick\t|X---|x---|x---|x---|\n" {
+		t.Fatalf("unexpected track: %q", got)
+	}
+}
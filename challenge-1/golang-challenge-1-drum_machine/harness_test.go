@@ -0,0 +1,284 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+// generatedVersions are the hardware versions given to generated patterns.
+var generatedVersions = []string{"", "0.708-alpha", "0.808-alpha", "0.909"}
+
+// nameRunes are the runes of generated track names, which the text form
+// can hold.
+var nameRunes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.é")
+
+// Generate implements the quick.Generator interface for Pattern. The
+// patterns follow the rules of their hardware version so they can be
+// encoded and decoded back, and have no trailing data.
+func (Pattern) Generate(rng *rand.Rand, size int) reflect.Value {
+	var p Pattern
+	version := generatedVersions[rng.Intn(len(generatedVersions))]
+	copy(p.Header.Version[:], version)
+
+	rules, _ := DefaultRegistry.Lookup(version)
+	min, max := rules.MinTempo, rules.MaxTempo
+	if min < 1 {
+		min = 1
+	}
+	if max > 1000 {
+		max = 1000
+	}
+	p.Header.Tempo = min + rng.Float32()*(max-min)
+
+	// Half of the patterns keep the grid of the hardware.
+	if rng.Intn(2) == 0 {
+		p.Header.StepsPerBeat = 1 + rng.Intn(8)
+		p.Header.Steps = p.Header.StepsPerBeat * (1 + rng.Intn(8))
+	}
+
+	// Half of the patterns only use the velocities of the text form.
+	velocities := rng.Intn(2) == 0
+
+	tracks := rng.Intn(size%16 + 1)
+	ids := rng.Perm(int(rules.MaxTrackID) + 1)
+	for i := 0; i < tracks && i < len(ids); i++ {
+		t := Track{
+			ID:    uint8(ids[i]),
+			Name:  generateName(rng),
+			Steps: make([]byte, p.Header.steps()),
+		}
+		if len(rules.Instruments) > 0 {
+			t.Name = rules.Instruments[rng.Intn(len(rules.Instruments))]
+		}
+		for s := range t.Steps {
+			switch rng.Intn(4) {
+			case 0:
+				t.Steps[s] = StepOn
+			case 1:
+				t.Steps[s] = AccentVelocity
+				if velocities {
+					t.Steps[s] = byte(1 + rng.Intn(255))
+				}
+			}
+		}
+		p.Tracks = append(p.Tracks, t)
+	}
+
+	// A quarter of the patterns swing, and a quarter have step offsets.
+	if rng.Intn(4) == 0 {
+		p.Timing.Swing = MinSwing + rng.Float32()*(MaxSwing-MinSwing)
+	}
+	if rng.Intn(4) == 0 {
+		p.Timing.Offsets = make([]float32, rng.Intn(p.Header.steps()+1))
+		for s := range p.Timing.Offsets {
+			p.Timing.Offsets[s] = (rng.Float32() - 0.5) * 2 * MaxOffset
+		}
+	}
+
+	// A quarter of the patterns have metadata and a chunk unknown to the
+	// package, which only the chunked format holds.
+	if rng.Intn(4) == 0 {
+		p.Metadata = map[string]string{"author": generateName(rng)}
+		data := make([]byte, 1+rng.Intn(8))
+		rng.Read(data)
+		p.Chunks = []Chunk{{ID: "cues", Data: data}}
+	}
+
+	return reflect.ValueOf(p)
+}
+
+// generateName returns a track name of one or two words.
+func generateName(rng *rand.Rand) string {
+	words := make([]string, 1+rng.Intn(2))
+	for i := range words {
+		w := make([]rune, 1+rng.Intn(8))
+		for j := range w {
+			w[j] = nameRunes[rng.Intn(len(nameRunes))]
+		}
+		words[i] = string(w)
+	}
+	return strings.Join(words, " ")
+}
+
+// normalize returns the pattern with the default grid, no tracks, a
+// straight timing and the source format left zero, so patterns which only
+// differ in how they say so compare equal.
+func normalize(p Pattern) Pattern {
+	p = p.Clone()
+	if p.Header.steps() == defaultSteps && p.Header.stepsPerBeat() == defaultStepsPerBeat {
+		p.Header.Steps, p.Header.StepsPerBeat = 0, 0
+	}
+	if len(p.Tracks) == 0 {
+		p.Tracks = nil
+	}
+	if p.Timing.IsZero() {
+		p.Timing = Timing{}
+	}
+	p.SourceFormat = 0
+	return p
+}
+
+func TestPropertyRoundTrip(t *testing.T) {
+	config := &quick.Config{MaxCount: 500}
+
+	tData := []struct {
+		name     string
+		property func(p Pattern) bool
+	}{
+		{"generated patterns are valid", func(p Pattern) bool {
+			return DefaultRegistry.Validate(p) == nil
+		}},
+		{"encode then decode", func(p Pattern) bool {
+			var buf bytes.Buffer
+			if err := Encode(&buf, p); err != nil {
+				t.Logf("something went wrong encoding - %v", err)
+				return false
+			}
+			decoded, err := Decode(&buf)
+			if err != nil {
+				t.Logf("something went wrong decoding - %v", err)
+				return false
+			}
+			return reflect.DeepEqual(normalize(decoded), normalize(p))
+		}},
+		{"JSON", func(p Pattern) bool {
+			b, err := json.Marshal(p)
+			if err != nil {
+				t.Logf("something went wrong marshaling - %v", err)
+				return false
+			}
+			var decoded Pattern
+			if err := json.Unmarshal(b, &decoded); err != nil {
+				t.Logf("something went wrong unmarshaling - %v", err)
+				return false
+			}
+			return reflect.DeepEqual(normalize(decoded), normalize(p))
+		}},
+
+		// The text form rounds the tempo and velocities, so it is the
+		// printed pattern which must survive parsing.
+		{"text", func(p Pattern) bool {
+			parsed, err := ParsePattern(p.String())
+			if err != nil {
+				t.Logf("something went wrong parsing - %v", err)
+				return false
+			}
+			return parsed.String() == p.String()
+		}},
+		{"no changes", func(p Pattern) bool {
+			return Diff(p, p.Clone()).Empty()
+		}},
+	}
+
+	for _, exp := range tData {
+		if err := quick.Check(exp.property, config); err != nil {
+			t.Fatalf("%s: %v", exp.name, err)
+		}
+	}
+}
+
+// TestGolden compares every fixture with the text form in the .txt file
+// next to it. Run the tests with -update to write the golden files after
+// changing the format.
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("fixtures", "*.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no fixtures found")
+	}
+
+	for _, file := range files {
+		p, err := DecodeFile(file)
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", file, err)
+		}
+
+		golden := strings.TrimSuffix(file, ".splice") + ".txt"
+		if *update {
+			if err := ioutil.WriteFile(golden, []byte(p.String()), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := ioutil.ReadFile(golden)
+		if os.IsNotExist(err) {
+			t.Fatalf("%s has no golden file, run the tests with -update to write it", file)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.String() != string(want) {
+			t.Fatalf("%s doesn't match %s.\nGot:\n%s\nExpected:\n%s", file, golden, p, want)
+		}
+
+		// The golden file is a pattern in the text form of its own.
+		parsed, err := ParsePattern(string(want))
+		if err != nil {
+			t.Fatalf("something went wrong parsing %s - %v", golden, err)
+		}
+		if parsed.String() != string(want) {
+			t.Fatalf("%s changed parsing it.\nGot:\n%s\nExpected:\n%s", golden, parsed, want)
+		}
+	}
+}
+
+// TestMalformed decodes every file of the malformed corpus, each of which
+// must fail with its expected error, either decoding or checking it against
+// the DefaultRegistry. New files need an entry in the table.
+func TestMalformed(t *testing.T) {
+	tData := []struct {
+		file string
+		err  error
+	}{
+		{"empty.splice", ErrBadMagic},
+		{"bad_magic.splice", ErrBadMagic},
+		{"no_length.splice", ErrTruncated},
+		{"truncated.splice", ErrTruncated},
+		{"declared_too_long.splice", ErrTruncated},
+		{"header_too_short.splice", ErrLengthMismatch},
+		{"cuts_into_track.splice", ErrLengthMismatch},
+		{"zero_grid.splice", ErrLengthMismatch},
+		{"huge_length.splice", ErrLimit},
+		{"huge_name.splice", ErrLimit},
+		{"invalid_name.splice", ErrInvalidName},
+		{"unknown_version.splice", ErrUnsupportedVersion},
+		{"tempo_999.splice", ErrTempoRange},
+		{"track_id.splice", ErrVersionRules},
+		{"unexpected_trailing.splice", ErrVersionRules},
+		{"swing_90.splice", ErrInvalidTiming},
+		{"truncated_extension.splice", ErrTruncated},
+		{"future_format.splice", ErrUnsupportedFormat},
+		{"no_header_chunk.splice", ErrBadChunk},
+		{"critical_chunk.splice", ErrBadChunk},
+		{"chunk_too_long.splice", ErrLengthMismatch},
+	}
+
+	dir := filepath.Join("fixtures", "malformed")
+	files, err := filepath.Glob(filepath.Join(dir, "*.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(tData) {
+		t.Fatalf("expected %d malformed files, found %d: %v", len(tData), len(files), files)
+	}
+
+	for _, exp := range tData {
+		_, err := DecodeFileWith(filepath.Join(dir, exp.file), DefaultRegistry)
+		if os.IsNotExist(err) {
+			t.Fatalf("%s is missing from the malformed corpus", exp.file)
+		}
+		if !errors.Is(err, exp.err) {
+			t.Fatalf("%s: expected %v, got %v", exp.file, exp.err, err)
+		}
+	}
+}
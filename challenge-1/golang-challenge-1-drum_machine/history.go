@@ -0,0 +1,80 @@
+package drum
+
+// Edit is a change made to a pattern, such as a call to one of its editing
+// methods.
+type Edit func(p *Pattern) error
+
+// History records the edits made to a pattern so they can be undone and
+// redone.
+type History struct {
+
+	// Limit is the number of edits which can be undone, zero keeps every
+	// edit.
+	Limit int
+
+	current Pattern
+	undo    []Pattern
+	redo    []Pattern
+}
+
+// NewHistory is a factory function for History.
+func NewHistory(p Pattern) *History {
+	return &History{current: p.Clone()}
+}
+
+// Pattern returns a copy of the pattern with every edit applied.
+func (h *History) Pattern() Pattern {
+	return h.current.Clone()
+}
+
+// Apply applies the edit to the pattern. A failed edit leaves the pattern
+// and the history as they were. Applying an edit forgets the edits which
+// were undone.
+func (h *History) Apply(edit Edit) error {
+	next := h.current.Clone()
+	if err := edit(&next); err != nil {
+		return err
+	}
+
+	h.undo = append(h.undo, h.current)
+	if h.Limit > 0 && len(h.undo) > h.Limit {
+		h.undo = h.undo[len(h.undo)-h.Limit:]
+	}
+	h.redo = nil
+	h.current = next
+	return nil
+}
+
+// Undo reverts the last edit applied. It reports false if there is
+// nothing to undo.
+func (h *History) Undo() bool {
+	if len(h.undo) == 0 {
+		return false
+	}
+	h.redo = append(h.redo, h.current)
+	h.current = h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+	return true
+}
+
+// Redo applies the last edit undone again. It reports false if there is
+// nothing to redo.
+func (h *History) Redo() bool {
+	if len(h.redo) == 0 {
+		return false
+	}
+	h.undo = append(h.undo, h.current)
+	h.current = h.redo[len(h.redo)-1]
+	h.redo = h.redo[:len(h.redo)-1]
+	return true
+}
+
+// CanUndo reports whether there is an edit to undo.
+func (h *History) CanUndo() bool {
+	return len(h.undo) > 0
+}
+
+// CanRedo reports whether there is an edit to redo.
+func (h *History) CanRedo() bool {
+	return len(h.redo) > 0
+}
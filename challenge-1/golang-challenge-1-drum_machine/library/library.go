@@ -0,0 +1,305 @@
+// Package library indexes directories of .splice drum pattern files so
+// patterns can be searched by their header, their tracks and their rhythm.
+package library
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	drum "github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine"
+)
+
+// indexFormat is the version of the index file format.
+const indexFormat = 1
+
+// resolution is the number of slots rhythms are spread over before being
+// compared, which fits grids of 3, 4, 6, 8, 12, 16, 24, 32, 48 and 64
+// steps exactly.
+const resolution = 192
+
+// Entry is what the index knows about a pattern file.
+type Entry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+
+	Version string      `json:"version"`
+	Tempo   float32     `json:"tempo"`
+	Steps   int         `json:"steps"`
+	Tracks  []TrackInfo `json:"tracks"`
+
+	// Density is the share of the steps of every track which play.
+	Density float64 `json:"density"`
+
+	// Hash identifies the steps of the pattern, patterns playing the same
+	// steps on the same track IDs having the same hash whatever their
+	// names and tempo.
+	Hash string `json:"hash"`
+
+	// Onsets holds the number of tracks playing on each step.
+	Onsets []int `json:"onsets"`
+}
+
+// TrackInfo is what the index knows about a track.
+type TrackInfo struct {
+	ID   uint8  `json:"id"`
+	Name string `json:"name"`
+	Hits int    `json:"hits"`
+}
+
+// NewEntry describes the pattern read from path.
+func NewEntry(path string, p drum.Pattern) Entry {
+	a := drum.Analyze(p)
+	e := Entry{
+		Path:    path,
+		Version: string(bytes.Trim(p.Header.Version[:], "\x00")),
+		Tempo:   p.Header.Tempo,
+		Steps:   a.Steps,
+		Density: a.Density,
+		Onsets:  a.Onsets,
+	}
+
+	h := sha256.New()
+	for i, t := range p.Tracks {
+		e.Tracks = append(e.Tracks, TrackInfo{ID: t.ID, Name: t.Name, Hits: a.Tracks[i].Hits})
+		fmt.Fprintf(h, "%d:", t.ID)
+		for s := range t.Steps {
+			h.Write([]byte{t.Velocity(s)})
+		}
+	}
+	e.Hash = hex.EncodeToString(h.Sum(nil)[:16])
+
+	return e
+}
+
+// HasTrack reports whether the pattern has a track with the name, ignoring
+// case.
+func (e Entry) HasTrack(name string) bool {
+	for _, t := range e.Tracks {
+		if strings.EqualFold(t.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Failure is a file which couldn't be indexed.
+type Failure struct {
+	Path string `json:"path"`
+	Err  string `json:"error"`
+}
+
+// Index is the list of patterns found under a set of directories.
+type Index struct {
+	Entries  []Entry   `json:"entries"`
+	Failures []Failure `json:"failures,omitempty"`
+}
+
+// Options configures Build.
+type Options struct {
+
+	// Workers is the number of files decoded at the same time, the
+	// number of CPUs when zero.
+	Workers int
+
+	// Previous is an index built earlier, whose entries are reused for
+	// files which haven't changed size or modification time since.
+	Previous *Index
+
+	// Registry checks each pattern against the rules of its hardware
+	// version, those which break them are failures. Patterns aren't
+	// checked when it is nil.
+	Registry *drum.Registry
+}
+
+// Build walks the directories and indexes every .splice file found in them.
+// Files which can't be decoded, and files or directories which can't be
+// read, are listed in the failures of the index rather than stopping it.
+func Build(roots []string, opts Options) *Index {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	previous := map[string]Entry{}
+	if opts.Previous != nil {
+		for _, e := range opts.Previous.Entries {
+			previous[e.Path] = e
+		}
+	}
+
+	type file struct {
+		path string
+		info os.FileInfo
+	}
+	ix := &Index{}
+	var mu sync.Mutex
+
+	// A file or directory which can't be read is a failure, the walk goes
+	// on with the others.
+	files := make(chan file)
+	go func() {
+		defer close(files)
+		for _, root := range roots {
+			filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					mu.Lock()
+					ix.Failures = append(ix.Failures, Failure{Path: path, Err: err.Error()})
+					mu.Unlock()
+					return nil
+				}
+				if !info.IsDir() && strings.EqualFold(filepath.Ext(path), ".splice") {
+					files <- file{path, info}
+				}
+				return nil
+			})
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range files {
+				e, ok := previous[f.path]
+				if !ok || e.Size != f.info.Size() || !e.ModTime.Equal(f.info.ModTime()) {
+					p, err := drum.DecodeFileWith(f.path, opts.Registry)
+					if err != nil {
+						mu.Lock()
+						ix.Failures = append(ix.Failures, Failure{Path: f.path, Err: err.Error()})
+						mu.Unlock()
+						continue
+					}
+					e = NewEntry(f.path, p)
+					e.Size = f.info.Size()
+					e.ModTime = f.info.ModTime()
+				}
+				mu.Lock()
+				ix.Entries = append(ix.Entries, e)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(ix.Entries, func(i, j int) bool { return ix.Entries[i].Path < ix.Entries[j].Path })
+	sort.Slice(ix.Failures, func(i, j int) bool { return ix.Failures[i].Path < ix.Failures[j].Path })
+	return ix
+}
+
+// indexFile is the layout of the index file.
+type indexFile struct {
+	Format int `json:"format"`
+	*Index
+}
+
+// Load reads an index saved with Save.
+func Load(path string) (*Index, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := indexFile{Index: &Index{}}
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("library: reading index %s failed: %v", path, err)
+	}
+	if f.Format != indexFormat {
+		return nil, fmt.Errorf("library: index %s has format %d, expected %d", path, f.Format, indexFormat)
+	}
+	return f.Index, nil
+}
+
+// Save writes the index to path.
+func (ix *Index) Save(path string) error {
+	b, err := json.Marshal(indexFile{Format: indexFormat, Index: ix})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// Lookup returns the entry of the file at path.
+func (ix *Index) Lookup(path string) (Entry, bool) {
+	for _, e := range ix.Entries {
+		if e.Path == path {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Search returns the entries matching the query, in the order of the index.
+func (ix *Index) Search(q Query) []Entry {
+	var found []Entry
+	for _, e := range ix.Entries {
+		if q.Match(e) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// Match is an entry found by Similar.
+type Match struct {
+	Entry
+
+	// Score is the similarity of the rhythms, from 0 for rhythms with no
+	// step in common to 1 for the same rhythm.
+	Score float64
+}
+
+// Similar returns up to n entries whose rhythm is the closest to the
+// target's, the closest first. The target itself is left out.
+func (ix *Index) Similar(target Entry, n int) []Match {
+	a := spread(target.Onsets)
+	var matches []Match
+	for _, e := range ix.Entries {
+		if e.Path == target.Path && target.Path != "" {
+			continue
+		}
+		matches = append(matches, Match{Entry: e, Score: cosine(a, spread(e.Onsets))})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if n >= 0 && len(matches) > n {
+		matches = matches[:n]
+	}
+	return matches
+}
+
+// spread places the onsets of a bar on the slots of the common resolution
+// so bars of different step counts can be compared.
+func spread(onsets []int) []float64 {
+	v := make([]float64, resolution)
+	for s, n := range onsets {
+		v[s*resolution/len(onsets)] += float64(n)
+	}
+	return v
+}
+
+// cosine returns the cosine similarity of two vectors, 0 if either is
+// silent.
+func cosine(a, b []float64) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
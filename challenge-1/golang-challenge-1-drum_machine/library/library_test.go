@@ -0,0 +1,171 @@
+package library
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	drum "github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine"
+)
+
+const fixtures = "../fixtures"
+
+// failures returns the failures of the index, leaving out the malformed
+// corpus of the fixtures which is expected to fail.
+func failures(ix *Index) []Failure {
+	var fs []Failure
+	malformed := filepath.Join(fixtures, "malformed") + string(filepath.Separator)
+	for _, f := range ix.Failures {
+		if !strings.HasPrefix(f.Path, malformed) {
+			fs = append(fs, f)
+		}
+	}
+	return fs
+}
+
+func TestBuildAndSearch(t *testing.T) {
+	ix := Build([]string{fixtures}, Options{Workers: 3, Registry: drum.DefaultRegistry})
+	malformed, err := filepath.Glob(filepath.Join(fixtures, "malformed", "*.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ix.Entries) != 6 || len(ix.Failures) != len(malformed) || len(failures(ix)) != 0 {
+		t.Fatalf("expected 6 entries and only the malformed files to fail, got %d and %v",
+			len(ix.Entries), ix.Failures)
+	}
+
+	// Without a registry the files breaking the rules of their version
+	// are indexed too.
+	all := Build([]string{fixtures}, Options{})
+	if _, ok := all.Lookup(filepath.Join(fixtures, "malformed", "tempo_999.splice")); !ok {
+		t.Fatalf("expected tempo_999.splice to be indexed without a registry, got %v", all.Failures)
+	}
+
+	e, ok := ix.Lookup(filepath.Join(fixtures, "pattern_2.splice"))
+	if !ok {
+		t.Fatalf("pattern_2.splice wasn't indexed")
+	}
+	if e.Version != "0.808-alpha" || e.Steps != 16 || len(e.Tracks) != 4 || e.Tracks[2].Hits != 5 {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+	if e.Density != 10.0/64 {
+		t.Fatalf("expected a density of %v, got %v", 10.0/64, e.Density)
+	}
+
+	tData := []struct {
+		query string
+		exp   []string
+	}{
+		{"tempo:110-125 track:cowbell", []string{"pattern_1.splice"}},
+		{"tempo:110-125", []string{"pattern_1.splice", "pattern_3.splice", "pattern_6.splice"}},
+		{"tempo:200-", []string{"pattern_4.splice", "pattern_5.splice"}},
+		{`track:"low conga"`, []string{"pattern_4.splice"}},
+		{"version:0.808-alpha track:kick track:snare", []string{"pattern_1.splice", "pattern_2.splice"}},
+		{"hash:" + e.Hash, []string{"pattern_2.splice"}},
+	}
+
+	for _, exp := range tData {
+		q, err := ParseQuery(exp.query)
+		if err != nil {
+			t.Fatalf("%s: something went wrong parsing - %v", exp.query, err)
+		}
+		var got []string
+		for _, e := range ix.Search(q) {
+			got = append(got, filepath.Base(e.Path))
+		}
+		if !reflect.DeepEqual(got, exp.exp) {
+			t.Fatalf("%s: expected %v, got %v", exp.query, exp.exp, got)
+		}
+	}
+}
+
+func TestNewEntry(t *testing.T) {
+
+	// The grid of a pattern built without setting it is taken from the
+	// tracks.
+	steps := make([]byte, 32)
+	steps[0], steps[20] = drum.StepOn, drum.StepOn
+	p := drum.Pattern{Tracks: []drum.Track{{ID: 0, Name: "kick", Steps: steps}}}
+	e := NewEntry("long.splice", p)
+	if e.Steps != 32 || len(e.Onsets) != 32 || e.Tracks[0].Hits != 2 {
+		t.Fatalf("expected 32 steps and 2 hits, got %d and %+v", e.Steps, e.Tracks)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, s := range []string{"tempo", "tempo:", "tempo:fast", "tempo:130-120", "colour:red", `track:"kick`} {
+		if _, err := ParseQuery(s); err == nil {
+			t.Fatalf("%s: expected an error", s)
+		}
+	}
+}
+
+func TestSimilar(t *testing.T) {
+	ix := Build([]string{fixtures}, Options{})
+	target, _ := ix.Lookup(filepath.Join(fixtures, "pattern_2.splice"))
+
+	matches := ix.Similar(target, 2)
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 matches, got %d", len(matches))
+	}
+
+	// Pattern 3 plays the same kick, snare and hi-hat as pattern 2.
+	if filepath.Base(matches[0].Path) != "pattern_3.splice" || matches[0].Score < 0.9 {
+		t.Fatalf("expected pattern_3.splice to be the closest, got %s at %v", matches[0].Path, matches[0].Score)
+	}
+	if matches[1].Score > matches[0].Score {
+		t.Fatalf("matches aren't sorted: %v", matches)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "library")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "bad.splice"), []byte("SPLICY"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ix := Build([]string{fixtures, dir}, Options{})
+	if fs := failures(ix); len(fs) != 1 || fs[0].Path != filepath.Join(dir, "bad.splice") {
+		t.Fatalf("expected bad.splice to fail, got %v", fs)
+	}
+
+	file := filepath.Join(dir, "index.json")
+	if err := ix.Save(file); err != nil {
+		t.Fatalf("something went wrong saving - %v", err)
+	}
+	loaded, err := Load(file)
+	if err != nil {
+		t.Fatalf("something went wrong loading - %v", err)
+	}
+	if len(loaded.Entries) != len(ix.Entries) {
+		t.Fatalf("expected %d entries, got %d", len(ix.Entries), len(loaded.Entries))
+	}
+	for i := range ix.Entries {
+		if !reflect.DeepEqual(loaded.Entries[i].Tracks, ix.Entries[i].Tracks) ||
+			loaded.Entries[i].Hash != ix.Entries[i].Hash || !loaded.Entries[i].ModTime.Equal(ix.Entries[i].ModTime) {
+			t.Fatalf("entry %d changed saving it", i)
+		}
+	}
+
+	// A directory which can't be read doesn't stop the others being
+	// indexed.
+	missing := filepath.Join(dir, "missing")
+	partial := Build([]string{missing, fixtures}, Options{})
+	if fs := failures(partial); len(fs) != 1 || fs[0].Path != missing || len(partial.Entries) != len(ix.Entries) {
+		t.Fatalf("expected only the missing directory to fail, got %d entries and %v", len(partial.Entries), fs)
+	}
+
+	// Entries of unchanged files are reused.
+	loaded.Entries[0].Tempo = 1
+	again := Build([]string{fixtures}, Options{Previous: loaded})
+	if again.Entries[0].Tempo != 1 {
+		t.Fatalf("expected the previous entry to be reused")
+	}
+}
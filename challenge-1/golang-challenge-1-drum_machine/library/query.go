@@ -0,0 +1,155 @@
+package library
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Query selects entries of the index. Zero fields match anything.
+type Query struct {
+	MinTempo, MaxTempo float32
+
+	// Version is the hardware version of the patterns.
+	Version string
+
+	// Tracks lists names of tracks which must all be in the pattern,
+	// ignoring case.
+	Tracks []string
+
+	MinDensity, MaxDensity float64
+
+	// Hash finds the patterns playing the steps of another.
+	Hash string
+}
+
+// Match reports whether the entry matches the query.
+func (q Query) Match(e Entry) bool {
+	switch {
+	case q.MinTempo != 0 && e.Tempo < q.MinTempo,
+		q.MaxTempo != 0 && e.Tempo > q.MaxTempo,
+		q.Version != "" && e.Version != q.Version,
+		q.MinDensity != 0 && e.Density < q.MinDensity,
+		q.MaxDensity != 0 && e.Density > q.MaxDensity,
+		q.Hash != "" && e.Hash != q.Hash:
+		return false
+	}
+	for _, name := range q.Tracks {
+		if !e.HasTrack(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseQuery parses a query made of terms separated by spaces, such as
+//
+//	tempo:110-125 track:cowbell
+//
+// for the patterns between 110 and 125 BPM with a cowbell track. The terms
+// are:
+//
+//	tempo:120 or tempo:110-125, either bound may be left out
+//	track:NAME, quoted when it has spaces as in track:"low conga"
+//	version:0.909
+//	density:0.2-0.5, the share of steps which play
+//	hash:HASH
+func ParseQuery(s string) (Query, error) {
+	terms, err := splitTerms(s)
+	if err != nil {
+		return Query{}, err
+	}
+
+	var q Query
+	for _, term := range terms {
+		i := strings.Index(term, ":")
+		if i < 0 {
+			return Query{}, fmt.Errorf("library: query term %q is not key:value", term)
+		}
+		key, value := strings.ToLower(term[:i]), term[i+1:]
+		if value == "" {
+			return Query{}, fmt.Errorf("library: query term %q has no value", term)
+		}
+
+		switch key {
+		case "tempo":
+			min, max, err := parseRange(value)
+			if err != nil {
+				return Query{}, fmt.Errorf("library: invalid tempo %q: %v", value, err)
+			}
+			q.MinTempo, q.MaxTempo = float32(min), float32(max)
+		case "track":
+			q.Tracks = append(q.Tracks, value)
+		case "version":
+			q.Version = value
+		case "density":
+			min, max, err := parseRange(value)
+			if err != nil {
+				return Query{}, fmt.Errorf("library: invalid density %q: %v", value, err)
+			}
+			q.MinDensity, q.MaxDensity = min, max
+		case "hash":
+			q.Hash = value
+		default:
+			return Query{}, fmt.Errorf("library: unknown query key %q", key)
+		}
+	}
+	return q, nil
+}
+
+// parseRange parses a single number or a range of two numbers separated
+// by "-", either of which may be left out.
+func parseRange(s string) (float64, float64, error) {
+	i := strings.Index(s, "-")
+	if i < 0 {
+		v, err := strconv.ParseFloat(s, 64)
+		return v, v, err
+	}
+
+	var min, max float64
+	var err error
+	if lo := s[:i]; lo != "" {
+		if min, err = strconv.ParseFloat(lo, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+	if hi := s[i+1:]; hi != "" {
+		if max, err = strconv.ParseFloat(hi, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+	if max != 0 && min > max {
+		return 0, 0, fmt.Errorf("%v is above %v", min, max)
+	}
+	return min, max, nil
+}
+
+// splitTerms splits the query on spaces, keeping quoted text together.
+func splitTerms(s string) ([]string, error) {
+	var terms []string
+	var term strings.Builder
+	quoted, started := false, false
+	for _, c := range s {
+		switch {
+		case c == '"':
+			quoted = !quoted
+			started = true
+		case c == ' ' && !quoted:
+			if started {
+				terms = append(terms, term.String())
+				term.Reset()
+				started = false
+			}
+		default:
+			term.WriteRune(c)
+			started = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("library: unterminated quote in query %q", s)
+	}
+	if started {
+		terms = append(terms, term.String())
+	}
+	return terms, nil
+}
@@ -0,0 +1,454 @@
+package live
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	drum "github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine"
+)
+
+// fakeClock fires every timer straight away, moving its time forward by
+// the requested duration.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// message is a message received by a recorder.
+type message struct {
+	at   time.Duration
+	kind string
+	step int
+	id   uint8
+}
+
+// recorder is an Output recording its messages with the time of the clock.
+type recorder struct {
+	clock *fakeClock
+
+	// fail is returned by the clock message of that number, counting from
+	// one, when it is set.
+	fail int
+
+	// reached is closed once the clock message numbered after it is
+	// received, when it is set.
+	reach   int
+	reached chan struct{}
+
+	mu       sync.Mutex
+	messages []message
+}
+
+func (r *recorder) add(m message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m.at = r.clock.Now().Sub(time.Time{})
+	r.messages = append(r.messages, m)
+}
+
+// all returns a copy of the messages received so far.
+func (r *recorder) all() []message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]message(nil), r.messages...)
+}
+
+func (r *recorder) count(kind string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, m := range r.messages {
+		if m.kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *recorder) Start() error { r.add(message{kind: "start"}); return nil }
+func (r *recorder) Stop() error  { r.add(message{kind: "stop"}); return nil }
+
+func (r *recorder) Clock() error {
+	r.add(message{kind: "clock"})
+	n := r.count("clock")
+	if r.reach > 0 && n == r.reach {
+		close(r.reached)
+	}
+	if r.fail > 0 && n == r.fail {
+		return errors.New("output unplugged")
+	}
+	return nil
+}
+
+func (r *recorder) Trigger(e drum.Event) error {
+	r.add(message{kind: "trigger", step: e.Step, id: e.Track.ID})
+	return nil
+}
+
+func TestPlayer(t *testing.T) {
+	p, err := drum.DecodeFile(path.Join("..", "fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+
+	clock := &fakeClock{}
+	rec := &recorder{clock: clock}
+	pl := NewPlayer(p, rec)
+	pl.Clock = clock
+	pl.Loops = 2
+
+	if err := pl.Start(); err != nil {
+		t.Fatalf("something went wrong starting - %v", err)
+	}
+	if err := pl.Wait(); err != nil {
+		t.Fatalf("something went wrong playing - %v", err)
+	}
+
+	// pattern_2 has 10 hits per bar, and each bar is four beats.
+	if n := rec.count("trigger"); n != 20 {
+		t.Fatalf("expected 20 triggers, got %d", n)
+	}
+	if n := rec.count("clock"); n != 2*4*ClocksPerBeat {
+		t.Fatalf("expected %d clock messages, got %d", 2*4*ClocksPerBeat, n)
+	}
+
+	step := p.Header.StepDuration()
+	beat := 4 * step
+	messages := rec.all()
+	first, last := messages[0], messages[len(messages)-1]
+	if first.kind != "start" || first.at != 0 {
+		t.Fatalf("expected to start at once, got %+v", first)
+	}
+	if last.kind != "stop" || last.at != 32*step {
+		t.Fatalf("expected to stop at the end of the second bar, got %+v", last)
+	}
+
+	clocks := 0
+	for _, m := range messages {
+		switch m.kind {
+		case "clock":
+			at := time.Duration(float64(clocks) * float64(beat) / ClocksPerBeat)
+			if d := m.at - at; d < -time.Microsecond || d > time.Microsecond {
+				t.Fatalf("clock %d sent at %v, expected %v", clocks, m.at, at)
+			}
+			clocks++
+		case "trigger":
+			if m.at%(16*step) != time.Duration(m.step)*step {
+				t.Fatalf("step %d of track %d triggered at %v", m.step, m.id, m.at)
+			}
+		}
+	}
+}
+
+func TestPlayerSwing(t *testing.T) {
+	p := drum.Pattern{
+		Header: drum.Header{Tempo: 120, Steps: 4, StepsPerBeat: 4},
+		Tracks: []drum.Track{{ID: 1, Name: "hh-close", Steps: []byte{1, 1, 1, 1}}},
+	}
+
+	tData := []struct {
+		swing float32
+		times []time.Duration
+	}{
+		{0, []time.Duration{0, 125 * time.Millisecond, 250 * time.Millisecond, 375 * time.Millisecond}},
+		{50, []time.Duration{0, 125 * time.Millisecond, 250 * time.Millisecond, 375 * time.Millisecond}},
+		{75, []time.Duration{0, 187500 * time.Microsecond, 250 * time.Millisecond, 437500 * time.Microsecond}},
+	}
+
+	for _, exp := range tData {
+		clock := &fakeClock{}
+		rec := &recorder{clock: clock}
+		pl := NewPlayer(p, rec)
+		pl.Clock = clock
+		pl.Loops = 1
+		pl.Swing = exp.swing
+
+		if err := pl.Start(); err != nil {
+			t.Fatalf("swing %v: something went wrong starting - %v", exp.swing, err)
+		}
+		if err := pl.Wait(); err != nil {
+			t.Fatalf("swing %v: something went wrong playing - %v", exp.swing, err)
+		}
+
+		var times []time.Duration
+		for _, m := range rec.all() {
+			if m.kind == "trigger" {
+				times = append(times, m.at)
+			}
+		}
+		if len(times) != len(exp.times) {
+			t.Fatalf("swing %v: expected %d triggers, got %v", exp.swing, len(exp.times), times)
+		}
+		for i := range times {
+			if times[i] != exp.times[i] {
+				t.Fatalf("swing %v: step %d triggered at %v, expected %v", exp.swing, i, times[i], exp.times[i])
+			}
+		}
+	}
+
+	pl := NewPlayer(p)
+	pl.Swing = 40
+	if err := pl.Start(); !errors.Is(err, drum.ErrInvalidTiming) {
+		t.Fatalf("expected %v, got %v", drum.ErrInvalidTiming, err)
+	}
+	if err := NewPlayer(drum.Pattern{}).Start(); err != drum.ErrInvalidTempo {
+		t.Fatalf("expected %v, got %v", drum.ErrInvalidTempo, err)
+	}
+}
+
+func TestPlayerStop(t *testing.T) {
+	p, err := drum.DecodeFile(path.Join("..", "fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+
+	// An output failing stops the playback with its error.
+	clock := &fakeClock{}
+	rec := &recorder{clock: clock, fail: 3}
+	pl := NewPlayer(p, rec)
+	pl.Clock = clock
+	if err := pl.Start(); err != nil {
+		t.Fatalf("something went wrong starting - %v", err)
+	}
+	if err := pl.Wait(); err == nil || !strings.Contains(err.Error(), "unplugged") {
+		t.Fatalf("expected the error of the output, got %v", err)
+	}
+	if n := rec.count("clock"); n != 3 {
+		t.Fatalf("expected playback to stop after 3 clock messages, got %d", n)
+	}
+
+	// Playing forever lasts until Stop.
+	clock = &fakeClock{}
+	rec = &recorder{clock: clock, reach: 1000, reached: make(chan struct{})}
+	pl = NewPlayer(p, rec)
+	pl.Clock = clock
+	if err := pl.Start(); err != nil {
+		t.Fatalf("something went wrong starting - %v", err)
+	}
+	<-rec.reached
+	if err := pl.Stop(); err != nil {
+		t.Fatalf("something went wrong stopping - %v", err)
+	}
+	messages := rec.all()
+	if last := messages[len(messages)-1]; last.kind != "stop" {
+		t.Fatalf("expected the stop message last, got %+v", last)
+	}
+	if err := pl.Stop(); err != nil {
+		t.Fatalf("something went wrong stopping twice - %v", err)
+	}
+}
+
+// oscPacket is a decoded OSC message.
+type oscPacket struct {
+	address string
+	args    []interface{}
+}
+
+// parseOSC decodes an OSC message with int32 and string arguments.
+func parseOSC(b []byte) (oscPacket, error) {
+	readString := func() (string, error) {
+		end := bytes.IndexByte(b, 0)
+		if end < 0 {
+			return "", errors.New("unterminated string")
+		}
+		s := string(b[:end])
+		size := (end + 4) / 4 * 4
+		if size > len(b) {
+			return "", errors.New("string padding is missing")
+		}
+		b = b[size:]
+		return s, nil
+	}
+
+	var p oscPacket
+	var err error
+	if p.address, err = readString(); err != nil {
+		return p, err
+	}
+	tags, err := readString()
+	if err != nil {
+		return p, err
+	}
+	if !strings.HasPrefix(tags, ",") {
+		return p, errors.New("missing type tags")
+	}
+	for _, tag := range tags[1:] {
+		switch tag {
+		case 'i':
+			if len(b) < 4 {
+				return p, errors.New("truncated int32")
+			}
+			p.args = append(p.args, int32(binary.BigEndian.Uint32(b)))
+			b = b[4:]
+		case 's':
+			s, err := readString()
+			if err != nil {
+				return p, err
+			}
+			p.args = append(p.args, s)
+		default:
+			return p, errors.New("unexpected type tag " + string(tag))
+		}
+	}
+	if len(b) != 0 {
+		return p, errors.New("trailing data")
+	}
+	return p, nil
+}
+
+func TestOSCOverUDP(t *testing.T) {
+	p, err := drum.DecodeFile(path.Join("..", "fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+
+	// The listener stands in for the gear on stage.
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	out, err := DialOSC(conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("something went wrong dialing - %v", err)
+	}
+	defer out.Close()
+
+	packets := make(chan oscPacket)
+	errs := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				errs <- err
+				return
+			}
+			msg, err := parseOSC(buf[:n])
+			if err != nil {
+				errs <- err
+				return
+			}
+			packets <- msg
+			if msg.address == "/drum/stop" {
+				close(packets)
+				return
+			}
+		}
+	}()
+
+	pl := NewPlayer(p, out)
+	pl.Clock = &fakeClock{}
+	pl.Loops = 1
+	if err := pl.Start(); err != nil {
+		t.Fatalf("something went wrong starting - %v", err)
+	}
+
+	var got []oscPacket
+	for msg := range packets {
+		got = append(got, msg)
+	}
+	select {
+	case err := <-errs:
+		t.Fatalf("something went wrong receiving - %v", err)
+	default:
+	}
+	if err := pl.Wait(); err != nil {
+		t.Fatalf("something went wrong playing - %v", err)
+	}
+
+	counts := map[string]int{}
+	for _, msg := range got {
+		counts[msg.address]++
+	}
+	expected := map[string]int{"/drum/start": 1, "/drum/clock": 4 * ClocksPerBeat, "/drum/trigger": 10, "/drum/stop": 1}
+	for address, n := range expected {
+		if counts[address] != n {
+			t.Fatalf("expected %d %s messages, got %d", n, address, counts[address])
+		}
+	}
+
+	if got[0].address != "/drum/start" {
+		t.Fatalf("expected the start message first, got %v", got[0])
+	}
+	for _, msg := range got {
+		if msg.address != "/drum/trigger" {
+			continue
+		}
+		args := []interface{}{int32(0), "kick", int32(0), int32(drum.NormalVelocity)}
+		if len(msg.args) != len(args) {
+			t.Fatalf("unexpected trigger arguments: %v", msg.args)
+		}
+		for i := range args {
+			if msg.args[i] != args[i] {
+				t.Fatalf("expected the kick on the first step, got %v", msg.args)
+			}
+		}
+		break
+	}
+}
+
+func TestMIDIOutput(t *testing.T) {
+	p := drum.Pattern{
+		Header: drum.Header{Tempo: 120, Steps: 4, StepsPerBeat: 4},
+		Tracks: []drum.Track{
+			{ID: 0, Name: "kick", Steps: []byte{1, 0, drum.AccentVelocity, 0}},
+			{ID: 9, Name: "ping", Steps: []byte{0, 0, 0, 1}},
+		},
+	}
+
+	var buf bytes.Buffer
+	out := NewMIDIOutput(&buf)
+	out.Notes = map[string]uint8{"kick": 36, "ping": 81}
+	pl := NewPlayer(p, out)
+	pl.Clock = &fakeClock{}
+	pl.Loops = 1
+	if err := pl.Start(); err != nil {
+		t.Fatalf("something went wrong starting - %v", err)
+	}
+	if err := pl.Wait(); err != nil {
+		t.Fatalf("something went wrong playing - %v", err)
+	}
+
+	// A beat of four steps has 6 clock messages per step, sent before the
+	// notes of the step.
+	clocks := bytes.Repeat([]byte{0xf8}, 6)
+	var expected []byte
+	expected = append(expected, 0xfa)
+	expected = append(expected, clocks[0], 0x99, 36, 100)
+	expected = append(expected, clocks[1:]...)
+	expected = append(expected, clocks...)
+	expected = append(expected, clocks[0], 0x89, 36, 0, 0x99, 36, 127)
+	expected = append(expected, clocks[1:]...)
+	expected = append(expected, clocks[0], 0x99, 81, 100)
+	expected = append(expected, clocks[1:]...)
+	expected = append(expected, 0x89, 36, 0, 0x89, 81, 0, 0xfc)
+
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatalf("unexpected MIDI bytes.\nGot:\n% x\nExpected:\n% x", buf.Bytes(), expected)
+	}
+}
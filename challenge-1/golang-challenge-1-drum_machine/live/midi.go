@@ -0,0 +1,103 @@
+package live
+
+import (
+	"io"
+	"sort"
+
+	drum "github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine"
+)
+
+// MIDI messages sent by MIDIOutput.
+const (
+	midiNoteOff = 0x80
+	midiNoteOn  = 0x90
+	midiClock   = 0xf8
+	midiStart   = 0xfa
+	midiStop    = 0xfc
+
+	// drumChannel is the General MIDI percussion channel, channel 10.
+	drumChannel = 9
+)
+
+// MIDIOutput writes the messages of a player as raw MIDI bytes: the real
+// time start, stop and timing clock messages, and a note on the General
+// MIDI percussion channel for each trigger. The writer may be a MIDI device
+// such as /dev/snd/midiC1D0 or a connection to one.
+type MIDIOutput struct {
+
+	// Notes maps track names to MIDI notes, drum.GMNotes is used when nil.
+	Notes map[string]uint8
+
+	w io.Writer
+
+	// held holds the notes playing, which are released before they are
+	// played again and when playback stops.
+	held map[uint8]bool
+}
+
+// NewMIDIOutput is a factory function for MIDIOutput.
+func NewMIDIOutput(w io.Writer) *MIDIOutput {
+	return &MIDIOutput{
+		w:    w,
+		held: map[uint8]bool{},
+	}
+}
+
+// Start implements the Output interface for MIDIOutput.
+func (o *MIDIOutput) Start() error {
+	return o.write(midiStart)
+}
+
+// Stop implements the Output interface for MIDIOutput, releasing the notes
+// still playing.
+func (o *MIDIOutput) Stop() error {
+	var notes []int
+	for n := range o.held {
+		notes = append(notes, int(n))
+	}
+	sort.Ints(notes)
+	for _, n := range notes {
+		if err := o.release(uint8(n)); err != nil {
+			return err
+		}
+	}
+	return o.write(midiStop)
+}
+
+// Clock implements the Output interface for MIDIOutput.
+func (o *MIDIOutput) Clock() error {
+	return o.write(midiClock)
+}
+
+// Trigger implements the Output interface for MIDIOutput.
+func (o *MIDIOutput) Trigger(e drum.Event) error {
+	note := drum.MIDIOptions{Notes: o.Notes}.Note(e.Track)
+	if o.held[note] {
+		if err := o.release(note); err != nil {
+			return err
+		}
+	}
+
+	// MIDI velocities only go up to 127.
+	velocity := e.Track.Velocity(e.Step) / 2
+	if velocity == 0 {
+		velocity = 1
+	}
+	if err := o.write(midiNoteOn|drumChannel, note, velocity); err != nil {
+		return err
+	}
+	o.held[note] = true
+	return nil
+}
+
+// release sends the note off message of a note.
+func (o *MIDIOutput) release(note uint8) error {
+	delete(o.held, note)
+	return o.write(midiNoteOff|drumChannel, note, 0)
+}
+
+// write writes a message in a single call.
+func (o *MIDIOutput) write(msg ...byte) error {
+	_, err := o.w.Write(msg)
+	return err
+}
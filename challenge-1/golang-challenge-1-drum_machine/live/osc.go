@@ -0,0 +1,127 @@
+package live
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+
+	drum "github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine"
+)
+
+// DefaultOSCPrefix starts the address of every OSC message.
+const DefaultOSCPrefix = "/drum"
+
+// OSCOutput sends the messages of a player as OSC messages, one per packet:
+//
+//	/drum/start
+//	/drum/stop
+//	/drum/clock
+//	/drum/trigger ID NAME STEP VELOCITY
+//
+// The arguments of a trigger are the track ID, name and step, and the
+// velocity of the step from 1 to 255, as 32 bit integers and a string.
+type OSCOutput struct {
+
+	// Prefix replaces DefaultOSCPrefix when it isn't empty.
+	Prefix string
+
+	w io.Writer
+}
+
+// NewOSCOutput is a factory function for OSCOutput. Each message is written
+// to w in a single call, which makes one packet of a UDP connection.
+func NewOSCOutput(w io.Writer) *OSCOutput {
+	return &OSCOutput{w: w}
+}
+
+// DialOSC returns an OSCOutput sending its messages over UDP to the
+// address, "host:port".
+func DialOSC(addr string) (*OSCOutput, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewOSCOutput(conn), nil
+}
+
+// Close closes the connection of the output, if it has one.
+func (o *OSCOutput) Close() error {
+	if c, ok := o.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Start implements the Output interface for OSCOutput.
+func (o *OSCOutput) Start() error {
+	return o.send("start")
+}
+
+// Stop implements the Output interface for OSCOutput.
+func (o *OSCOutput) Stop() error {
+	return o.send("stop")
+}
+
+// Clock implements the Output interface for OSCOutput.
+func (o *OSCOutput) Clock() error {
+	return o.send("clock")
+}
+
+// Trigger implements the Output interface for OSCOutput.
+func (o *OSCOutput) Trigger(e drum.Event) error {
+	return o.send("trigger",
+		int32(e.Track.ID), e.Track.Name, int32(e.Step), int32(e.Track.Velocity(e.Step)))
+}
+
+// send writes a message to the address made of the prefix and name.
+func (o *OSCOutput) send(name string, args ...interface{}) error {
+	prefix := o.Prefix
+	if prefix == "" {
+		prefix = DefaultOSCPrefix
+	}
+	msg, err := oscMessage(prefix+"/"+name, args...)
+	if err != nil {
+		return err
+	}
+	_, err = o.w.Write(msg)
+	return err
+}
+
+// oscMessage encodes an OSC message with int32, float32 and string
+// arguments.
+func oscMessage(address string, args ...interface{}) ([]byte, error) {
+	tags := ","
+	var data []byte
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case int32:
+			tags += "i"
+			data = binary.BigEndian.AppendUint32(data, uint32(v))
+		case float32:
+			tags += "f"
+			data = binary.BigEndian.AppendUint32(data, math.Float32bits(v))
+		case string:
+			tags += "s"
+			data = appendOSCString(data, v)
+		default:
+			return nil, fmt.Errorf("live: unsupported OSC argument %T", arg)
+		}
+	}
+
+	msg := appendOSCString(nil, address)
+	msg = appendOSCString(msg, tags)
+	return append(msg, data...), nil
+}
+
+// appendOSCString appends the string with the null byte ending it, padded
+// to a multiple of four bytes.
+func appendOSCString(b []byte, s string) []byte {
+	b = append(b, s...)
+	b = append(b, 0)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
@@ -0,0 +1,190 @@
+// Package live plays drum patterns to external gear in real time, as OSC
+// messages over UDP or as raw MIDI bytes. Along with the triggers of the
+// steps a player sends start, stop and clock messages so the gear can
+// follow its tempo.
+package live
+
+import (
+	"sync"
+
+	drum "github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine"
+)
+
+// ClocksPerBeat is the number of clock messages sent in each beat, the
+// resolution of the MIDI beat clock.
+const ClocksPerBeat = 24
+
+// Output receives the messages of a player. Its methods are called from a
+// single goroutine, an error stops the playback.
+type Output interface {
+
+	// Start is sent before the first step and Stop once playback ends.
+	Start() error
+	Stop() error
+
+	// Clock is sent ClocksPerBeat times in each beat.
+	Clock() error
+
+	// Trigger is sent for every track which plays on a step.
+	Trigger(e drum.Event) error
+}
+
+// Player plays a pattern to one or more outputs at the tempo of the
+// pattern.
+type Player struct {
+
+	// Loops is the number of times the pattern is played before the player
+	// stops on its own. Zero loops forever.
+	Loops int
+
+	// Swing replaces the swing of the pattern when it isn't zero, see
+	// drum.Timing.
+	Swing float32
+
+	// Clock schedules the messages. The wall clock is used when it is nil.
+	Clock drum.Clock
+
+	pattern drum.Pattern
+	outputs []Output
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+	err  error
+}
+
+// NewPlayer is a factory function for Player.
+func NewPlayer(p drum.Pattern, outputs ...Output) *Player {
+	return &Player{
+		pattern: p,
+		outputs: outputs,
+	}
+}
+
+// Start starts playing the pattern from the first step. It does nothing if
+// the player is already playing.
+func (pl *Player) Start() error {
+	if !(pl.pattern.Header.Tempo > 0) {
+		return drum.ErrInvalidTempo
+	}
+	p := pl.pattern
+	if pl.Swing != 0 {
+		p.Timing.Swing = pl.Swing
+	}
+	if err := p.Timing.Validate(); err != nil {
+		return err
+	}
+
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	if pl.stop != nil {
+		return nil
+	}
+	pl.stop = make(chan struct{})
+	pl.done = make(chan struct{})
+	pl.err = nil
+
+	go pl.run(p, pl.stop, pl.done)
+
+	return nil
+}
+
+// Stop stops playing, sending the stop message, and returns the error
+// which ended the playback if any.
+func (pl *Player) Stop() error {
+	pl.mu.Lock()
+	if pl.stop != nil {
+		select {
+		case <-pl.stop:
+		default:
+			close(pl.stop)
+		}
+	}
+	pl.mu.Unlock()
+
+	return pl.Wait()
+}
+
+// Wait blocks until the player is no longer playing and returns the error
+// which ended the playback if any.
+func (pl *Player) Wait() error {
+	pl.mu.Lock()
+	done := pl.done
+	pl.mu.Unlock()
+
+	if done != nil {
+		<-done
+	}
+
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	return pl.err
+}
+
+// run sends the start message, plays the pattern with a drum.Sequencer
+// sending the clock messages and triggers from its callbacks, and sends
+// the stop message, recording the first error met.
+func (pl *Player) run(p drum.Pattern, stop, done chan struct{}) {
+	defer close(done)
+
+	// The callbacks run on the goroutine of the sequencer, which is
+	// stopped from here once an output fails.
+	var err error
+	failed := make(chan struct{})
+	send := func(fn func(o Output) error) {
+		if err != nil {
+			return
+		}
+		if err = pl.send(fn); err != nil {
+			close(failed)
+		}
+	}
+
+	seq := drum.NewSequencer(p, func(e drum.Event) {
+		send(func(o Output) error { return o.Trigger(e) })
+	})
+	seq.Loops = pl.Loops
+	seq.Clock = pl.Clock
+	seq.ClocksPerBeat = ClocksPerBeat
+	seq.Tick = func() {
+		send(func(o Output) error { return o.Clock() })
+	}
+
+	// The tempo was checked by Start, so the sequencer starts.
+	send(func(o Output) error { return o.Start() })
+	if err == nil && seq.Start() == nil {
+		finished := make(chan struct{})
+		go func() {
+			seq.Wait()
+			close(finished)
+		}()
+
+		select {
+		case <-finished:
+		case <-stop:
+			seq.Stop()
+		case <-failed:
+			seq.Stop()
+		}
+	}
+
+	if stopErr := pl.send(func(o Output) error { return o.Stop() }); err == nil {
+		err = stopErr
+	}
+
+	pl.mu.Lock()
+	pl.err = err
+	pl.stop = nil
+	pl.mu.Unlock()
+}
+
+// send sends a message to every output, stopping at the first error.
+func (pl *Player) send(fn func(o Output) error) error {
+	for _, o := range pl.outputs {
+		if err := fn(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package drum
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// The JSON and YAML forms of patterns use these types, which are easy to
+// read and edit, rather than the raw values of the binary format. The
+// YAML methods follow the Marshaler and Unmarshaler interfaces of
+// gopkg.in/yaml.v2, which gopkg.in/yaml.v3 also supports, so the package
+// doesn't have to depend on either.
+
+// headerData is the JSON and YAML form of a Header.
+type headerData struct {
+	Version      string  `json:"version" yaml:"version"`
+	Tempo        float32 `json:"tempo" yaml:"tempo"`
+	Steps        int     `json:"steps,omitempty" yaml:"steps,omitempty"`
+	StepsPerBeat int     `json:"stepsPerBeat,omitempty" yaml:"stepsPerBeat,omitempty"`
+}
+
+// trackData is the JSON and YAML form of a Track. Steps uses the letters of
+// the grid format and Velocities is only set when the letters can't hold
+// the velocities of the track.
+type trackData struct {
+	ID         uint8  `json:"id" yaml:"id"`
+	Name       string `json:"name" yaml:"name"`
+	Steps      string `json:"steps" yaml:"steps"`
+	Velocities []int  `json:"velocities,omitempty" yaml:"velocities,omitempty"`
+}
+
+// patternData is the JSON and YAML form of a Pattern.
+type patternData struct {
+	headerData `yaml:",inline"`
+	Swing      float32           `json:"swing,omitempty" yaml:"swing,omitempty"`
+	Offsets    []float32         `json:"offsets,omitempty" yaml:"offsets,omitempty"`
+	Tracks     []trackData       `json:"tracks" yaml:"tracks"`
+	Metadata   map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+	Chunks     []Chunk           `json:"chunks,omitempty" yaml:"chunks,omitempty"`
+	Trailing   []byte            `json:"trailing,omitempty" yaml:"trailing,omitempty"`
+}
+
+// data converts the header into its JSON and YAML form.
+func (d Header) data() headerData {
+	h := headerData{
+		Version: d.version(),
+		Tempo:   d.Tempo,
+	}
+	if d.steps() != defaultSteps || d.stepsPerBeat() != defaultStepsPerBeat {
+		h.Steps = d.steps()
+		h.StepsPerBeat = d.stepsPerBeat()
+	}
+	return h
+}
+
+// header converts the JSON and YAML form back into a Header.
+func (h headerData) header() (Header, error) {
+	var d Header
+	if len(h.Version) > len(d.Version) {
+		return Header{}, fmt.Errorf("drum: version %q is %d bytes, it can't be longer than %d",
+			h.Version, len(h.Version), len(d.Version))
+	}
+	if h.Steps < 0 || h.StepsPerBeat < 0 {
+		return Header{}, fmt.Errorf("drum: invalid grid of %d steps at %d per beat", h.Steps, h.StepsPerBeat)
+	}
+	copy(d.Version[:], h.Version)
+	d.Tempo = h.Tempo
+	d.Steps = h.Steps
+	d.StepsPerBeat = h.StepsPerBeat
+	return d, nil
+}
+
+// data converts the track into its JSON and YAML form.
+func (t Track) data() trackData {
+	d := trackData{
+		ID:    t.ID,
+		Name:  t.Name,
+		Steps: string(t.letters()),
+	}
+	for _, v := range t.Steps {
+		if v != 0 && v != StepOn && v != AccentVelocity {
+			d.Velocities = make([]int, len(t.Steps))
+			for i, v := range t.Steps {
+				d.Velocities[i] = int(v)
+			}
+			break
+		}
+	}
+	return d
+}
+
+// track converts the JSON and YAML form back into a Track. The "|"
+// separators of the grid format may be used in the steps.
+func (d trackData) track() (Track, error) {
+	t := Track{ID: d.ID, Name: d.Name}
+	for _, c := range d.Steps {
+		switch c {
+		case 'x':
+			t.Steps = append(t.Steps, StepOn)
+		case 'X':
+			t.Steps = append(t.Steps, AccentVelocity)
+		case '-':
+			t.Steps = append(t.Steps, 0)
+		case '|', ' ':
+		default:
+			return Track{}, fmt.Errorf("drum: track %d: invalid step %q, expected \"x\", \"X\" or \"-\"", d.ID, c)
+		}
+	}
+
+	if d.Velocities != nil {
+		if len(d.Velocities) != len(t.Steps) {
+			return Track{}, fmt.Errorf("drum: track %d has %d velocities for %d steps",
+				d.ID, len(d.Velocities), len(t.Steps))
+		}
+		for i, v := range d.Velocities {
+			if v < 0 || v > 255 {
+				return Track{}, fmt.Errorf("drum: track %d: velocity %d is not from 0 to 255", d.ID, v)
+			}
+			t.Steps[i] = byte(v)
+		}
+	}
+
+	return t, nil
+}
+
+// data converts the pattern into its JSON and YAML form.
+func (p Pattern) data() patternData {
+	d := patternData{
+		headerData: p.Header.data(),
+		Swing:      p.Timing.Swing,
+		Offsets:    p.Timing.Offsets,
+		Tracks:     []trackData{},
+		Metadata:   p.Metadata,
+		Chunks:     p.Chunks,
+		Trailing:   p.Trailing,
+	}
+	for _, t := range p.Tracks {
+		d.Tracks = append(d.Tracks, t.data())
+	}
+	return d
+}
+
+// pattern converts the JSON and YAML form back into a Pattern. Every track
+// must have the number of steps of the header.
+func (d patternData) pattern() (Pattern, error) {
+	h, err := d.headerData.header()
+	if err != nil {
+		return Pattern{}, err
+	}
+
+	p := Pattern{
+		Header:   h,
+		Timing:   Timing{Swing: d.Swing, Offsets: d.Offsets},
+		Metadata: d.Metadata,
+		Chunks:   d.Chunks,
+		Trailing: d.Trailing,
+	}
+	if err := p.Timing.Validate(); err != nil {
+		return Pattern{}, err
+	}
+	for _, td := range d.Tracks {
+		t, err := td.track()
+		if err != nil {
+			return Pattern{}, err
+		}
+		if len(t.Steps) != h.steps() {
+			return Pattern{}, fmt.Errorf("drum: track %d has %d steps, the pattern has %d",
+				t.ID, len(t.Steps), h.steps())
+		}
+		p.Tracks = append(p.Tracks, t)
+	}
+
+	return p, nil
+}
+
+// MarshalJSON implements the json.Marshaler interface for Header.
+func (d Header) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.data())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for Header.
+func (d *Header) UnmarshalJSON(b []byte) error {
+	var h headerData
+	if err := json.Unmarshal(b, &h); err != nil {
+		return err
+	}
+	header, err := h.header()
+	if err != nil {
+		return err
+	}
+	*d = header
+	return nil
+}
+
+// MarshalYAML implements the yaml.Marshaler interface for Header.
+func (d Header) MarshalYAML() (interface{}, error) {
+	return d.data(), nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for Header.
+func (d *Header) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var h headerData
+	if err := unmarshal(&h); err != nil {
+		return err
+	}
+	header, err := h.header()
+	if err != nil {
+		return err
+	}
+	*d = header
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface for Track.
+func (t Track) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.data())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for Track.
+func (t *Track) UnmarshalJSON(b []byte) error {
+	var d trackData
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+	track, err := d.track()
+	if err != nil {
+		return err
+	}
+	*t = track
+	return nil
+}
+
+// MarshalYAML implements the yaml.Marshaler interface for Track.
+func (t Track) MarshalYAML() (interface{}, error) {
+	return t.data(), nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for Track.
+func (t *Track) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var d trackData
+	if err := unmarshal(&d); err != nil {
+		return err
+	}
+	track, err := d.track()
+	if err != nil {
+		return err
+	}
+	*t = track
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface for Pattern.
+func (p Pattern) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.data())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for Pattern.
+func (p *Pattern) UnmarshalJSON(b []byte) error {
+	var d patternData
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+	pattern, err := d.pattern()
+	if err != nil {
+		return err
+	}
+	*p = pattern
+	return nil
+}
+
+// MarshalYAML implements the yaml.Marshaler interface for Pattern.
+func (p Pattern) MarshalYAML() (interface{}, error) {
+	return p.data(), nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for Pattern.
+func (p *Pattern) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var d patternData
+	if err := unmarshal(&d); err != nil {
+		return err
+	}
+	pattern, err := d.pattern()
+	if err != nil {
+		return err
+	}
+	*p = pattern
+	return nil
+}
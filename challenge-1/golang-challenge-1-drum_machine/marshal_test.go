@@ -0,0 +1,160 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	p, err := DecodeFile(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("something went wrong marshaling - %v", err)
+	}
+
+	expected := `{"version":"0.808-alpha","tempo":98.4,"tracks":[` +
+		`{"id":0,"name":"kick","steps":"x-------x-------"},` +
+		`{"id":1,"name":"snare","steps":"----x-------x---"},` +
+		`{"id":3,"name":"hh-open","steps":"--x---x-x-x---x-"},` +
+		`{"id":5,"name":"cowbell","steps":"--------x-------"}]}`
+	if string(b) != expected {
+		t.Fatalf("pattern wasn't marshaled as expected.\nGot:\n%s\nExpected:\n%s", b, expected)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	files := []string{
+		"pattern_1.splice",
+		"pattern_2.splice",
+		"pattern_3.splice",
+		"pattern_4.splice",
+		"pattern_5.splice",
+	}
+
+	for _, f := range files {
+		p, err := DecodeFile(path.Join("fixtures", f))
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", f, err)
+		}
+
+		b, err := json.Marshal(p)
+		if err != nil {
+			t.Fatalf("something went wrong marshaling %s - %v", f, err)
+		}
+		var got Pattern
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatalf("something went wrong unmarshaling %s - %v", f, err)
+		}
+
+		// The format the pattern was read from isn't part of the JSON.
+		p.SourceFormat = 0
+		if !reflect.DeepEqual(got, p) {
+			t.Fatalf("%s changed after a JSON round trip.\nGot:\n%#v\nExpected:\n%#v", f, got, p)
+		}
+	}
+}
+
+func TestJSONVelocities(t *testing.T) {
+	p := Pattern{
+		Header: Header{Tempo: 90, Steps: 6, StepsPerBeat: 3},
+		Tracks: []Track{
+			{ID: 7, Name: "ride", Steps: []byte{1, 0, 90, 255, 0, 90}},
+			{ID: 8, Name: "kick", Steps: []byte{255, 0, 0, 1, 0, 0}},
+		},
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("something went wrong marshaling - %v", err)
+	}
+	expected := `{"version":"","tempo":90,"steps":6,"stepsPerBeat":3,"tracks":[` +
+		`{"id":7,"name":"ride","steps":"x-xX-x","velocities":[1,0,90,255,0,90]},` +
+		`{"id":8,"name":"kick","steps":"X--x--"}]}`
+	if string(b) != expected {
+		t.Fatalf("pattern wasn't marshaled as expected.\nGot:\n%s\nExpected:\n%s", b, expected)
+	}
+
+	var got Pattern
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("something went wrong unmarshaling - %v", err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Fatalf("pattern changed after a JSON round trip.\nGot:\n%#v\nExpected:\n%#v", got, p)
+	}
+}
+
+func TestUnmarshalJSONErrors(t *testing.T) {
+	tData := []struct {
+		json string
+		msg  string
+	}{
+		{`{"version":"` + strings.Repeat("v", 33) + `","tempo":120,"tracks":[]}`, "can't be longer than 32"},
+		{`{"version":"0.909","tempo":120,"tracks":[{"id":1,"name":"kick","steps":"x---|x---|x---|x--o"}]}`, "invalid step"},
+		{`{"version":"0.909","tempo":120,"tracks":[{"id":1,"name":"kick","steps":"x---|x---|x---"}]}`, "has 12 steps"},
+		{`{"version":"0.909","tempo":120,"tracks":[{"id":1,"name":"kick","steps":"x---","velocities":[1,2]}]}`, "2 velocities for 4 steps"},
+		{`{"version":"0.909","tempo":120,"tracks":[{"id":1,"name":"kick","steps":"x---","velocities":[1,0,0,256]}]}`, "not from 0 to 255"},
+	}
+
+	for _, exp := range tData {
+		var p Pattern
+		err := json.Unmarshal([]byte(exp.json), &p)
+		if err == nil || !strings.Contains(err.Error(), exp.msg) {
+			t.Fatalf("%s: expected an error containing %q, got %v", exp.json, exp.msg, err)
+		}
+	}
+
+	// Separators from the grid format are allowed.
+	var tr Track
+	if err := json.Unmarshal([]byte(`{"id":1,"name":"kick","steps":"|x---|x---|x---|x---|"}`), &tr); err != nil {
+		t.Fatalf("something went wrong unmarshaling - %v", err)
+	}
+	if tr.String() != "(1) kick\t|x---|x---|x---|x---|\n" {
+		t.Fatalf("unexpected track %q", tr)
+	}
+}
+
+func TestYAML(t *testing.T) {
+	p, err := DecodeFile(path.Join("fixtures", "pattern_4.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+
+	v, err := p.MarshalYAML()
+	if err != nil {
+		t.Fatalf("something went wrong marshaling - %v", err)
+	}
+	d, ok := v.(patternData)
+	if !ok {
+		t.Fatalf("unexpected YAML value %T", v)
+	}
+	if d.Version != "0.909" || d.Tempo != 240 || len(d.Tracks) != 4 || d.Tracks[2].Steps != "x-x-x-x-x-x-x-x-" {
+		t.Fatalf("unexpected YAML value %+v", d)
+	}
+
+	// Stand in for a YAML decoder by filling the value from JSON.
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unmarshal := func(out interface{}) error {
+		return json.NewDecoder(bytes.NewReader(b)).Decode(out)
+	}
+	var got Pattern
+	if err := got.UnmarshalYAML(unmarshal); err != nil {
+		t.Fatalf("something went wrong unmarshaling - %v", err)
+	}
+
+	// The format the pattern was read from isn't part of the YAML.
+	p.SourceFormat = 0
+	if !reflect.DeepEqual(got, p) {
+		t.Fatalf("pattern changed after a YAML round trip.\nGot:\n%#v\nExpected:\n%#v", got, p)
+	}
+}
@@ -0,0 +1,558 @@
+package drum
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ticksPerBeat is the resolution of exported MIDI files, the number of
+// ticks in a quarter note.
+const ticksPerBeat = 96
+
+// drumChannel is the General MIDI percussion channel, channel 10.
+const drumChannel = 9
+
+// defaultMIDITempo is the tempo of a Standard MIDI File without a tempo
+// meta event.
+const defaultMIDITempo = 120
+
+// ErrNotMIDI is returned when the data is not a Standard MIDI File.
+var ErrNotMIDI = errors.New("drum: not a MIDI file")
+
+// GMNotes maps track names to their General MIDI percussion notes. Names
+// are matched without regard to case.
+var GMNotes = map[string]uint8{
+	"subkick":    35,
+	"kick":       36,
+	"rimshot":    37,
+	"snare":      38,
+	"clap":       39,
+	"hh-close":   42,
+	"hihat":      42,
+	"hh-pedal":   44,
+	"low-tom":    45,
+	"hh-open":    46,
+	"mid-tom":    47,
+	"crash":      49,
+	"hi-tom":     50,
+	"ride":       51,
+	"tambourine": 54,
+	"cowbell":    56,
+	"hi conga":   63,
+	"low conga":  64,
+	"maracas":    70,
+	"claves":     75,
+}
+
+// gmNames is the name used for each note when importing a track which has
+// no name of its own.
+var gmNames = map[uint8]string{
+	35: "SubKick",
+	36: "kick",
+	37: "rimshot",
+	38: "snare",
+	39: "clap",
+	42: "hh-close",
+	44: "hh-pedal",
+	45: "low-tom",
+	46: "hh-open",
+	47: "mid-tom",
+	49: "crash",
+	50: "hi-tom",
+	51: "ride",
+	54: "tambourine",
+	56: "cowbell",
+	63: "Hi Conga",
+	64: "Low Conga",
+	70: "Maracas",
+	75: "claves",
+}
+
+// MIDIOptions controls how a pattern is exported to MIDI.
+type MIDIOptions struct {
+
+	// Format is the Standard MIDI File format, 0 for a single track or 1
+	// for a track per drum track.
+	Format int
+
+	// Notes maps track names to MIDI notes, GMNotes is used when nil.
+	Notes map[string]uint8
+
+	// Loops is the number of times the pattern is written, at least once.
+	Loops int
+}
+
+// Note returns the MIDI note played by the track. Tracks missing from the
+// note map fall back to a note picked from the track ID within the General
+// MIDI percussion range.
+func (o MIDIOptions) Note(t Track) uint8 {
+	notes := o.Notes
+	if notes == nil {
+		notes = GMNotes
+	}
+	if n, ok := notes[t.Name]; ok {
+		return n
+	}
+	for name, n := range notes {
+		if strings.EqualFold(name, t.Name) {
+			return n
+		}
+	}
+	return 35 + t.ID%47
+}
+
+// midiEvent is a single event in a MIDI track.
+type midiEvent struct {
+	tick uint32
+	data []byte
+}
+
+// EncodeMIDI writes the pattern to w as a Standard MIDI File. The tempo
+// is set from the header and every step which is on is written as a note
+// on the percussion channel lasting until the next step.
+func EncodeMIDI(w io.Writer, p Pattern, opts MIDIOptions) error {
+	if opts.Format != 0 && opts.Format != 1 {
+		return fmt.Errorf("drum: unsupported MIDI format %d", opts.Format)
+	}
+	if !(p.Header.Tempo > 0) {
+		return ErrInvalidTempo
+	}
+	loops := opts.Loops
+	if loops < 1 {
+		loops = 1
+	}
+
+	steps := p.steps()
+	stepsPerBeat := p.Header.stepsPerBeat()
+	beats := 4
+	if steps%stepsPerBeat == 0 && steps/stepsPerBeat < 256 {
+		beats = steps / stepsPerBeat
+	}
+
+	// The conductor events are the tempo, time signature and the version
+	// which is kept in a text event.
+	tempo := uint32(math.Round(60e6 / float64(p.Header.Tempo)))
+	conductor := []midiEvent{
+		{0, []byte{0xff, 0x51, 3, byte(tempo >> 16), byte(tempo >> 8), byte(tempo)}},
+		{0, []byte{0xff, 0x58, 4, byte(beats), 2, 24, 8}},
+	}
+	if v := p.Header.version(); v != "" {
+		conductor = append(conductor, midiEvent{0, metaEvent(0x01, []byte(v))})
+	}
+
+	// tick returns the tick of a position in steps, a first step played
+	// early being moved to the start.
+	tick := func(position float64) uint32 {
+		return uint32(math.Max(0, math.Round(position*ticksPerBeat/float64(stepsPerBeat))))
+	}
+	end := tick(float64(loops * steps))
+
+	var tracks [][]midiEvent
+	for _, t := range p.Tracks {
+		note := opts.Note(t)
+		events := []midiEvent{
+			{0, metaEvent(0x03, []byte(t.Name))},
+
+			// The sequence number carries the track ID so it survives
+			// a round trip through a format 1 file.
+			{0, []byte{0xff, 0x00, 2, 0, t.ID}},
+		}
+		for step := 0; step < loops*steps; step++ {
+			v := t.Velocity(step % steps)
+			if v == 0 {
+				continue
+			}
+
+			// MIDI velocities only go up to 127.
+			velocity := v / 2
+			if velocity == 0 {
+				velocity = 1
+			}
+			events = append(events,
+				midiEvent{tick(p.position(step)), []byte{0x90 | drumChannel, note, velocity}},
+				midiEvent{tick(p.position(step + 1)), []byte{0x80 | drumChannel, note, 0}},
+			)
+		}
+
+		// The timing of the steps can move a note past the end of the
+		// one after it.
+		sort.SliceStable(events, func(i, j int) bool {
+			return events[i].tick < events[j].tick
+		})
+		tracks = append(tracks, events)
+	}
+
+	var chunks [][]midiEvent
+	if opts.Format == 0 {
+
+		// A single track holds everything but the per track meta events
+		// which only make sense in their own track.
+		merged := conductor
+		for _, events := range tracks {
+			merged = append(merged, events[2:]...)
+		}
+		sort.SliceStable(merged, func(i, j int) bool {
+			return merged[i].tick < merged[j].tick
+		})
+		chunks = [][]midiEvent{merged}
+	} else {
+		chunks = append([][]midiEvent{conductor}, tracks...)
+	}
+
+	bw := bufio.NewWriter(w)
+	header := struct {
+		ID       [4]byte
+		Length   uint32
+		Format   uint16
+		Tracks   uint16
+		Division uint16
+	}{
+		ID:       [4]byte{'M', 'T', 'h', 'd'},
+		Length:   6,
+		Format:   uint16(opts.Format),
+		Tracks:   uint16(len(chunks)),
+		Division: ticksPerBeat,
+	}
+	if err := binary.Write(bw, binary.BigEndian, header); err != nil {
+		return err
+	}
+	for _, events := range chunks {
+		if err := writeMIDITrack(bw, events, end); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// EncodeMIDIFile exports the pattern as a Standard MIDI File to the
+// provided path, creating or truncating it as needed.
+func EncodeMIDIFile(path string, p Pattern, opts MIDIOptions) error {
+	fd, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("os.Create failed for file: %s. Error: %v", path, err)
+	}
+
+	if err := EncodeMIDI(fd, p, opts); err != nil {
+		fd.Close()
+		return err
+	}
+
+	return fd.Close()
+}
+
+// writeMIDITrack writes the events, which must be in order, as an MTrk
+// chunk ending at the given tick.
+func writeMIDITrack(w io.Writer, events []midiEvent, end uint32) error {
+	var data bytes.Buffer
+	var last uint32
+	for _, e := range events {
+		writeVarLen(&data, e.tick-last)
+		data.Write(e.data)
+		last = e.tick
+	}
+	if end < last {
+		end = last
+	}
+	writeVarLen(&data, end-last)
+	data.Write([]byte{0xff, 0x2f, 0})
+
+	if _, err := w.Write([]byte("MTrk")); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, uint32(data.Len())); err != nil {
+		return err
+	}
+	_, err := data.WriteTo(w)
+	return err
+}
+
+// metaEvent builds a meta event holding the data.
+func metaEvent(kind byte, data []byte) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0xff, kind})
+	writeVarLen(&b, uint32(len(data)))
+	b.Write(data)
+	return b.Bytes()
+}
+
+// writeVarLen writes v as a MIDI variable length quantity, seven bits per
+// byte with the high bit set on all but the last byte.
+func writeVarLen(b *bytes.Buffer, v uint32) {
+	var buf [5]byte
+	i := len(buf) - 1
+	buf[i] = byte(v & 0x7f)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		buf[i] = byte(v&0x7f) | 0x80
+	}
+	b.Write(buf[i:])
+}
+
+// readVarLen reads a MIDI variable length quantity.
+func readVarLen(r io.ByteReader) (uint32, error) {
+	var v uint32
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<7 | uint32(b&0x7f)
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("drum: variable length quantity is too long")
+}
+
+// noteOn is a note found while importing a MIDI track.
+type noteOn struct {
+	tick     uint32
+	velocity uint8
+}
+
+// importedTrack collects the notes found while importing a MIDI track.
+type importedTrack struct {
+	name  string
+	id    int
+	notes map[uint8][]noteOn
+}
+
+// DecodeMIDI imports the notes on the percussion channel of a Standard MIDI
+// File into a pattern. Every note is quantized to the nearest of 16 steps
+// with all the bars of the file folded onto a single bar, keeping the
+// loudest velocity of the notes landing on a step. In format 1
+// files each MIDI track with notes becomes a track of the pattern, in
+// format 0 files each note becomes a track named from GMNotes. A file
+// without a tempo is played at 120 beats per minute, as MIDI files are.
+func DecodeMIDI(r io.Reader) (Pattern, error) {
+	var header struct {
+		ID       [4]byte
+		Length   uint32
+		Format   uint16
+		Tracks   uint16
+		Division uint16
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return Pattern{}, ErrNotMIDI
+	}
+	if string(header.ID[:]) != "MThd" || header.Length < 6 {
+		return Pattern{}, ErrNotMIDI
+	}
+	if header.Division&0x8000 != 0 || header.Division == 0 {
+		return Pattern{}, fmt.Errorf("drum: SMPTE time division is not supported")
+	}
+	if _, err := io.CopyN(ioutil.Discard, r, int64(header.Length-6)); err != nil {
+		return Pattern{}, ErrNotMIDI
+	}
+
+	var p Pattern
+	var tracks []importedTrack
+	for i := 0; i < int(header.Tracks); i++ {
+		var chunk struct {
+			ID     [4]byte
+			Length uint32
+		}
+		if err := binary.Read(r, binary.BigEndian, &chunk); err != nil {
+			return Pattern{}, fmt.Errorf("drum: reading MIDI track %d failed: %v", i, err)
+		}
+
+		// The length isn't trusted: only the data actually there is read.
+		data, err := ioutil.ReadAll(io.LimitReader(r, int64(chunk.Length)))
+		if err == nil && int64(len(data)) < int64(chunk.Length) {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return Pattern{}, fmt.Errorf("drum: reading MIDI track %d failed: %v", i, err)
+		}
+		if string(chunk.ID[:]) != "MTrk" {
+			continue
+		}
+
+		t, err := decodeMIDITrack(bytes.NewReader(data), &p.Header)
+		if err != nil {
+			return Pattern{}, fmt.Errorf("drum: decoding MIDI track %d failed: %v", i, err)
+		}
+		if len(t.notes) > 0 {
+			tracks = append(tracks, t)
+		}
+	}
+
+	if p.Header.Tempo == 0 {
+		p.Header.Tempo = defaultMIDITempo
+	}
+
+	stepTicks := float64(header.Division) / defaultStepsPerBeat
+	steps := p.steps()
+
+	// quantize places the notes on the steps of a track. A note played
+	// at the velocity exported for StepOn comes back as StepOn.
+	quantize := func(t *Track, notes []noteOn) {
+		for _, n := range notes {
+			step := int(math.Round(float64(n.tick)/stepTicks)) % steps
+			v := n.velocity * 2
+			if v == NormalVelocity {
+				v = StepOn
+			}
+			if v > t.Steps[step] {
+				t.Steps[step] = v
+			}
+		}
+	}
+
+	if header.Format == 1 {
+		for i, it := range tracks {
+			t := Track{ID: uint8(i), Name: it.name, Steps: make([]byte, steps)}
+			if it.id >= 0 {
+				t.ID = uint8(it.id)
+			}
+			for _, notes := range it.notes {
+				quantize(&t, notes)
+			}
+			p.Tracks = append(p.Tracks, t)
+		}
+		return p, nil
+	}
+
+	// Without a track per instrument the notes are grouped by their
+	// note number, in ascending order.
+	notes := map[uint8][]noteOn{}
+	for _, it := range tracks {
+		for n, on := range it.notes {
+			notes[n] = append(notes[n], on...)
+		}
+	}
+	var order []int
+	for n := range notes {
+		order = append(order, int(n))
+	}
+	sort.Ints(order)
+	for i, n := range order {
+		name, ok := gmNames[uint8(n)]
+		if !ok {
+			name = fmt.Sprintf("note-%d", n)
+		}
+		t := Track{ID: uint8(i), Name: name, Steps: make([]byte, steps)}
+		quantize(&t, notes[uint8(n)])
+		p.Tracks = append(p.Tracks, t)
+	}
+
+	return p, nil
+}
+
+// DecodeMIDIFile imports the Standard MIDI File found at the provided path.
+func DecodeMIDIFile(path string) (Pattern, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return Pattern{}, fmt.Errorf("os.Read failed for file: %s. Error: %v", path, err)
+	}
+	defer fd.Close()
+
+	return DecodeMIDI(bufio.NewReader(fd))
+}
+
+// decodeMIDITrack reads the events of a track, keeping the note on events
+// of the percussion channel and filling in the tempo and version of the
+// header from the meta events.
+func decodeMIDITrack(r *bytes.Reader, h *Header) (importedTrack, error) {
+	t := importedTrack{id: -1, notes: map[uint8][]noteOn{}}
+
+	var tick uint32
+	var status byte
+	for r.Len() > 0 {
+		delta, err := readVarLen(r)
+		if err != nil {
+			return t, err
+		}
+		tick += delta
+
+		b, err := r.ReadByte()
+		if err != nil {
+			return t, err
+		}
+
+		switch {
+		case b == 0xff:
+			kind, err := r.ReadByte()
+			if err != nil {
+				return t, err
+			}
+			length, err := readVarLen(r)
+			if err != nil {
+				return t, err
+			}
+			if int64(length) > int64(r.Len()) {
+				return t, io.ErrUnexpectedEOF
+			}
+			data := make([]byte, length)
+			r.Read(data)
+
+			switch {
+			case kind == 0x00 && length == 2:
+				t.id = int(data[1])
+			case kind == 0x01 && h.version() == "" && len(data) <= len(h.Version):
+				copy(h.Version[:], data)
+			case kind == 0x03:
+				t.name = string(data)
+			case kind == 0x51 && length == 3 && h.Tempo == 0:
+				us := uint32(data[0])<<16 | uint32(data[1])<<8 | uint32(data[2])
+				if us > 0 {
+					h.Tempo = float32(math.Round(60e6/float64(us)*10) / 10)
+				}
+			case kind == 0x2f:
+				return t, nil
+			}
+
+		case b == 0xf0 || b == 0xf7:
+
+			// System exclusive events are skipped.
+			length, err := readVarLen(r)
+			if err != nil {
+				return t, err
+			}
+			if _, err := r.Seek(int64(length), io.SeekCurrent); err != nil {
+				return t, err
+			}
+
+		default:
+
+			// Channel events may leave out the status byte when it is the
+			// same as the previous event.
+			var data1 byte
+			if b&0x80 != 0 {
+				status = b
+				if data1, err = r.ReadByte(); err != nil {
+					return t, err
+				}
+			} else {
+				if status == 0 {
+					return t, fmt.Errorf("running status without a previous status")
+				}
+				data1 = b
+			}
+
+			kind := status & 0xf0
+			if kind == 0xc0 || kind == 0xd0 {
+				continue
+			}
+			data2, err := r.ReadByte()
+			if err != nil {
+				return t, err
+			}
+			if kind == 0x90 && status&0x0f == drumChannel && data2 > 0 {
+				t.notes[data1] = append(t.notes[data1], noteOn{tick, data2})
+			}
+		}
+	}
+
+	return t, nil
+}
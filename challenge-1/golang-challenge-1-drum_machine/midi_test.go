@@ -0,0 +1,131 @@
+package drum
+
+import (
+	"bytes"
+	"path"
+	"testing"
+)
+
+func TestMIDIRoundTrip(t *testing.T) {
+	files := []string{
+		"pattern_1.splice",
+		"pattern_2.splice",
+		"pattern_3.splice",
+		"pattern_4.splice",
+		"pattern_5.splice",
+	}
+
+	for _, f := range files {
+		p, err := DecodeFile(path.Join("fixtures", f))
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", f, err)
+		}
+
+		var buf bytes.Buffer
+		if err := EncodeMIDI(&buf, p, MIDIOptions{Format: 1, Loops: 2}); err != nil {
+			t.Fatalf("something went wrong exporting %s - %v", f, err)
+		}
+		imported, err := DecodeMIDI(&buf)
+		if err != nil {
+			t.Fatalf("something went wrong importing %s - %v", f, err)
+		}
+
+		// Tracks which never play have no notes so they are not imported.
+		var expected Pattern
+		expected.Header = p.Header
+		for _, tr := range p.Tracks {
+			if !bytes.Equal(tr.Steps, make([]byte, 16)) {
+				expected.Tracks = append(expected.Tracks, tr)
+			}
+		}
+		if imported.String() != expected.String() {
+			t.Fatalf("%s changed after a MIDI round trip.\nGot:\n%s\nExpected:\n%s",
+				f, imported, expected)
+		}
+	}
+}
+
+func TestMIDIFormat0(t *testing.T) {
+	p, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeMIDI(&buf, p, MIDIOptions{}); err != nil {
+		t.Fatalf("something went wrong exporting - %v", err)
+	}
+
+	data := buf.Bytes()
+	header := []byte{'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 0, 0, 1, 0, 96, 'M', 'T', 'r', 'k'}
+	if !bytes.HasPrefix(data, header) {
+		t.Fatalf("unexpected MIDI header: %x", data[:len(header)])
+	}
+
+	// 120 BPM is 500000 microseconds per quarter note.
+	if !bytes.Contains(data, []byte{0xff, 0x51, 3, 0x07, 0xa1, 0x20}) {
+		t.Fatal("tempo meta event not found")
+	}
+
+	imported, err := DecodeMIDI(&buf)
+	if err != nil {
+		t.Fatalf("something went wrong importing - %v", err)
+	}
+
+	// Without per track names the tracks come back in note order named
+	// after their General MIDI instrument.
+	expected := `Saved with HW Version: 0.808-alpha
+Tempo: 120
+(0) kick	|x---|x---|x---|x---|
+(1) snare	|----|x---|----|x---|
+(2) clap	|----|x-x-|----|----|
+(3) hh-close	|x---|x---|----|x--x|
+(4) hh-open	|--x-|--x-|x-x-|--x-|
+(5) cowbell	|----|----|--x-|----|
+`
+	if imported.String() != expected {
+		t.Fatalf("format 0 file wasn't imported as expected.\nGot:\n%s\nExpected:\n%s",
+			imported, expected)
+	}
+}
+
+func TestDecodeMIDIHeader(t *testing.T) {
+	header := []byte{'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 0, 0, 1, 0, 96}
+
+	// A track with a single kick and no tempo meta event.
+	track := []byte{0, 0x99, 36, 64, 0, 0xff, 0x2f, 0}
+	data := append(append([]byte{}, header...), 'M', 'T', 'r', 'k', 0, 0, 0, byte(len(track)))
+	p, err := DecodeMIDI(bytes.NewReader(append(data, track...)))
+	if err != nil {
+		t.Fatalf("something went wrong importing - %v", err)
+	}
+	if p.Header.Tempo != 120 {
+		t.Fatalf("expected the default tempo of 120, got %v", p.Header.Tempo)
+	}
+
+	// The length of a track isn't trusted.
+	data = append(append([]byte{}, header...), 'M', 'T', 'r', 'k', 0xff, 0xff, 0xff, 0xff, 0)
+	if _, err := DecodeMIDI(bytes.NewReader(data)); err == nil {
+		t.Fatal("expected an error for a truncated track")
+	}
+}
+
+func TestMIDINotes(t *testing.T) {
+	tData := []struct {
+		track Track
+		notes map[string]uint8
+		note  uint8
+	}{
+		{Track{ID: 0, Name: "kick"}, nil, 36},
+		{Track{ID: 1, Name: "Kick"}, nil, 36},
+		{Track{ID: 255, Name: "Low Conga"}, nil, 64},
+		{Track{ID: 12, Name: "laser"}, nil, 47},
+		{Track{ID: 0, Name: "kick"}, map[string]uint8{"kick": 35}, 35},
+	}
+
+	for _, exp := range tData {
+		if n := (MIDIOptions{Notes: exp.notes}).Note(exp.track); n != exp.note {
+			t.Fatalf("%s: expected note %d, got %d", exp.track.Name, exp.note, n)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package drum
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	versionPrefix = "Saved with HW Version:"
+	tempoPrefix   = "Tempo:"
+	stepsPrefix   = "Steps:"
+	swingPrefix   = "Swing:"
+)
+
+// ParseError describes a problem found while parsing the text form of a
+// pattern. Lines and columns start at 1, columns count bytes.
+type ParseError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// ParsePattern parses the text produced by Pattern.String back into a
+// Pattern. An "x" is a step played with StepOn and an "X" an accent played
+// at AccentVelocity. Blank lines and lines starting with "#" or "//" are
+// ignored, as is anything following the last "|" of a track. Spaces and
+// tabs may be used freely around each part of a line. The text form holds
+// the swing of the pattern but not its step offsets.
+func ParsePattern(text string) (Pattern, error) {
+	var p Pattern
+	var haveVersion, haveTempo, haveSteps, haveSwing bool
+
+	for i, line := range strings.Split(text, "\n") {
+		n := i + 1
+		line = strings.TrimSuffix(line, "\r")
+
+		// col returns the column of the first byte of s within the line,
+		// s being a sub-slice of it.
+		col := func(s string) int {
+			return len(line) - len(s) + 1
+		}
+		trimmed := strings.TrimLeft(line, " \t")
+
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "//"):
+			continue
+
+		case hasPrefixFold(trimmed, versionPrefix):
+			if haveVersion {
+				return Pattern{}, &ParseError{n, col(trimmed), "version given more than once"}
+			}
+			v := strings.Trim(trimmed[len(versionPrefix):], " \t")
+			if len(v) > len(p.Header.Version) {
+				return Pattern{}, &ParseError{n, col(trimmed) + len(versionPrefix),
+					fmt.Sprintf("version is %d bytes, it can't be longer than %d", len(v), len(p.Header.Version))}
+			}
+			copy(p.Header.Version[:], v)
+			haveVersion = true
+
+		case hasPrefixFold(trimmed, tempoPrefix):
+			if haveTempo {
+				return Pattern{}, &ParseError{n, col(trimmed), "tempo given more than once"}
+			}
+			rest := trimmed[len(tempoPrefix):]
+			v := strings.Trim(rest, " \t")
+			tempo, err := strconv.ParseFloat(v, 32)
+			if err != nil {
+				return Pattern{}, &ParseError{n, col(strings.TrimLeft(rest, " \t")),
+					fmt.Sprintf("invalid tempo %q", v)}
+			}
+			p.Header.Tempo = float32(tempo)
+			haveTempo = true
+
+		case hasPrefixFold(trimmed, swingPrefix):
+			if haveSwing {
+				return Pattern{}, &ParseError{n, col(trimmed), "swing given more than once"}
+			}
+			rest := trimmed[len(swingPrefix):]
+			v := strings.Trim(strings.TrimSuffix(strings.Trim(rest, " \t"), "%"), " \t")
+			swing, err := strconv.ParseFloat(v, 32)
+			if err == nil {
+				p.Timing.Swing = float32(swing)
+				err = p.Timing.Validate()
+			}
+			if err != nil {
+				return Pattern{}, &ParseError{n, col(strings.TrimLeft(rest, " \t")),
+					fmt.Sprintf("invalid swing %q, expected a percentage from %d to %d", v, MinSwing, MaxSwing)}
+			}
+			haveSwing = true
+
+		case hasPrefixFold(trimmed, stepsPrefix):
+			if haveSteps || len(p.Tracks) > 0 {
+				return Pattern{}, &ParseError{n, col(trimmed), "steps must be given once, before the tracks"}
+			}
+			if err := parseSteps(trimmed[len(stepsPrefix):], &p.Header, col); err != nil {
+				err.Line = n
+				return Pattern{}, err
+			}
+			haveSteps = true
+
+		case strings.HasPrefix(trimmed, "("):
+			if !haveVersion || !haveTempo {
+				return Pattern{}, &ParseError{n, col(trimmed), "track found before the version and tempo"}
+			}
+			t, err := parseTrack(trimmed, p.Header.steps(), col)
+			if err != nil {
+				err.Line = n
+				return Pattern{}, err
+			}
+			p.Tracks = append(p.Tracks, t)
+
+		default:
+			return Pattern{}, &ParseError{n, col(trimmed),
+				fmt.Sprintf("expected %q, %q or a track", versionPrefix, tempoPrefix)}
+		}
+	}
+
+	if !haveVersion {
+		return Pattern{}, &ParseError{1, 1, "missing " + versionPrefix}
+	}
+	if !haveTempo {
+		return Pattern{}, &ParseError{1, 1, "missing " + tempoPrefix}
+	}
+
+	return p, nil
+}
+
+// parseSteps parses what follows "Steps:", the step count optionally
+// followed by the steps per beat, "12 (3 per beat)".
+func parseSteps(s string, h *Header, col func(string) int) *ParseError {
+	fields := strings.Fields(strings.NewReplacer("(", " ", ")", " ").Replace(s))
+	if len(fields) != 1 && (len(fields) != 4 || fields[2] != "per" || fields[3] != "beat") {
+		return &ParseError{0, col(s), `expected "Steps: <count>" or "Steps: <count> (<count> per beat)"`}
+	}
+
+	steps, err := strconv.Atoi(fields[0])
+	if err != nil || steps < 1 || steps > math.MaxUint16 {
+		return &ParseError{0, col(s), fmt.Sprintf("invalid step count %q", fields[0])}
+	}
+	h.Steps = steps
+
+	if len(fields) == 4 {
+		perBeat, err := strconv.Atoi(fields[1])
+		if err != nil || perBeat < 1 || perBeat > math.MaxUint8 {
+			return &ParseError{0, col(s), fmt.Sprintf("invalid steps per beat %q", fields[1])}
+		}
+		h.StepsPerBeat = perBeat
+	}
+
+	return nil
+}
+
+// parseTrack parses a track line, "(id) name |x---|x---|x---|x---|",
+// which must have the given number of steps. col gives the column of a
+// sub-slice of the line for errors.
+func parseTrack(s string, steps int, col func(string) int) (Track, *ParseError) {
+	t := Track{Steps: make([]byte, steps)}
+
+	end := strings.Index(s, ")")
+	if end < 0 {
+		return t, &ParseError{0, col(s), `missing ")" after the track ID`}
+	}
+	idText := strings.Trim(s[1:end], " \t")
+	id, err := strconv.ParseUint(idText, 10, 8)
+	if err != nil {
+		return t, &ParseError{0, col(s[1:]), fmt.Sprintf("track ID %q is not a number from 0 to 255", idText)}
+	}
+	t.ID = uint8(id)
+
+	rest := s[end+1:]
+	bar := strings.Index(rest, "|")
+	if bar < 0 {
+		return t, &ParseError{0, col(rest), `missing "|" before the steps`}
+	}
+	t.Name = strings.Trim(rest[:bar], " \t")
+	if t.Name == "" {
+		return t, &ParseError{0, col(rest), "missing track name"}
+	}
+
+	// Everything after the last "|" is a comment.
+	grid := rest[bar:]
+	last := strings.LastIndex(grid, "|")
+	grid = grid[:last+1]
+
+	step := 0
+	for i := 0; i < len(grid); i++ {
+		var v byte
+		switch grid[i] {
+		case '|', ' ', '\t':
+			continue
+		case 'x':
+			v = StepOn
+		case 'X':
+			v = AccentVelocity
+		case '-':
+			v = 0
+		default:
+			return t, &ParseError{0, col(grid[i:]), fmt.Sprintf("invalid step %q, expected \"x\", \"X\" or \"-\"", grid[i])}
+		}
+		if step == len(t.Steps) {
+			return t, &ParseError{0, col(grid[i:]), fmt.Sprintf("more than %d steps", len(t.Steps))}
+		}
+		t.Steps[step] = v
+		step++
+	}
+	if step != len(t.Steps) {
+		return t, &ParseError{0, col(grid[last:]), fmt.Sprintf("found %d steps, expected %d", step, len(t.Steps))}
+	}
+
+	return t, nil
+}
+
+// hasPrefixFold reports whether s begins with prefix without regard to case.
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
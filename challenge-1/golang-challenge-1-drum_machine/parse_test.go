@@ -0,0 +1,102 @@
+package drum
+
+import (
+	"bytes"
+	"path"
+	"testing"
+)
+
+func TestParsePatternRoundTrip(t *testing.T) {
+	files := []string{
+		"pattern_1.splice",
+		"pattern_2.splice",
+		"pattern_3.splice",
+		"pattern_4.splice",
+		"pattern_5.splice",
+	}
+
+	for _, f := range files {
+		decoded, err := DecodeFile(path.Join("fixtures", f))
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", f, err)
+		}
+
+		parsed, err := ParsePattern(decoded.String())
+		if err != nil {
+			t.Fatalf("something went wrong parsing %s - %v", f, err)
+		}
+
+		var want, got bytes.Buffer
+		if err := Encode(&want, decoded); err != nil {
+			t.Fatal(err)
+		}
+		if err := Encode(&got, parsed); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Fatalf("%s wasn't parsed as expected.\nGot:\n%s\nExpected:\n%s", f, parsed, decoded)
+		}
+	}
+}
+
+func TestParsePatternTolerant(t *testing.T) {
+	text := `# Edited by hand.
+  saved with hw version:   0.909
+TEMPO:240
+
+// The low end.
+(0) SubKick	|----|----|----|----|
+  ( 1 )   Kick   | x--- | ---- | x--- | ---- |   # four on the floor-ish
+(99) Maracas |x-x-x-x-x-x-x-x-|
+(255) Low Conga	|----|x---|----|x---|
+`
+	p, err := ParsePattern(text)
+	if err != nil {
+		t.Fatalf("something went wrong parsing - %v", err)
+	}
+
+	expected := `Saved with HW Version: 0.909
+Tempo: 240
+(0) SubKick	|----|----|----|----|
+(1) Kick	|x---|----|x---|----|
+(99) Maracas	|x-x-|x-x-|x-x-|x-x-|
+(255) Low Conga	|----|x---|----|x---|
+`
+	if p.String() != expected {
+		t.Fatalf("pattern wasn't parsed as expected.\nGot:\n%s\nExpected:\n%s", p, expected)
+	}
+}
+
+func TestParsePatternErrors(t *testing.T) {
+	header := "Saved with HW Version: 0.808-alpha\nTempo: 120\n"
+
+	tData := []struct {
+		text   string
+		line   int
+		column int
+	}{
+		{"Tempo: 120\n(0) kick\t|x---|x---|x---|x---|\n", 2, 1},
+		{"Saved with HW Version: 0.808-alpha\nTempo: fast\n", 2, 8},
+		{"Saved with HW Version: 0.808-alpha-0.808-alpha-0.808-alpha\n", 1, 23},
+		{header + "(0) kick\t|x---|x---|x?--|x---|\n", 3, 22},
+		{header + "(0) kick\t|x---|x---|x---|x--|\n", 3, 29},
+		{header + "(0) kick\t|x---|x---|x---|x---x|\n", 3, 30},
+		{header + "(256) kick\t|x---|x---|x---|x---|\n", 3, 2},
+		{header + "(1 kick\t|x---|x---|x---|x---|\n", 3, 1},
+		{header + "(1)\t|x---|x---|x---|x---|\n", 3, 4},
+		{header + "\n  kick\t|x---|x---|x---|x---|\n", 4, 3},
+		{"Saved with HW Version: 0.808-alpha\n", 1, 1},
+	}
+
+	for _, exp := range tData {
+		_, err := ParsePattern(exp.text)
+		perr, ok := err.(*ParseError)
+		if !ok {
+			t.Fatalf("%q: expected a *ParseError, got %v", exp.text, err)
+		}
+		if perr.Line != exp.line || perr.Column != exp.column {
+			t.Fatalf("%q: expected an error at line %d, column %d, got %v",
+				exp.text, exp.line, exp.column, perr)
+		}
+	}
+}
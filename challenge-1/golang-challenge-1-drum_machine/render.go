@@ -0,0 +1,191 @@
+package drum
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine/wav"
+)
+
+// defaultSampleRate is the sample rate of rendered audio when none is set.
+const defaultSampleRate = 44100
+
+// Instrument is the sound played when a track is triggered.
+type Instrument struct {
+	Sample wav.Audio
+
+	// Gain is applied to the sample in decibels, zero leaves the sample
+	// at its original level.
+	Gain float64
+}
+
+// Kit maps the tracks of a pattern to the instruments they play. Tracks
+// are looked up by name first and by ID second.
+type Kit struct {
+	Names map[string]Instrument
+	IDs   map[uint8]Instrument
+}
+
+// LoadKit loads every .wav file in dir into a Kit. Each file is named
+// after the track it is played for, "kick.wav" for the kick track, or after
+// the track ID, "99.wav" for track 99.
+func LoadKit(dir string) (Kit, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return Kit{}, err
+	}
+
+	kit := Kit{
+		Names: map[string]Instrument{},
+		IDs:   map[uint8]Instrument{},
+	}
+	for _, fi := range files {
+		ext := filepath.Ext(fi.Name())
+		if fi.IsDir() || !strings.EqualFold(ext, ".wav") {
+			continue
+		}
+
+		sample, err := wav.DecodeFile(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return Kit{}, err
+		}
+
+		name := strings.TrimSuffix(fi.Name(), ext)
+		if id, err := strconv.ParseUint(name, 10, 8); err == nil {
+			kit.IDs[uint8(id)] = Instrument{Sample: sample}
+			continue
+		}
+		kit.Names[name] = Instrument{Sample: sample}
+	}
+
+	return kit, nil
+}
+
+// instrument returns the instrument played by the track.
+func (k Kit) instrument(t Track) (Instrument, bool) {
+	if i, ok := k.Names[t.Name]; ok {
+		return i, true
+	}
+	i, ok := k.IDs[t.ID]
+	return i, ok
+}
+
+// RenderOptions controls how a pattern is rendered to audio.
+type RenderOptions struct {
+
+	// Loops is the number of times the pattern is played, at least once.
+	Loops int
+
+	// SampleRate of the rendered audio, 44100 Hz when zero.
+	SampleRate int
+}
+
+// Render mixes the instruments of the kit at the tempo of the pattern into
+// 16 bit stereo audio. Tracks with no instrument in the kit are silent. The
+// audio runs until the last sample played has finished.
+func Render(p Pattern, kit Kit, opts RenderOptions) (wav.Audio, error) {
+	if !(p.Header.Tempo > 0) {
+		return wav.Audio{}, ErrInvalidTempo
+	}
+
+	rate := opts.SampleRate
+	if rate <= 0 {
+		rate = defaultSampleRate
+	}
+	loops := opts.Loops
+	if loops < 1 {
+		loops = 1
+	}
+
+	// Steps are placed from their exact time rather than by adding up step
+	// lengths so rounding doesn't drift across the loops. A first step
+	// played early is moved to the start.
+	stepSeconds := p.Header.StepDuration().Seconds()
+	steps := p.steps()
+	offset := func(position float64) int {
+		return int(math.Max(0, math.Round(position*stepSeconds*float64(rate))))
+	}
+
+	out := wav.Audio{
+		SampleRate: rate,
+		Channels:   2,
+		Samples:    make([]float64, 2*offset(float64(loops*steps))),
+	}
+
+	for _, t := range p.Tracks {
+		inst, ok := kit.instrument(t)
+		if !ok {
+			continue
+		}
+		sample := stereo(inst.Sample, rate)
+		gain := math.Pow(10, inst.Gain/20)
+
+		for step := 0; step < loops*steps; step++ {
+			v := t.Velocity(step % steps)
+			if v == 0 {
+				continue
+			}
+			level := gain * float64(v) / NormalVelocity
+			start := 2 * offset(p.position(step))
+			if end := start + len(sample); end > len(out.Samples) {
+				out.Samples = append(out.Samples, make([]float64, end-len(out.Samples))...)
+			}
+			for i, s := range sample {
+				out.Samples[start+i] += s * level
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// RenderWAV renders the pattern and writes it to w as a WAV file.
+func RenderWAV(w io.Writer, p Pattern, kit Kit, opts RenderOptions) error {
+	audio, err := Render(p, kit, opts)
+	if err != nil {
+		return fmt.Errorf("Render failed: %v", err)
+	}
+	return wav.Encode(w, audio)
+}
+
+// stereo converts the sample to interleaved stereo at the given rate.
+// Mono samples are played on both channels, channels past the second are
+// dropped, and other rates are linearly resampled.
+func stereo(a wav.Audio, rate int) []float64 {
+	frames := a.Frames()
+	if frames == 0 || a.SampleRate <= 0 {
+		return nil
+	}
+
+	// frame returns the left and right values of the nth source frame.
+	frame := func(n int) (float64, float64) {
+		l := a.Samples[n*a.Channels]
+		if a.Channels == 1 {
+			return l, l
+		}
+		return l, a.Samples[n*a.Channels+1]
+	}
+
+	length := int(math.Ceil(float64(frames) * float64(rate) / float64(a.SampleRate)))
+	out := make([]float64, 2*length)
+	ratio := float64(a.SampleRate) / float64(rate)
+	for i := 0; i < length; i++ {
+		pos := float64(i) * ratio
+		n := int(pos)
+		l, r := frame(n)
+		if frac := pos - float64(n); frac > 0 && n+1 < frames {
+			nl, nr := frame(n + 1)
+			l += (nl - l) * frac
+			r += (nr - r) * frac
+		}
+		out[2*i] = l
+		out[2*i+1] = r
+	}
+
+	return out
+}
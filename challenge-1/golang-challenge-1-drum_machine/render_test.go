@@ -0,0 +1,125 @@
+package drum
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"math"
+	"path"
+	"testing"
+
+	"github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine/wav"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// testKit builds a kit of short synthetic samples so rendering can be
+// tested without sample files.
+func testKit(rate int) Kit {
+
+	// tone returns a decaying sine wave of the given frequency.
+	tone := func(freq float64, length int, channels int) wav.Audio {
+		a := wav.Audio{SampleRate: rate, Channels: channels}
+		for i := 0; i < length; i++ {
+			v := math.Sin(2*math.Pi*freq*float64(i)/float64(rate)) * float64(length-i) / float64(length)
+			for c := 0; c < channels; c++ {
+				a.Samples = append(a.Samples, v/float64(c+1))
+			}
+		}
+		return a
+	}
+
+	return Kit{
+		Names: map[string]Instrument{
+			"kick":  {Sample: tone(60, rate/4, 1)},
+			"snare": {Sample: tone(200, rate/8, 2), Gain: -6},
+		},
+		IDs: map[uint8]Instrument{
+			// pattern_1's hh-close.
+			4: {Sample: tone(1000, rate/16, 1), Gain: -12},
+		},
+	}
+}
+
+func TestRenderGolden(t *testing.T) {
+	tData := []struct {
+		pattern string
+		golden  string
+		loops   int
+	}{
+		{"pattern_1.splice", "pattern_1.wav", 1},
+		{"pattern_2.splice", "pattern_2.wav", 2},
+	}
+
+	for _, exp := range tData {
+		p, err := DecodeFile(path.Join("fixtures", exp.pattern))
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", exp.pattern, err)
+		}
+
+		var buf bytes.Buffer
+		opts := RenderOptions{Loops: exp.loops, SampleRate: 8000}
+		if err := RenderWAV(&buf, p, testKit(8000), opts); err != nil {
+			t.Fatalf("something went wrong rendering %s - %v", exp.pattern, err)
+		}
+
+		golden := path.Join("fixtures", "render", exp.golden)
+		if *update {
+			if err := ioutil.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := wav.Decode(&buf)
+		if err != nil {
+			t.Fatalf("rendered %s isn't a valid WAV - %v", exp.pattern, err)
+		}
+		want, err := wav.DecodeFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.Channels != 2 || got.SampleRate != 8000 {
+			t.Fatalf("%s: expected 8000 Hz stereo, got %d Hz with %d channels",
+				exp.pattern, got.SampleRate, got.Channels)
+		}
+		if len(got.Samples) != len(want.Samples) {
+			t.Fatalf("%s: expected %d samples, got %d", exp.pattern, len(want.Samples), len(got.Samples))
+		}
+
+		// Allow for a difference in the last bit from floating point
+		// rounding on other architectures.
+		for i := range got.Samples {
+			if math.Abs(got.Samples[i]-want.Samples[i]) > 1.0/32768 {
+				t.Fatalf("%s: sample %d is %v, expected %v", exp.pattern, i, got.Samples[i], want.Samples[i])
+			}
+		}
+	}
+}
+
+func TestRenderLength(t *testing.T) {
+	p := Pattern{
+		Header: Header{Tempo: 120},
+		Tracks: []Track{{ID: 0, Name: "kick", Steps: make([]byte, 16)}},
+	}
+
+	p.Tracks[0].Steps[0] = StepOn
+
+	// 16 steps at 120 BPM last two seconds.
+	audio, err := Render(p, Kit{}, RenderOptions{Loops: 3, SampleRate: 1000})
+	if err != nil {
+		t.Fatalf("something went wrong rendering - %v", err)
+	}
+	if audio.Frames() != 6000 {
+		t.Fatalf("expected 6000 frames, got %d", audio.Frames())
+	}
+	for _, s := range audio.Samples {
+		if s != 0 {
+			t.Fatal("expected silence without instruments")
+		}
+	}
+
+	if _, err := Render(Pattern{}, Kit{}, RenderOptions{}); err != ErrInvalidTempo {
+		t.Fatalf("expected %v, got %v", ErrInvalidTempo, err)
+	}
+}
@@ -0,0 +1,264 @@
+package drum
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrInvalidTempo is returned when a pattern can't be scheduled because its
+// tempo is not a positive number.
+var ErrInvalidTempo = errors.New("drum: tempo must be greater than zero")
+
+// StepDuration returns the length of a single step at the tempo of the
+// header, a 16th note unless StepsPerBeat says otherwise.
+func (h Header) StepDuration() time.Duration {
+	if !(h.Tempo > 0) {
+		return 0
+	}
+	beat := float64(time.Minute) / float64(h.Tempo)
+	return time.Duration(beat / float64(h.stepsPerBeat()))
+}
+
+// Clock is the source of time used by the Sequencer. It is swapped out in
+// tests so patterns can be played without sleeping.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the Clock backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Event is a single trigger emitted by the Sequencer.
+type Event struct {
+	Loop  int
+	Step  int
+	Track Track
+}
+
+// sequencer states.
+const (
+	stopped = iota
+	playing
+	paused
+)
+
+// Sequencer plays a pattern in real time, calling the trigger function for
+// every track which has a sound on the current step.
+type Sequencer struct {
+
+	// Loops is the number of times the pattern is played before the
+	// sequencer stops on its own. Zero loops forever.
+	Loops int
+
+	// Clock schedules the steps. The wall clock is used when it is nil.
+	Clock Clock
+
+	// Tick is called ClocksPerBeat times in each beat when both are set,
+	// so gear following the sequencer can keep its tempo. A tick due at
+	// the time of a step comes before the triggers of the step, and the
+	// ticks of the last bar are all sent before the sequencer stops.
+	Tick          func()
+	ClocksPerBeat int
+
+	pattern Pattern
+	trigger func(Event)
+
+	mu    sync.Mutex
+	state int
+	step  int
+	loop  int
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewSequencer is a factory function for Sequencer.
+func NewSequencer(p Pattern, trigger func(Event)) *Sequencer {
+	return &Sequencer{
+		pattern: p,
+		trigger: trigger,
+	}
+}
+
+// Start starts playing the pattern from the first step, or from where it
+// was paused. It does nothing if the sequencer is already playing.
+func (s *Sequencer) Start() error {
+	if !(s.pattern.Header.Tempo > 0) {
+		return ErrInvalidTempo
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == playing {
+		return nil
+	}
+	s.state = playing
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+
+	clock := s.Clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	go s.run(clock, s.stop, s.done)
+
+	return nil
+}
+
+// Pause stops playing but keeps the position so Start resumes from the
+// step following the last one played.
+func (s *Sequencer) Pause() {
+	s.halt(paused)
+}
+
+// Stop stops playing and rewinds to the first step of the first loop.
+func (s *Sequencer) Stop() {
+	s.halt(stopped)
+
+	s.mu.Lock()
+	s.step, s.loop = 0, 0
+	s.mu.Unlock()
+}
+
+// Wait blocks until the sequencer is no longer playing, either because
+// all the loops were played or because it was paused or stopped.
+func (s *Sequencer) Wait() {
+	s.mu.Lock()
+	done := s.done
+	s.mu.Unlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+// halt ends the running goroutine, if any, and moves to the given state.
+// It must not be called from the trigger function.
+func (s *Sequencer) halt(state int) {
+	s.mu.Lock()
+	if s.state != playing {
+		if s.state == paused {
+			s.state = state
+		}
+		s.mu.Unlock()
+		return
+	}
+	s.state = state
+	close(s.stop)
+	done := s.done
+	s.mu.Unlock()
+
+	<-done
+}
+
+// run emits the triggers for each step, and the ticks in between, until
+// the loops are played or the stop channel is closed.
+func (s *Sequencer) run(clock Clock, stop, done chan struct{}) {
+	defer close(done)
+
+	steps := s.pattern.steps()
+	bar := time.Duration(steps) * s.pattern.Header.StepDuration()
+	var tick float64
+	if s.Tick != nil && s.ClocksPerBeat > 0 {
+		tick = float64(time.Minute) / float64(s.pattern.Header.Tempo) / float64(s.ClocksPerBeat)
+	}
+
+	// Steps are scheduled against the start time rather than the previous
+	// step so the delay in emitting triggers doesn't accumulate. The start
+	// is that of the bar, so the first step played keeps its timing.
+	s.mu.Lock()
+	firstLoop := s.loop
+	offset := s.pattern.StepTime(s.step)
+	start := clock.Now().Add(-offset)
+	s.mu.Unlock()
+
+	// Ticks are counted from the start of the bar too, resuming with the
+	// first one due from the step played.
+	ticks := 0
+	if tick > 0 && offset > 0 {
+		ticks = int(math.Ceil(float64(offset) / tick))
+	}
+
+	for {
+		s.mu.Lock()
+		step, loop := s.step, s.loop
+		last := s.Loops > 0 && loop >= s.Loops
+		s.mu.Unlock()
+
+		// Once the loops are played the sequencer waits for the end of
+		// the last bar.
+		at := time.Duration(loop-firstLoop) * bar
+		if !last {
+			at += s.pattern.StepTime(step)
+		}
+
+		if tick > 0 {
+			tickAt := time.Duration(float64(ticks) * tick)
+			if tickAt < at || tickAt == at && !last {
+				if !wait(clock, stop, start.Add(tickAt)) {
+					return
+				}
+				s.Tick()
+				ticks++
+				continue
+			}
+		}
+
+		if !wait(clock, stop, start.Add(at)) {
+			return
+		}
+		if last {
+			s.mu.Lock()
+			s.state = stopped
+			s.step, s.loop = 0, 0
+			s.mu.Unlock()
+			return
+		}
+
+		for _, t := range s.pattern.Tracks {
+			if t.Velocity(step) > 0 {
+				s.trigger(Event{Loop: loop, Step: step, Track: t})
+			}
+		}
+
+		s.mu.Lock()
+		s.step++
+		if s.step == steps {
+			s.step = 0
+			s.loop++
+		}
+		s.mu.Unlock()
+	}
+}
+
+// wait blocks until the clock reaches the given time, returning false if
+// the stop channel is closed first. Times already passed don't wait.
+func wait(clock Clock, stop chan struct{}, at time.Time) bool {
+	d := at.Sub(clock.Now())
+	if d <= 0 {
+		select {
+		case <-stop:
+			return false
+		default:
+			return true
+		}
+	}
+
+	select {
+	case <-stop:
+		return false
+	case <-clock.After(d):
+		return true
+	}
+}
+
+// steps returns the number of steps in a bar of the pattern.
+func (p Pattern) steps() int {
+	return p.Header.steps()
+}
@@ -0,0 +1,211 @@
+package drum
+
+import (
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock fires every timer straight away, moving its time forward by
+// the requested duration.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func TestStepDuration(t *testing.T) {
+	tData := []struct {
+		tempo    float32
+		duration time.Duration
+	}{
+		{120, 125 * time.Millisecond},
+		{240, 62500 * time.Microsecond},
+		{60, 250 * time.Millisecond},
+		{0, 0},
+	}
+
+	for _, exp := range tData {
+		if d := (Header{Tempo: exp.tempo}).StepDuration(); d != exp.duration {
+			t.Fatalf("tempo %v: expected %v, got %v", exp.tempo, exp.duration, d)
+		}
+	}
+}
+
+func TestSequencer(t *testing.T) {
+	p, err := DecodeFile(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+
+	type trigger struct {
+		at   time.Time
+		loop int
+		step int
+		id   uint8
+	}
+	var got []trigger
+
+	clock := &fakeClock{}
+	seq := NewSequencer(p, func(e Event) {
+		got = append(got, trigger{clock.Now(), e.Loop, e.Step, e.Track.ID})
+	})
+	seq.Clock = clock
+	seq.Loops = 2
+
+	if err := seq.Start(); err != nil {
+		t.Fatalf("something went wrong starting - %v", err)
+	}
+	seq.Wait()
+
+	// pattern_2 has 10 hits per bar.
+	if len(got) != 20 {
+		t.Fatalf("expected 20 triggers, got %d: %v", len(got), got)
+	}
+
+	step := p.Header.StepDuration()
+	for _, g := range got {
+		at := time.Time{}.Add(time.Duration(g.loop*16+g.step) * step)
+		if !g.at.Equal(at) {
+			t.Fatalf("loop %d step %d triggered at %v, expected %v", g.loop, g.step, g.at, at)
+		}
+		var track Track
+		for _, tr := range p.Tracks {
+			if tr.ID == g.id {
+				track = tr
+			}
+		}
+		if track.Steps[g.step] != 1 {
+			t.Fatalf("track %d triggered on silent step %d", g.id, g.step)
+		}
+	}
+
+	first := got[:10]
+	if first[0].id != 0 || first[0].step != 0 {
+		t.Fatalf("expected the kick on the first step, got %+v", first[0])
+	}
+	if got[10].loop != 1 {
+		t.Fatalf("expected the second loop to start at trigger 10, got %+v", got[10])
+	}
+}
+
+func TestSequencerPause(t *testing.T) {
+	p, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+
+	var steps []int
+	var seq *Sequencer
+	paused := make(chan struct{})
+	seq = NewSequencer(p, func(e Event) {
+		if len(steps) == 0 || steps[len(steps)-1] != e.Step {
+			steps = append(steps, e.Step)
+		}
+		if e.Step == 4 && e.Loop == 0 && e.Track.ID == 0 {
+			go func() {
+				seq.Pause()
+				close(paused)
+			}()
+		}
+	})
+
+	// Hold the clock still after step 4 so the pause lands there.
+	seq.Clock = &stallingClock{fires: 4}
+	seq.Loops = 1
+
+	if err := seq.Start(); err != nil {
+		t.Fatalf("something went wrong starting - %v", err)
+	}
+	<-paused
+	if len(steps) == 0 || steps[len(steps)-1] != 4 {
+		t.Fatalf("expected to pause after step 4, got %v", steps)
+	}
+
+	// Resume with a clock that doesn't wait and play to the end.
+	seq.Clock = &fakeClock{}
+	if err := seq.Start(); err != nil {
+		t.Fatalf("something went wrong resuming - %v", err)
+	}
+	seq.Wait()
+
+	for i := 1; i < len(steps); i++ {
+		if steps[i] <= steps[i-1] {
+			t.Fatalf("steps were replayed after resuming: %v", steps)
+		}
+	}
+	if steps[len(steps)-1] != 15 {
+		t.Fatalf("expected to play to the last step, got %v", steps)
+	}
+}
+
+func TestSequencerInvalidTempo(t *testing.T) {
+	seq := NewSequencer(Pattern{}, func(Event) {})
+	if err := seq.Start(); err != ErrInvalidTempo {
+		t.Fatalf("expected %v, got %v", ErrInvalidTempo, err)
+	}
+}
+
+// stallingClock fires straight away a number of times and then never
+// fires again.
+type stallingClock struct {
+	fakeClock
+	fires int
+}
+
+func (c *stallingClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	stalled := c.fires <= 0
+	c.fires--
+	c.mu.Unlock()
+
+	if stalled {
+		return nil
+	}
+	return c.fakeClock.After(d)
+}
+
+func TestSequencerTicks(t *testing.T) {
+	p := Pattern{
+		Header: Header{Tempo: 120, Steps: 4, StepsPerBeat: 2},
+		Tracks: []Track{{ID: 1, Steps: []byte{1, 0, 1, 0}}},
+	}
+
+	var got []string
+	seq := NewSequencer(p, func(e Event) {
+		got = append(got, "step")
+	})
+	seq.Clock = &fakeClock{}
+	seq.Loops = 1
+	seq.ClocksPerBeat = 2
+	seq.Tick = func() {
+		got = append(got, "tick")
+	}
+
+	if err := seq.Start(); err != nil {
+		t.Fatalf("something went wrong starting - %v", err)
+	}
+	seq.Wait()
+
+	// Two beats with a tick on every step, before its triggers.
+	expected := "tick step tick tick step tick"
+	if strings.Join(got, " ") != expected {
+		t.Fatalf("expected %q, got %q", expected, strings.Join(got, " "))
+	}
+}
@@ -0,0 +1,257 @@
+// Package server serves the decoding, encoding and rendering of .splice drum
+// patterns over HTTP.
+//
+// The endpoints all take a POST request:
+//
+//	/decode           a .splice file, returns the pattern as JSON
+//	/encode           a pattern as JSON, returns a .splice file
+//	/render?to=text   a .splice file or JSON pattern, returns the grid text
+//	/render?to=midi   a .splice file or JSON pattern, returns a MIDI file
+//
+// Files are sent as the body of the request or as the "file" field of a
+// multipart form. Errors are returned as JSON objects with an "error" field.
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	drum "github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine"
+)
+
+// DefaultMaxUpload is the largest request body accepted by a new Server.
+const DefaultMaxUpload = 1 << 20
+
+// Server handles the HTTP requests.
+type Server struct {
+
+	// MaxUpload is the largest request body in bytes.
+	MaxUpload int64
+
+	// Limits bounds the patterns decoded from uploads, its MaxSize is
+	// lowered to MaxUpload.
+	Limits drum.Limits
+
+	// Registry checks every uploaded pattern, whether sent as a .splice
+	// file or as JSON, against the rules of its hardware version.
+	// Patterns aren't checked when it is nil, as for a new Server.
+	Registry *drum.Registry
+
+	mux *http.ServeMux
+}
+
+// New is a factory function for Server.
+func New() *Server {
+	s := &Server{
+		MaxUpload: DefaultMaxUpload,
+		Limits:    drum.DefaultLimits,
+		mux:       http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/decode", s.post(s.decode))
+	s.mux.HandleFunc("/encode", s.post(s.encode))
+	s.mux.HandleFunc("/render", s.post(s.render))
+	return s
+}
+
+// ServeHTTP implements the http.Handler interface for Server.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// httpError is an error with the status code it is returned with.
+type httpError struct {
+	code int
+	err  error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+// post wraps a handler accepting POST requests with a limited body, and
+// writes the error it returns.
+func (s *Server) post(h func(w http.ResponseWriter, r *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, &httpError{http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method)})
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, s.MaxUpload)
+		if err := h(w, r); err != nil {
+			writeError(w, err)
+		}
+	}
+}
+
+// writeError writes the error as JSON with its status code.
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	var he *httpError
+	if errors.As(err, &he) {
+		code = he.code
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
+// decodeStatus returns the status code for an error decoding an upload.
+func decodeStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge), errors.Is(err, drum.ErrLimit):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, drum.ErrBadMagic):
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
+
+// upload returns the file sent with the request and its content type.
+func upload(r *http.Request) (io.Reader, string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, mediaType, nil
+	}
+
+	f, fh, err := r.FormFile("file")
+	if err != nil {
+		code := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		return nil, "", &httpError{code, fmt.Errorf("reading the file field failed: %w", err)}
+	}
+	mediaType, _, _ = mime.ParseMediaType(fh.Header.Get("Content-Type"))
+	return f, mediaType, nil
+}
+
+// readSplice decodes the .splice file sent with the request.
+func (s *Server) readSplice(r io.Reader) (drum.Pattern, error) {
+	d := drum.NewDecoder(r)
+	d.Limits = s.Limits
+	if d.Limits.MaxSize == 0 || d.Limits.MaxSize > s.MaxUpload {
+		d.Limits.MaxSize = s.MaxUpload
+	}
+
+	p, err := d.Decode()
+	if err == io.EOF {
+		err = drum.ErrBadMagic
+	}
+	if err != nil {
+		return drum.Pattern{}, &httpError{decodeStatus(err), err}
+	}
+	return p, s.check(p)
+}
+
+// readJSON decodes the JSON pattern sent with the request.
+func (s *Server) readJSON(r io.Reader) (drum.Pattern, error) {
+	var p drum.Pattern
+	if err := json.NewDecoder(r).Decode(&p); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return drum.Pattern{}, &httpError{http.StatusRequestEntityTooLarge, err}
+		}
+		return drum.Pattern{}, &httpError{http.StatusBadRequest, fmt.Errorf("invalid pattern: %v", err)}
+	}
+	return p, s.check(p)
+}
+
+// check checks an uploaded pattern against the Registry.
+func (s *Server) check(p drum.Pattern) error {
+	if s.Registry == nil {
+		return nil
+	}
+	if err := s.Registry.Validate(p); err != nil {
+		return &httpError{http.StatusUnprocessableEntity, err}
+	}
+	return nil
+}
+
+// decode returns the uploaded .splice file as JSON.
+func (s *Server) decode(w http.ResponseWriter, r *http.Request) error {
+	body, _, err := upload(r)
+	if err != nil {
+		return err
+	}
+	p, err := s.readSplice(body)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(p)
+}
+
+// encode returns the uploaded JSON pattern as a .splice file.
+func (s *Server) encode(w http.ResponseWriter, r *http.Request) error {
+	body, _, err := upload(r)
+	if err != nil {
+		return err
+	}
+	p, err := s.readJSON(body)
+	if err != nil {
+		return err
+	}
+
+	// The pattern is encoded before anything is written so encoding
+	// errors can still be returned with their status code.
+	var buf bytes.Buffer
+	if err := drum.Encode(&buf, p); err != nil {
+		return &httpError{http.StatusUnprocessableEntity, err}
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="pattern.splice"`)
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// render returns the uploaded pattern, as a .splice file or JSON, in the
+// format given by the "to" parameter.
+func (s *Server) render(w http.ResponseWriter, r *http.Request) error {
+	to := r.URL.Query().Get("to")
+	if to != "text" && to != "midi" {
+		return &httpError{http.StatusBadRequest, fmt.Errorf("unknown format %q, expected text or midi", to)}
+	}
+
+	body, mediaType, err := upload(r)
+	if err != nil {
+		return err
+	}
+	var p drum.Pattern
+	if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		p, err = s.readJSON(body)
+	} else {
+		p, err = s.readSplice(body)
+	}
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	contentType := "text/plain; charset=utf-8"
+	if to == "midi" {
+		contentType = "audio/midi"
+		err = drum.EncodeMIDI(&buf, p, drum.MIDIOptions{Format: 1})
+	} else {
+		buf.WriteString(p.String())
+	}
+	if err != nil {
+		return &httpError{http.StatusUnprocessableEntity, err}
+	}
+	w.Header().Set("Content-Type", contentType)
+	_, err = buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	drum "github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine"
+)
+
+const fixtures = "../fixtures"
+
+func fixture(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join(fixtures, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecodeEncode(t *testing.T) {
+	ts := httptest.NewServer(New())
+	defer ts.Close()
+
+	original, err := drum.DecodeFile(filepath.Join(fixtures, "pattern_3.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+
+	res, err := http.Post(ts.URL+"/decode", "application/octet-stream", bytes.NewReader(fixture(t, "pattern_3.splice")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response %s with %s", res.Status, res.Header.Get("Content-Type"))
+	}
+	var p drum.Pattern
+	if err := json.NewDecoder(res.Body).Decode(&p); err != nil {
+		t.Fatalf("something went wrong reading the JSON - %v", err)
+	}
+	if p.String() != original.String() {
+		t.Fatalf("unexpected pattern.\nGot:\n%s\nExpected:\n%s", p, original)
+	}
+
+	// And back to a .splice file.
+	b, _ := json.Marshal(p)
+	res, err = http.Post(ts.URL+"/encode", "application/json", bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected response %s", res.Status)
+	}
+	data, _ := ioutil.ReadAll(res.Body)
+	if !bytes.Equal(data, fixture(t, "pattern_3.splice")) {
+		t.Fatalf("encoded file differs from the fixture")
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", "pattern_2.splice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(fixture(t, "pattern_2.splice"))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/render?to=text", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	New().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+	expected := `Saved with HW Version: 0.808-alpha
+Tempo: 98.4
+(0) kick	|x---|----|x---|----|
+(1) snare	|----|x---|----|x---|
+(3) hh-open	|--x-|--x-|x-x-|--x-|
+(5) cowbell	|----|----|x---|----|
+`
+	if rec.Body.String() != expected {
+		t.Fatalf("unexpected text.\nGot:\n%s\nExpected:\n%s", rec.Body.String(), expected)
+	}
+}
+
+func TestRenderMIDI(t *testing.T) {
+	p, err := drum.DecodeFile(filepath.Join(fixtures, "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	b, _ := json.Marshal(p)
+
+	req := httptest.NewRequest(http.MethodPost, "/render?to=midi", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	New().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "audio/midi" {
+		t.Fatalf("unexpected response %d with %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	got, err := drum.DecodeMIDI(rec.Body)
+	if err != nil {
+		t.Fatalf("something went wrong reading the MIDI file - %v", err)
+	}
+	if len(got.Tracks) != len(p.Tracks) {
+		t.Fatalf("expected %d tracks, got %d", len(p.Tracks), len(got.Tracks))
+	}
+}
+
+func TestErrors(t *testing.T) {
+	original := fixture(t, "pattern_1.splice")
+	small := New()
+	small.MaxUpload = 100
+	checked := New()
+	checked.Registry = drum.DefaultRegistry
+	tooFast := `{"version":"0.808-alpha","tempo":400}`
+
+	tData := []struct {
+		name   string
+		server *Server
+		method string
+		url    string
+		ctype  string
+		body   string
+		code   int
+	}{
+		{"method", New(), http.MethodGet, "/decode", "", "", http.StatusMethodNotAllowed},
+		{"bad magic", New(), http.MethodPost, "/decode", "", "SPLICY", http.StatusUnsupportedMediaType},
+		{"empty", New(), http.MethodPost, "/decode", "", "", http.StatusUnsupportedMediaType},
+		{"truncated", New(), http.MethodPost, "/decode", "", string(original[:100]), http.StatusUnprocessableEntity},
+		{"too large", small, http.MethodPost, "/decode", "", string(original), http.StatusRequestEntityTooLarge},
+		{"json too large", small, http.MethodPost, "/encode", "application/json", `{"tracks":[` + strings.Repeat(" ", 200) + `]}`, http.StatusRequestEntityTooLarge},
+		{"bad json", New(), http.MethodPost, "/encode", "application/json", `{"tempo":`, http.StatusBadRequest},
+		{"bad steps", New(), http.MethodPost, "/encode", "application/json", `{"tracks":[{"id":1,"steps":"x-x"}]}`, http.StatusBadRequest},
+		{"out of range", checked, http.MethodPost, "/encode", "application/json", tooFast, http.StatusUnprocessableEntity},
+		{"out of range render", checked, http.MethodPost, "/render?to=text", "application/json", tooFast, http.StatusUnprocessableEntity},
+		{"unknown version", checked, http.MethodPost, "/decode", "", string(fixture(t, "malformed/unknown_version.splice")), http.StatusUnprocessableEntity},
+		{"unknown version render", checked, http.MethodPost, "/render?to=text", "", string(fixture(t, "malformed/unknown_version.splice")), http.StatusUnprocessableEntity},
+		{"unknown format", New(), http.MethodPost, "/render?to=flac", "", string(original), http.StatusBadRequest},
+		{"missing file", New(), http.MethodPost, "/decode", "multipart/form-data; boundary=x", "--x--\r\n", http.StatusBadRequest},
+		{"not found", New(), http.MethodPost, "/play", "", "", http.StatusNotFound},
+	}
+
+	for _, exp := range tData {
+		req := httptest.NewRequest(exp.method, exp.url, strings.NewReader(exp.body))
+		if exp.ctype != "" {
+			req.Header.Set("Content-Type", exp.ctype)
+		}
+		rec := httptest.NewRecorder()
+		exp.server.ServeHTTP(rec, req)
+
+		if rec.Code != exp.code {
+			t.Fatalf("%s: expected status %d, got %d: %s", exp.name, exp.code, rec.Code, rec.Body.String())
+		}
+		if exp.code != http.StatusNotFound && !strings.Contains(rec.Body.String(), `"error":`) {
+			t.Fatalf("%s: expected a JSON error, got %s", exp.name, rec.Body.String())
+		}
+	}
+}
+
+func TestRegistryOptIn(t *testing.T) {
+
+	// Without a registry, patterns breaking the rules of their version
+	// are still served.
+	for _, body := range []string{
+		`{"version":"0.808-alpha","tempo":400}`,
+		string(fixture(t, "malformed/unknown_version.splice")),
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/render?to=text", strings.NewReader(body))
+		if strings.HasPrefix(body, "{") {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		rec := httptest.NewRecorder()
+		New().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+	}
+}
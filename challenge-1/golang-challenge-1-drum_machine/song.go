@@ -0,0 +1,294 @@
+package drum
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Song arranges patterns, each one bar long, into sections played one after
+// the other.
+type Song struct {
+	Title    string
+	Patterns []SongPattern
+	Sections []Section
+}
+
+// SongPattern is a pattern used by the sections of a song.
+type SongPattern struct {
+
+	// Name is how the sections refer to the pattern.
+	Name string
+
+	// File is the file the pattern is read from, relative to the song
+	// file. The pattern is embedded in the song file when it is empty.
+	File string
+
+	Pattern Pattern
+}
+
+// Section plays a pattern of the song one or more times.
+type Section struct {
+
+	// Pattern is the name of the pattern played.
+	Pattern string
+
+	// Repeat is the number of times the pattern is played, once when
+	// zero.
+	Repeat int
+
+	// Tempo overrides the tempo of the pattern when it isn't zero.
+	Tempo float32
+}
+
+// repeat returns the number of times the section is played.
+func (s Section) repeat() int {
+	if s.Repeat <= 0 {
+		return 1
+	}
+	return s.Repeat
+}
+
+// pattern returns the pattern with the given name.
+func (s Song) pattern(name string) (Pattern, error) {
+	for _, sp := range s.Patterns {
+		if sp.Name == name {
+			return sp.Pattern, nil
+		}
+	}
+	return Pattern{}, fmt.Errorf("drum: song has no pattern named %q", name)
+}
+
+// Validate checks that pattern names are unique and that every section
+// plays a pattern of the song at a valid tempo.
+func (s Song) Validate() error {
+	names := map[string]bool{}
+	for _, sp := range s.Patterns {
+		if names[sp.Name] {
+			return fmt.Errorf("drum: song has more than one pattern named %q", sp.Name)
+		}
+		names[sp.Name] = true
+	}
+
+	for i, sec := range s.Sections {
+		if !names[sec.Pattern] {
+			return fmt.Errorf("drum: section %d: song has no pattern named %q", i+1, sec.Pattern)
+		}
+		if sec.Tempo != 0 && !(sec.Tempo > 0) {
+			return fmt.Errorf("drum: section %d: %w: %v", i+1, ErrInvalidTempo, sec.Tempo)
+		}
+	}
+	return nil
+}
+
+// SectionPattern returns the pattern of the section with its tempo
+// override applied.
+func (s Song) SectionPattern(i int) (Pattern, error) {
+	if i < 0 || i >= len(s.Sections) {
+		return Pattern{}, fmt.Errorf("drum: section %d is out of range, the song has %d", i+1, len(s.Sections))
+	}
+	sec := s.Sections[i]
+	p, err := s.pattern(sec.Pattern)
+	if err != nil {
+		return Pattern{}, err
+	}
+	p = p.Clone()
+	if sec.Tempo != 0 {
+		p.Header.Tempo = sec.Tempo
+	}
+	return p, nil
+}
+
+// Bars returns every bar of the song in order, repeats included.
+func (s Song) Bars() ([]Pattern, error) {
+	var bars []Pattern
+	for i, sec := range s.Sections {
+		p, err := s.SectionPattern(i)
+		if err != nil {
+			return nil, err
+		}
+		for r := 0; r < sec.repeat(); r++ {
+			bars = append(bars, p)
+		}
+	}
+	return bars, nil
+}
+
+// Flatten joins the bars of the song into a single pattern with Concat. The
+// tempo of the first section is kept, later tempo changes are lost.
+func (s Song) Flatten() (Pattern, error) {
+	bars, err := s.Bars()
+	if err != nil {
+		return Pattern{}, err
+	}
+	return Concat(bars...)
+}
+
+// String prints the sections of the song followed by its whole timeline,
+// the tracks of every pattern on one line each in the grid format.
+func (s Song) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Song: %s\n", s.Title)
+
+	bar := 1
+	for i, sec := range s.Sections {
+		p, err := s.SectionPattern(i)
+		if err != nil {
+			fmt.Fprintf(&sb, "invalid song: %v\n", err)
+			return sb.String()
+		}
+
+		bars := fmt.Sprintf("Bar %d", bar)
+		if sec.repeat() > 1 {
+			bars = fmt.Sprintf("Bars %d-%d", bar, bar+sec.repeat()-1)
+		}
+		fmt.Fprintf(&sb, "%s: %s (Tempo: %s)\n", bars, sec.Pattern, formatTempo(p.Header.Tempo))
+		bar += sec.repeat()
+	}
+
+	timeline, err := s.Flatten()
+	if err != nil {
+		fmt.Fprintf(&sb, "invalid song: %v\n", err)
+		return sb.String()
+	}
+	for _, t := range timeline.Tracks {
+		sb.WriteString(t.format(timeline.Header.stepsPerBeat()))
+	}
+	return sb.String()
+}
+
+// songData is the JSON form of a Song, which is the song file format.
+type songData struct {
+	Title    string            `json:"title,omitempty"`
+	Patterns []songPatternData `json:"patterns"`
+	Sections []sectionData     `json:"sections"`
+}
+
+// songPatternData is the JSON form of a SongPattern. Only the file name is
+// kept for patterns read from a file.
+type songPatternData struct {
+	Name    string   `json:"name"`
+	File    string   `json:"file,omitempty"`
+	Pattern *Pattern `json:"pattern,omitempty"`
+}
+
+// sectionData is the JSON form of a Section.
+type sectionData struct {
+	Pattern string  `json:"pattern"`
+	Repeat  int     `json:"repeat,omitempty"`
+	Tempo   float32 `json:"tempo,omitempty"`
+}
+
+// MarshalJSON implements the json.Marshaler interface for Song.
+func (s Song) MarshalJSON() ([]byte, error) {
+	d := songData{
+		Title:    s.Title,
+		Patterns: []songPatternData{},
+		Sections: []sectionData{},
+	}
+	for _, sp := range s.Patterns {
+		pd := songPatternData{Name: sp.Name, File: sp.File}
+		if sp.File == "" {
+			p := sp.Pattern
+			pd.Pattern = &p
+		}
+		d.Patterns = append(d.Patterns, pd)
+	}
+	for _, sec := range s.Sections {
+		d.Sections = append(d.Sections, sectionData(sec))
+	}
+	return json.Marshal(d)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for Song. The
+// patterns read from files are left empty, see LoadSong.
+func (s *Song) UnmarshalJSON(b []byte) error {
+	var d songData
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+
+	song := Song{Title: d.Title}
+	for _, pd := range d.Patterns {
+		sp := SongPattern{Name: pd.Name, File: pd.File}
+		switch {
+		case pd.File == "" && pd.Pattern == nil:
+			return fmt.Errorf("drum: song pattern %q has neither a file nor a pattern", pd.Name)
+		case pd.File != "" && pd.Pattern != nil:
+			return fmt.Errorf("drum: song pattern %q has both a file and a pattern", pd.Name)
+		case pd.Pattern != nil:
+			sp.Pattern = *pd.Pattern
+		}
+		song.Patterns = append(song.Patterns, sp)
+	}
+	for _, sd := range d.Sections {
+		song.Sections = append(song.Sections, Section(sd))
+	}
+
+	*s = song
+	return nil
+}
+
+// LoadSong reads a song file and the pattern files it refers to.
+func LoadSong(path string) (Song, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Song{}, err
+	}
+	var s Song
+	if err := json.Unmarshal(b, &s); err != nil {
+		return Song{}, fmt.Errorf("drum: reading song %s failed: %v", path, err)
+	}
+
+	for i, sp := range s.Patterns {
+		if sp.File == "" {
+			continue
+		}
+		file := sp.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(path), file)
+		}
+		p, err := LoadPattern(file)
+		if err != nil {
+			return Song{}, fmt.Errorf("drum: song pattern %q: %v", sp.Name, err)
+		}
+		s.Patterns[i].Pattern = p
+	}
+
+	if err := s.Validate(); err != nil {
+		return Song{}, err
+	}
+	return s, nil
+}
+
+// SaveSong writes the song file. The patterns read from files are only
+// referred to and are not written back.
+func SaveSong(path string, s Song) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// LoadPattern reads a pattern from a .splice, text or MIDI file depending on
+// its extension.
+func LoadPattern(path string) (Pattern, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".txt":
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return Pattern{}, err
+		}
+		return ParsePattern(string(data))
+	case ".mid", ".midi":
+		return DecodeMIDIFile(path)
+	default:
+		return DecodeFile(path)
+	}
+}
@@ -0,0 +1,116 @@
+package drum
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadSong(t *testing.T) {
+	s, err := LoadSong(path.Join("fixtures", "songs", "demo.song"))
+	if err != nil {
+		t.Fatalf("something went wrong loading - %v", err)
+	}
+
+	expected := `Song: Demo
+Bars 1-2: groove (Tempo: 98.4)
+Bar 3: fill (Tempo: 120)
+(0) kick	|x---|----|x---|----|x---|----|x---|----|----|----|
+(1) snare	|----|x---|----|x---|----|x---|----|x---|x-x-|xxXX|
+(3) hh-open	|--x-|--x-|x-x-|--x-|--x-|--x-|x-x-|--x-|----|----|
+(5) cowbell	|----|----|x---|----|----|----|x---|----|----|----|
+`
+	if s.String() != expected {
+		t.Fatalf("song wasn't loaded as expected.\nGot:\n%s\nExpected:\n%s", s, expected)
+	}
+
+	bars, err := s.Bars()
+	if err != nil {
+		t.Fatalf("something went wrong - %v", err)
+	}
+	if len(bars) != 3 || bars[0].Header.Tempo != float32(98.4) || bars[2].Header.Tempo != 120 {
+		t.Fatalf("unexpected bars: %v", bars)
+	}
+}
+
+func TestSaveSong(t *testing.T) {
+	s, err := LoadSong(path.Join("fixtures", "songs", "demo.song"))
+	if err != nil {
+		t.Fatalf("something went wrong loading - %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "drum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The pattern file is copied so the saved song can refer to it.
+	p, err := DecodeFile(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	if err := EncodeFile(filepath.Join(dir, "groove.splice"), p); err != nil {
+		t.Fatalf("something went wrong encoding - %v", err)
+	}
+	s.Patterns[0].File = "groove.splice"
+
+	file := filepath.Join(dir, "demo.song")
+	if err := SaveSong(file, s); err != nil {
+		t.Fatalf("something went wrong saving - %v", err)
+	}
+	saved, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(saved), "hh-open") {
+		t.Fatalf("a pattern read from a file was embedded:\n%s", saved)
+	}
+
+	got, err := LoadSong(file)
+	if err != nil {
+		t.Fatalf("something went wrong loading - %v", err)
+	}
+	if got.String() != s.String() {
+		t.Fatalf("song changed saving it.\nGot:\n%s\nExpected:\n%s", got, s)
+	}
+
+	// A song which isn't valid isn't returned.
+	if err := ioutil.WriteFile(file, []byte(`{"title":"Bad","patterns":[{"name":"groove","file":"groove.splice"}],"sections":[{"pattern":"verse"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err = LoadSong(file)
+	if err == nil || got.Title != "" || got.Patterns != nil {
+		t.Fatalf("expected an error and no song, got %v and %+v", err, got)
+	}
+}
+
+func TestSongErrors(t *testing.T) {
+	fill := SongPattern{Name: "fill", Pattern: Pattern{Tracks: []Track{{ID: 1, Steps: make([]byte, 16)}}}}
+
+	tData := []struct {
+		song Song
+		msg  string
+	}{
+		{Song{Patterns: []SongPattern{fill, fill}}, "more than one pattern"},
+		{Song{Patterns: []SongPattern{fill}, Sections: []Section{{Pattern: "verse"}}}, "no pattern named \"verse\""},
+		{Song{Patterns: []SongPattern{fill}, Sections: []Section{{Pattern: "fill", Tempo: -1}}}, "tempo"},
+		{Song{Patterns: []SongPattern{fill}, Sections: []Section{{Pattern: "fill", Tempo: float32(math.NaN())}}}, "tempo"},
+	}
+
+	for i, exp := range tData {
+		err := exp.song.Validate()
+		if err == nil || !strings.Contains(err.Error(), exp.msg) {
+			t.Fatalf("song %d: expected an error containing %q, got %v", i, exp.msg, err)
+		}
+	}
+
+	var s Song
+	if err := s.UnmarshalJSON([]byte(`{"patterns":[{"name":"fill"}]}`)); err == nil {
+		t.Fatalf("expected an error for a pattern without file or pattern")
+	}
+}
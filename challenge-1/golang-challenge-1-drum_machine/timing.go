@@ -0,0 +1,160 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrInvalidTiming is returned when the swing or the step offsets of a
+// pattern are out of range.
+var ErrInvalidTiming = errors.New("drum: invalid timing")
+
+const (
+	// MinSwing and MaxSwing bound the swing of a pattern. MinSwing plays
+	// straight and MaxSwing turns each pair of steps into a dotted note
+	// and the following short one.
+	MinSwing = 50
+	MaxSwing = 75
+
+	// MaxOffset bounds the step offsets, which can't move a step further
+	// than half way to its neighbours.
+	MaxOffset = 0.5
+)
+
+// Timing moves the steps of a pattern off the grid. The zero value plays
+// straight.
+type Timing struct {
+
+	// Swing delays every second step. It is the share of each pair of
+	// steps taken by the first one, in percent: 50 plays straight and 66.7
+	// plays triplets. Zero leaves the swing unset, which also plays
+	// straight, while an explicit 50 is saved with the pattern.
+	Swing float32
+
+	// Offsets moves each step by a fraction of a step, later when
+	// positive, on top of the swing. Steps past the end of Offsets aren't
+	// moved.
+	Offsets []float32
+}
+
+// IsZero reports whether the timing is unset, without a swing and with
+// every step on the grid. It doesn't need to be saved then.
+func (t Timing) IsZero() bool {
+	if t.Swing != 0 {
+		return false
+	}
+	for _, o := range t.Offsets {
+		if o != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks that the swing and offsets are in range.
+func (t Timing) Validate() error {
+	if t.Swing != 0 && !(t.Swing >= MinSwing && t.Swing <= MaxSwing) {
+		return fmt.Errorf("%w: swing of %v%% is outside %d to %d", ErrInvalidTiming, t.Swing, MinSwing, MaxSwing)
+	}
+	for i, o := range t.Offsets {
+		if !(o >= -MaxOffset && o <= MaxOffset) {
+			return fmt.Errorf("%w: offset %v of step %d is outside %v to %v", ErrInvalidTiming, o, i, -MaxOffset, MaxOffset)
+		}
+	}
+	return nil
+}
+
+// Clone returns a copy of the timing which shares no memory with it.
+func (t Timing) Clone() Timing {
+	if t.Offsets != nil {
+		t.Offsets = append([]float32(nil), t.Offsets...)
+	}
+	return t
+}
+
+// shift returns how far the step of a bar is moved off the grid, in steps.
+func (t Timing) shift(step int) float64 {
+	var s float64
+	if step%2 == 1 && t.Swing != 0 {
+		s = float64(t.Swing)/MinSwing - 1
+	}
+	if step < len(t.Offsets) {
+		s += float64(t.Offsets[step])
+	}
+	return s
+}
+
+// position returns where the step is played, in steps from the start of
+// the first bar. Steps past the end of the bar are in the bars that follow
+// it, as when the pattern loops.
+func (p Pattern) position(step int) float64 {
+	steps := p.steps()
+	return float64(step) + p.Timing.shift(step%steps)
+}
+
+// StepTime returns the time at which the step is played from the start of
+// the bar, at the tempo of the pattern and with its timing. The time of
+// the first step is negative when its offset plays it early.
+func (p Pattern) StepTime(step int) time.Duration {
+	return time.Duration(p.position(step) * float64(p.Header.StepDuration()))
+}
+
+// StepTimes returns the time of every step of the bar, see StepTime.
+func (p Pattern) StepTimes() []time.Duration {
+	times := make([]time.Duration, p.steps())
+	for s := range times {
+		times[s] = p.StepTime(s)
+	}
+	return times
+}
+
+// Extension chunks follow the declared payload of a pattern, so decoders
+// which don't know about them see them as trailing data and skip them. Each
+// chunk is the extension magic followed by a four letter chunk ID, the big
+// endian length of the chunk data, and the data.
+const (
+	extensionMagic = "SPLEXT"
+
+	// timingChunk holds the Timing of a pattern: the swing followed by the
+	// step offsets, as little endian floats like the tempo.
+	timingChunk = "TIMG"
+)
+
+// encodeExtension writes an extension chunk.
+func encodeExtension(buffer *bytes.Buffer, id string, data []byte) error {
+	if uint64(len(data)) > math.MaxUint32 {
+		return fmt.Errorf("drum: %s extension of %d bytes is too large", id, len(data))
+	}
+	buffer.WriteString(extensionMagic)
+	buffer.WriteString(id)
+	binary.Write(buffer, binary.BigEndian, uint32(len(data)))
+	buffer.Write(data)
+	return nil
+}
+
+// encode returns the data of the timing chunk.
+func (t Timing) encode() []byte {
+	var buffer bytes.Buffer
+	binary.Write(&buffer, binary.LittleEndian, t.Swing)
+	binary.Write(&buffer, binary.LittleEndian, t.Offsets)
+	return buffer.Bytes()
+}
+
+// decodeTiming decodes the data of the timing chunk.
+func decodeTiming(data []byte) (Timing, error) {
+	if len(data) < 4 || len(data)%4 != 0 {
+		return Timing{}, fmt.Errorf("%w: timing of %d bytes", ErrLengthMismatch, len(data))
+	}
+	var t Timing
+	r := bytes.NewReader(data)
+	binary.Read(r, binary.LittleEndian, &t.Swing)
+	if n := len(data)/4 - 1; n > 0 {
+		t.Offsets = make([]float32, n)
+		binary.Read(r, binary.LittleEndian, t.Offsets)
+	}
+	return t, t.Validate()
+}
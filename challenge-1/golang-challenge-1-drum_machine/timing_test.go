@@ -0,0 +1,266 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStepTimes(t *testing.T) {
+	h := Header{Tempo: 120}
+
+	tData := []struct {
+		timing Timing
+		times  []time.Duration
+	}{
+		{Timing{}, []time.Duration{0, 125000, 250000, 375000}},
+		{Timing{Swing: 50}, []time.Duration{0, 125000, 250000, 375000}},
+		{Timing{Swing: 75}, []time.Duration{0, 187500, 250000, 437500}},
+		{Timing{Offsets: []float32{-0.5, 0.25}}, []time.Duration{-62500, 156250, 250000, 375000}},
+		{Timing{Swing: 62.5, Offsets: []float32{0, -0.25, 0.5}}, []time.Duration{0, 125000, 312500, 406250}},
+	}
+
+	for i, exp := range tData {
+		p := Pattern{Header: h, Timing: exp.timing}
+		times := p.StepTimes()
+		if len(times) != 16 {
+			t.Fatalf("timing %d: expected 16 steps, got %d", i, len(times))
+		}
+		for s, want := range exp.times {
+			want *= time.Microsecond
+			if times[s] != want {
+				t.Fatalf("timing %d: step %d is at %v, expected %v", i, s, times[s], want)
+			}
+		}
+	}
+}
+
+func TestTimingRoundTrip(t *testing.T) {
+	p, err := DecodeFile(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	var straight bytes.Buffer
+	if err := Encode(&straight, p); err != nil {
+		t.Fatalf("something went wrong encoding - %v", err)
+	}
+
+	p.Timing = Timing{Swing: 66.7, Offsets: []float32{0, 0, 0, 0, -0.1}}
+	var buf bytes.Buffer
+	if err := Encode(&buf, p); err != nil {
+		t.Fatalf("something went wrong encoding - %v", err)
+	}
+
+	// The payload is unchanged, the timing only follows it, so decoders
+	// which don't know about the extension see trailing data.
+	if !bytes.HasPrefix(buf.Bytes(), straight.Bytes()) {
+		t.Fatalf("the timing changed the payload.\nGot:\n%x\nExpected it to start with:\n%x", buf.Bytes(), straight.Bytes())
+	}
+	if rest := buf.Bytes()[straight.Len():]; !bytes.HasPrefix(rest, []byte("SPLEXTTIMG")) {
+		t.Fatalf("expected the timing extension after the payload, got %q", rest)
+	}
+
+	decoded, err := Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	if decoded.Trailing != nil {
+		t.Fatalf("the extension was taken for trailing data: %q", decoded.Trailing)
+	}
+	if Diff(p, decoded).TimingChanged() || decoded.Timing.Swing != p.Timing.Swing {
+		t.Fatalf("expected the timing %+v, got %+v", p.Timing, decoded.Timing)
+	}
+
+	// A stream of patterns with timing decodes one pattern after the other.
+	stream := io.MultiReader(bytes.NewReader(buf.Bytes()), bytes.NewReader(straight.Bytes()), bytes.NewReader(buf.Bytes()))
+	dec := NewDecoder(stream)
+	for i, swing := range []float32{66.7, 0, 66.7} {
+		got, err := dec.Decode()
+		if err != nil {
+			t.Fatalf("pattern %d: something went wrong decoding - %v", i, err)
+		}
+		if got.Timing.Swing != swing {
+			t.Fatalf("pattern %d: expected a swing of %v, got %v", i, swing, got.Timing.Swing)
+		}
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Fatalf("expected io.EOF after the last pattern, got %v", err)
+	}
+
+	// Extensions unknown to the decoder are skipped.
+	unknown := append([]byte(nil), straight.Bytes()...)
+	unknown = append(unknown, "SPLEXTNOTE"...)
+	unknown = binary.BigEndian.AppendUint32(unknown, 3)
+	unknown = append(unknown, "abc"...)
+	unknown = append(unknown, buf.Bytes()[straight.Len():]...)
+	decoded, err = Decode(bytes.NewReader(unknown))
+	if err != nil {
+		t.Fatalf("something went wrong decoding an unknown extension - %v", err)
+	}
+	if decoded.Timing.Swing != 66.7 || decoded.Trailing != nil {
+		t.Fatalf("unexpected pattern after an unknown extension: %+v", decoded)
+	}
+
+	// An explicit swing of 50 is kept, only zero leaves it unset.
+	p.Timing = Timing{Swing: MinSwing}
+	buf.Reset()
+	if err := Encode(&buf, p); err != nil {
+		t.Fatalf("something went wrong encoding - %v", err)
+	}
+	decoded, err = Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	if decoded.Timing.Swing != MinSwing {
+		t.Fatalf("expected a swing of %d, got %v", MinSwing, decoded.Timing.Swing)
+	}
+}
+
+func TestTimingText(t *testing.T) {
+	p, err := DecodeFile(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	p.Timing.Swing = 58
+
+	expected := `Saved with HW Version: 0.808-alpha
+Tempo: 98.4
+Swing: 58%
+(0) kick	|x---|----|x---|----|
+(1) snare	|----|x---|----|x---|
+(3) hh-open	|--x-|--x-|x-x-|--x-|
+(5) cowbell	|----|----|x---|----|
+`
+	if p.String() != expected {
+		t.Fatalf("unexpected text.\nGot:\n%s\nExpected:\n%s", p, expected)
+	}
+	parsed, err := ParsePattern(expected)
+	if err != nil {
+		t.Fatalf("something went wrong parsing - %v", err)
+	}
+	if parsed.Timing.Swing != 58 {
+		t.Fatalf("expected a swing of 58, got %v", parsed.Timing.Swing)
+	}
+
+	b, err := json.Marshal(Pattern{Header: Header{Tempo: 120}, Timing: Timing{Swing: 60, Offsets: []float32{0.5}}})
+	if err != nil {
+		t.Fatalf("something went wrong marshaling - %v", err)
+	}
+	if !strings.Contains(string(b), `"swing":60,"offsets":[0.5]`) {
+		t.Fatalf("unexpected JSON: %s", b)
+	}
+}
+
+func TestTimingErrors(t *testing.T) {
+	p := Pattern{Header: Header{Tempo: 120}}
+
+	tData := []Timing{
+		{Swing: 49},
+		{Swing: 76},
+		{Offsets: []float32{0, 0.6}},
+		{Offsets: []float32{-0.75}},
+	}
+
+	for i, timing := range tData {
+		p.Timing = timing
+		if err := Encode(io.Discard, p); !errors.Is(err, ErrInvalidTiming) {
+			t.Fatalf("timing %d: expected %v encoding, got %v", i, ErrInvalidTiming, err)
+		}
+	}
+
+	for _, text := range []string{"Swing: 80%", "Swing: lots", "Swing: 60\nSwing: 60"} {
+		if _, err := ParsePattern("Saved with HW Version: 0.909\nTempo: 120\n" + text); err == nil {
+			t.Fatalf("expected an error parsing %q", text)
+		}
+	}
+	var q Pattern
+	if err := json.Unmarshal([]byte(`{"tempo":120,"swing":20,"tracks":[]}`), &q); !errors.Is(err, ErrInvalidTiming) {
+		t.Fatalf("expected %v unmarshaling, got %v", ErrInvalidTiming, err)
+	}
+}
+
+func TestTimingDiffAndMerge(t *testing.T) {
+	base, err := DecodeFile(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+
+	ours := base.Clone()
+	ours.Timing.Swing = 60
+	d := Diff(base, ours)
+	if d.Empty() || !d.TimingChanged() {
+		t.Fatalf("expected the swing to show in the diff")
+	}
+	if !strings.Contains(d.String(), "+Swing: 60%") {
+		t.Fatalf("unexpected diff:\n%s", d)
+	}
+	if !Diff(Pattern{Timing: Timing{Swing: 50, Offsets: []float32{0}}}, Pattern{}).Empty() {
+		t.Fatalf("expected straight timings to be the same")
+	}
+
+	merged, conflicts, err := Merge(base, ours, base)
+	if err != nil || len(conflicts) != 0 || merged.Timing.Swing != 60 {
+		t.Fatalf("expected our swing to be merged, got %v, %v and %v", merged.Timing, conflicts, err)
+	}
+
+	theirs := base.Clone()
+	theirs.Timing.Swing = 70
+	merged, conflicts, err = Merge(base, ours, theirs)
+	if err != nil {
+		t.Fatalf("something went wrong merging - %v", err)
+	}
+	if len(conflicts) != 1 || !conflicts[0].Header || merged.Timing.Swing != 60 {
+		t.Fatalf("expected a conflict keeping our swing, got %v and %v", merged.Timing, conflicts)
+	}
+}
+
+func TestTimingPlayback(t *testing.T) {
+	p := Pattern{
+		Header: Header{Tempo: 120, Steps: 4, StepsPerBeat: 4},
+		Tracks: []Track{{ID: 0, Name: "hh-close", Steps: []byte{1, 1, 1, 1}}},
+		Timing: Timing{Swing: 75},
+	}
+
+	var times []time.Time
+	clock := &fakeClock{}
+	seq := NewSequencer(p, func(e Event) {
+		times = append(times, clock.Now())
+	})
+	seq.Clock = clock
+	seq.Loops = 2
+	if err := seq.Start(); err != nil {
+		t.Fatalf("something went wrong starting - %v", err)
+	}
+	seq.Wait()
+
+	expected := []time.Duration{0, 187500, 250000, 437500, 500000, 687500, 750000, 937500}
+	if len(times) != len(expected) {
+		t.Fatalf("expected %d triggers, got %d", len(expected), len(times))
+	}
+	for i, at := range times {
+		if d := at.Sub(time.Time{}); d != expected[i]*time.Microsecond {
+			t.Fatalf("trigger %d at %v, expected %v", i, d, expected[i]*time.Microsecond)
+		}
+	}
+
+	// The notes of the MIDI export move with the steps, and are put back
+	// on the grid when importing it.
+	p.Timing.Swing = 60
+	var buf bytes.Buffer
+	if err := EncodeMIDI(&buf, p, MIDIOptions{}); err != nil {
+		t.Fatalf("something went wrong exporting - %v", err)
+	}
+	imported, err := DecodeMIDI(&buf)
+	if err != nil {
+		t.Fatalf("something went wrong importing - %v", err)
+	}
+	if len(imported.Tracks) != 1 || !bytes.HasPrefix(imported.Tracks[0].letters(), []byte("xxxx-")) {
+		t.Fatalf("unexpected pattern imported:\n%s", imported)
+	}
+}
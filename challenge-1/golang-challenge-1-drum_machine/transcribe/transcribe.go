@@ -0,0 +1,455 @@
+// Package transcribe turns recorded drum loops into patterns. The audio is
+// cut into frames whose spectrum is split into a low, a mid and a high band.
+// A sudden rise of the energy of the bands is a hit, heard as a kick, a
+// snare or a hi-hat from the bands it rises in. The tempo is the one whose
+// 16th notes the hits fall on, and the hits are quantized to 16 steps of
+// 16th notes.
+package transcribe
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"time"
+
+	drum "github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine"
+	"github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine/wav"
+)
+
+var (
+	// ErrNoHits is returned when no drum hits are found in the audio.
+	ErrNoHits = errors.New("transcribe: no drum hits found")
+
+	// ErrInvalidAudio is returned for audio with no sample rate or no
+	// channels.
+	ErrInvalidAudio = errors.New("transcribe: invalid audio")
+)
+
+const (
+
+	// DefaultThreshold is the threshold of hits when none is set.
+	DefaultThreshold = 0.25
+
+	// MinTempo and MaxTempo bound the estimated tempo.
+	MinTempo = 60
+	MaxTempo = 200
+
+	// steps is the number of steps of a transcribed pattern, 16th notes
+	// in a bar of four beats.
+	steps        = 16
+	stepsPerBeat = 4
+)
+
+// The edges of the bands in Hz. The kick is heard below lowEdge, the hi-hat
+// above highEdge and the snare between them.
+const (
+	lowEdge  = 200
+	highEdge = 5000
+)
+
+// Instrument is the drum a hit is heard as.
+type Instrument int
+
+const (
+	Kick Instrument = iota
+	Snare
+	HiHat
+)
+
+// tracks are the tracks of a transcribed pattern, one for each Instrument.
+var tracks = []drum.Track{
+	{ID: 0, Name: "kick"},
+	{ID: 1, Name: "snare"},
+	{ID: 2, Name: "hh-close"},
+}
+
+// String returns the name of the track the instrument is transcribed to.
+func (i Instrument) String() string {
+	if i < 0 || int(i) >= len(tracks) {
+		return fmt.Sprintf("Instrument(%d)", int(i))
+	}
+	return tracks[i].Name
+}
+
+// Hit is a drum hit found in the audio. Instruments played together are
+// found as hits at the same time.
+type Hit struct {
+	Time       time.Duration
+	Instrument Instrument
+
+	// Strength is the rise of energy of the hit relative to the loudest
+	// hit of its band, from the threshold to 1.
+	Strength float64
+}
+
+// Options controls the transcription.
+type Options struct {
+
+	// Tempo of the loop in beats per minute. It is estimated from the hits
+	// when zero.
+	Tempo float32
+
+	// Threshold is the smallest rise of energy taken for a hit, relative
+	// to the loudest hit of its band. DefaultThreshold is used when zero.
+	Threshold float64
+}
+
+// Transcribe finds the drum hits of a loop and returns them as a pattern
+// with a kick, a snare and a hi-hat track. The loop must start on the
+// first beat of a bar, hits of loops of several bars are played in a
+// single one.
+//
+// The bands only tell apart drums which sound in different bands: a hi-hat
+// played with a snare is heard as the snare alone. A loop played the same
+// at half or twice its tempo may be estimated at either, the tempo should
+// then be set in the options.
+func Transcribe(a wav.Audio, opts Options) (drum.Pattern, error) {
+	hits, err := analyze(a, opts)
+	if err != nil {
+		return drum.Pattern{}, err
+	}
+	if len(hits) == 0 {
+		return drum.Pattern{}, ErrNoHits
+	}
+
+	bpm := opts.Tempo
+	if bpm == 0 {
+		bpm = tempo(hits, float64(a.Frames())/float64(a.SampleRate))
+	}
+	if !(bpm > 0) {
+		return drum.Pattern{}, drum.ErrInvalidTempo
+	}
+
+	p := drum.Pattern{Header: drum.Header{Tempo: bpm}}
+	for _, t := range tracks {
+		t.Steps = make([]byte, steps)
+		p.Tracks = append(p.Tracks, t)
+	}
+
+	step := p.Header.StepDuration()
+	for _, h := range hits {
+		n := int(math.Round(float64(h.Time) / float64(step)))
+		if n < 0 {
+			n = 0
+		}
+		p.Tracks[h.Instrument].Steps[n%steps] = drum.StepOn
+	}
+
+	return p, nil
+}
+
+// TranscribeFile transcribes the WAV file found at the provided path.
+func TranscribeFile(path string, opts Options) (drum.Pattern, error) {
+	a, err := wav.DecodeFile(path)
+	if err != nil {
+		return drum.Pattern{}, err
+	}
+	return Transcribe(a, opts)
+}
+
+// Hits returns the drum hits found in the audio in time order.
+func Hits(a wav.Audio, opts Options) ([]Hit, error) {
+	return analyze(a, opts)
+}
+
+// analyze finds the hits of the audio in time order.
+func analyze(a wav.Audio, opts Options) ([]Hit, error) {
+	if a.SampleRate <= 0 || a.Channels <= 0 {
+		return nil, ErrInvalidAudio
+	}
+	threshold := opts.Threshold
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+
+	// Frames last about 20ms and overlap by half, which places hits well
+	// within a 16th note at any tempo the package estimates.
+	size := 64
+	for size < a.SampleRate/50 {
+		size *= 2
+	}
+	hop := size / 2
+	rises := bandRises(mono(a), a.SampleRate, size, hop)
+
+	// Bands are scaled by their loudest rise, but not by much more than
+	// the loudest rise of all so a band no drum plays in stays quiet.
+	loudest := 0.0
+	var scale [3]float64
+	for b := range rises {
+		for _, r := range rises[b] {
+			scale[b] = math.Max(scale[b], r)
+		}
+		loudest = math.Max(loudest, scale[b])
+	}
+	if loudest == 0 {
+		return nil, ErrNoHits
+	}
+	for b := range scale {
+		scale[b] = math.Max(scale[b], loudest/100)
+	}
+
+	// The onset rises with the energy of every band, each band scaled so
+	// quiet instruments count as much as loud ones.
+	onset := make([]float64, len(rises[0]))
+	for k := range onset {
+		for b := range rises {
+			onset[k] += rises[b][k] / scale[b]
+		}
+	}
+
+	// A hit is a peak of the onset. Its rise is counted over the frames
+	// around the peak, which the attack of the hit spans.
+	type peak struct {
+		at   time.Duration
+		rise [3]float64
+	}
+	var peaks []peak
+	var loudestPeak [3]float64
+	for k, o := range onset {
+		if o < threshold || !isPeak(onset, k, 2) {
+			continue
+		}
+		p := peak{at: time.Duration(float64(k*hop+size/2-hop/2) / float64(a.SampleRate) * float64(time.Second))}
+		for j := k - 1; j <= k+1; j++ {
+			for b := range rises {
+				if j >= 0 && j < len(rises[b]) {
+					p.rise[b] += rises[b][j]
+				}
+			}
+		}
+		for b := range loudestPeak {
+			loudestPeak[b] = math.Max(loudestPeak[b], p.rise[b])
+		}
+		peaks = append(peaks, p)
+	}
+	loudest = math.Max(loudestPeak[0], math.Max(loudestPeak[1], loudestPeak[2]))
+	for b := range scale {
+		scale[b] = math.Max(loudestPeak[b], loudest/100)
+	}
+
+	var hits []Hit
+	for _, p := range peaks {
+
+		// The noise of a snare reaches the high band as well, a rise of
+		// the high band is only a hi-hat when there is no snare.
+		snare := p.rise[1]/scale[1] >= threshold
+		for b, inst := range []Instrument{Kick, Snare, HiHat} {
+			strength := p.rise[b] / scale[b]
+			if strength < threshold || inst == HiHat && snare {
+				continue
+			}
+			hits = append(hits, Hit{Time: p.at, Instrument: inst, Strength: strength})
+		}
+	}
+
+	return hits, nil
+}
+
+// tempo estimates the tempo of a loop of the hits which lasts the given
+// number of seconds. The hits fall on the 16th notes of the slowest tempo
+// whose grid they fit, and on those of every multiple of it, so the tempo
+// is taken among the slowest one doubled any number of times. A tempo at
+// which the bars of the loop differ is too fast, of the others the one
+// nearest 120 beats per minute is taken. The tempo is rounded so the loop
+// lasts a whole number of bars, or else to a whole number of beats per
+// minute, when the hits fit the rounded tempo nearly as well.
+func tempo(hits []Hit, seconds float64) float32 {
+	total := 0.0
+	for _, h := range hits {
+		total += h.Strength
+	}
+
+	// fit returns how near the hits fall to the grid of 16th notes of the
+	// tempo, 1 when they all fall on it.
+	fit := func(tempo float64) float64 {
+		step := 60 / tempo / stepsPerBeat
+		f := 0.0
+		for _, h := range hits {
+			f += h.Strength * math.Cos(2*math.Pi*h.Time.Seconds()/step)
+		}
+		return f / total
+	}
+
+	// refine returns the tempo within the given ratio of the tempo which
+	// the hits fit best.
+	refine := func(tempo, ratio float64) float64 {
+		best, bestFit := tempo, fit(tempo)
+		for t := tempo / ratio; t <= tempo*ratio; t *= 1.0001 {
+			if f := fit(t); f > bestFit {
+				best, bestFit = t, f
+			}
+		}
+		return best
+	}
+
+	// The slowest tempo is the slowest peak of the fit nearly as high as
+	// the highest, searched three octaves below MinTempo.
+	var tempos, fits []float64
+	best := 0.0
+	for t := MinTempo / 8.0; t <= MaxTempo; t *= 1.001 {
+		tempos = append(tempos, t)
+		fits = append(fits, fit(t))
+		best = math.Max(best, fits[len(fits)-1])
+	}
+	slowest := tempos[0]
+	for i, t := range tempos {
+		if fits[i] >= 0.9*best && isPeak(fits, i, 1) {
+			slowest = refine(t, 1.001)
+			break
+		}
+	}
+
+	found, repeating, distance := 0.0, false, math.Inf(1)
+	for t := slowest; t <= MaxTempo*1.01; t *= 2 {
+		if t < MinTempo*0.99 {
+			continue
+		}
+		t = refine(t, 1.002)
+		r, d := repeats(hits, t, seconds), math.Abs(math.Log2(t/120))
+		if found == 0 || r && !repeating || r == repeating && d < distance {
+			found, repeating, distance = t, r, d
+		}
+	}
+
+	// near returns whether the hits fit the tempo nearly as well as the
+	// one found.
+	near := func(tempo float64) bool {
+		return math.Abs(tempo-found) < 0.005*found && fit(tempo) >= fit(found)-0.02
+	}
+	bar := 60 / found * steps / stepsPerBeat
+	if bars := math.Round(seconds / bar); bars >= 1 && near(60*steps/stepsPerBeat/(seconds/bars)) {
+		found = 60 * steps / stepsPerBeat / (seconds / bars)
+	} else if near(math.Round(found)) {
+		found = math.Round(found)
+	}
+	return float32(math.Round(found*10) / 10)
+}
+
+// repeats reports whether the hits are the same in every bar of a loop of
+// the given number of seconds at the tempo. The bars cut short by the end
+// of the loop are not compared.
+func repeats(hits []Hit, tempo, seconds float64) bool {
+	step := 60 / tempo / stepsPerBeat
+	bars := int(math.Floor(seconds/(step*steps) + 0.05))
+	played := make([]map[[2]int]bool, bars)
+	for i := range played {
+		played[i] = map[[2]int]bool{}
+	}
+	for _, h := range hits {
+		n := int(math.Round(h.Time.Seconds() / step))
+		if bar := n / steps; bar < bars {
+			played[bar][[2]int{int(h.Instrument), n % steps}] = true
+		}
+	}
+	for _, bar := range played {
+		if len(bar) != len(played[0]) {
+			return false
+		}
+		for k := range bar {
+			if !played[0][k] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isPeak reports whether the value at k is the largest within width values
+// either side, the first of equal values being the peak.
+func isPeak(values []float64, k, width int) bool {
+	for j := k - width; j <= k+width; j++ {
+		if j < 0 || j >= len(values) || j == k {
+			continue
+		}
+		if values[j] > values[k] || j < k && values[j] == values[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// mono mixes the channels of the audio down to one.
+func mono(a wav.Audio) []float64 {
+	out := make([]float64, a.Frames())
+	for i := range out {
+		for c := 0; c < a.Channels; c++ {
+			out[i] += a.Samples[i*a.Channels+c]
+		}
+		out[i] /= float64(a.Channels)
+	}
+	return out
+}
+
+// bandRises returns the rise of energy of the low, mid and high bands from
+// each frame to the next, zero where the energy falls. The first frame
+// rises from silence.
+func bandRises(samples []float64, rate, size, hop int) [3][]float64 {
+	window := make([]float64, size)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size))
+	}
+	band := make([]int, size/2)
+	for i := range band {
+		switch f := float64(i) * float64(rate) / float64(size); {
+		case f < lowEdge:
+			band[i] = 0
+		case f < highEdge:
+			band[i] = 1
+		default:
+			band[i] = 2
+		}
+	}
+
+	var rises [3][]float64
+	var prev [3]float64
+	frame := make([]complex128, size)
+	for start := 0; start < len(samples); start += hop {
+		for i := range frame {
+			v := 0.0
+			if start+i < len(samples) {
+				v = samples[start+i] * window[i]
+			}
+			frame[i] = complex(v, 0)
+		}
+		fft(frame)
+
+		var energy [3]float64
+		for i := 1; i < size/2; i++ {
+			energy[band[i]] += real(frame[i])*real(frame[i]) + imag(frame[i])*imag(frame[i])
+		}
+		for b := range energy {
+			rises[b] = append(rises[b], math.Max(0, energy[b]-prev[b]))
+		}
+		prev = energy
+	}
+	return rises
+}
+
+// fft computes the discrete Fourier transform of x in place. The length of
+// x must be a power of two.
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for length := 2; length <= n; length <<= 1 {
+		w := cmplx.Exp(complex(0, -2*math.Pi/float64(length)))
+		for i := 0; i < n; i += length {
+			wn := complex(1, 0)
+			for k := 0; k < length/2; k++ {
+				u, v := x[i+k], x[i+k+length/2]*wn
+				x[i+k], x[i+k+length/2] = u+v, u-v
+				wn *= w
+			}
+		}
+	}
+}
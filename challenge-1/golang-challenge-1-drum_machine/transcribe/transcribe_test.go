@@ -0,0 +1,200 @@
+package transcribe
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	drum "github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine"
+	"github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine/wav"
+)
+
+const rate = 44100
+
+// synth returns a mono sample of the given length whose value at each time
+// in seconds is given by fn.
+func synth(seconds float64, fn func(t float64) float64) wav.Audio {
+	a := wav.Audio{SampleRate: rate, Channels: 1, Samples: make([]float64, int(seconds*rate))}
+	for i := range a.Samples {
+		a.Samples[i] = fn(float64(i) / rate)
+	}
+	return a
+}
+
+// kit returns a kit of synthetic drums: a kick sweeping down from 100 Hz, a
+// snare of a 220 Hz tone and softened noise, and a hi-hat of tones between
+// 8 and 14 kHz.
+func kit() drum.Kit {
+	rng := rand.New(rand.NewSource(1))
+
+	kick := synth(0.2, func(t float64) float64 {
+		return 0.8 * math.Exp(-t/0.05) * math.Sin(2*math.Pi*(45*t+55*0.03*(1-math.Exp(-t/0.03))))
+	})
+
+	noise := 0.0
+	snare := synth(0.15, func(t float64) float64 {
+		noise += 0.5 * (rng.Float64()*2 - 1 - noise)
+		return math.Exp(-t/0.04) * (0.3*math.Sin(2*math.Pi*220*t) + 0.4*noise)
+	})
+
+	var freqs, phases [24]float64
+	for i := range freqs {
+		freqs[i] = 8000 + rng.Float64()*6000
+		phases[i] = rng.Float64() * 2 * math.Pi
+	}
+	hat := synth(0.05, func(t float64) float64 {
+		v := 0.0
+		for i, f := range freqs {
+			v += math.Sin(2*math.Pi*f*t + phases[i])
+		}
+		return 0.03 * math.Exp(-t/0.015) * v
+	})
+
+	return drum.Kit{Names: map[string]drum.Instrument{
+		"kick":     {Sample: kick},
+		"snare":    {Sample: snare},
+		"hh-close": {Sample: hat},
+	}}
+}
+
+// loop renders a kick, a snare and a hi-hat track at the tempo, cut to a
+// whole number of bars as drum loops are.
+func loop(t *testing.T, tempo float32, loops int, kick, snare, hat string) (drum.Pattern, wav.Audio) {
+	text := fmt.Sprintf("Saved with HW Version: 0.909\nTempo: %v\n(0) kick\t|%s|\n(1) snare\t|%s|\n(2) hh-close\t|%s|\n",
+		tempo, kick, snare, hat)
+	p, err := drum.ParsePattern(text)
+	if err != nil {
+		t.Fatalf("something went wrong parsing - %v", err)
+	}
+	a, err := drum.Render(p, kit(), drum.RenderOptions{Loops: loops})
+	if err != nil {
+		t.Fatalf("something went wrong rendering - %v", err)
+	}
+	bar := 16 * p.Header.StepDuration().Seconds()
+	a.Samples = a.Samples[:2*int(math.Round(float64(loops)*bar*float64(a.SampleRate)))]
+	return p, a
+}
+
+func TestTranscribe(t *testing.T) {
+	tData := []struct {
+		tempo            float32
+		loops            int
+		kick, snare, hat string
+	}{
+		{120, 1, "x---|x---|x---|x---", "----|x---|----|x---", "--x-|--x-|--x-|--x-"},
+		{98, 2, "x---|----|x-x-|----", "----|x---|----|x---", "x-x-|--x-|x-x-|--x-"},
+		{140, 1, "x--x|--x-|x---|--x-", "----|x--x|----|x---", "xxxx|----|xxxx|--xx"},
+		{87.5, 2, "x---|---x|--x-|----", "----|x---|-x--|x---", "x-x-|--x-|x---|--x-"},
+		{62, 2, "x---|----|--x-|----", "----|x---|----|x---", "xxxx|-xxx|xxxx|-xxx"},
+		{174, 2, "x---|----|x-x-|----", "----|x---|----|x---", "xxxx|-xxx|xxxx|-xxx"},
+		{90, 2, "x---|----|x-x-|----", "----|x---|----|x---", "x-x-|--x-|x-x-|--x-"},
+	}
+
+	for _, exp := range tData {
+		p, a := loop(t, exp.tempo, exp.loops, exp.kick, exp.snare, exp.hat)
+
+		// The loop may end with the sound of its last hits.
+		untrimmed, err := drum.Render(p, kit(), drum.RenderOptions{Loops: exp.loops})
+		if err != nil {
+			t.Fatalf("something went wrong rendering - %v", err)
+		}
+
+		for _, a := range []wav.Audio{a, untrimmed} {
+			got, err := Transcribe(a, Options{})
+			if err != nil {
+				t.Fatalf("%v BPM: something went wrong transcribing - %v", exp.tempo, err)
+			}
+			if got.Header.Tempo != exp.tempo {
+				t.Fatalf("%v BPM: estimated a tempo of %v", exp.tempo, got.Header.Tempo)
+			}
+			got.Header.Version = p.Header.Version
+			if got.String() != p.String() {
+				t.Fatalf("%v BPM: unexpected pattern.\nGot:\n%s\nExpected:\n%s", exp.tempo, got, p)
+			}
+		}
+	}
+}
+
+func TestHits(t *testing.T) {
+	_, a := loop(t, 120, 1, "x---|----|----|----", "----|x---|----|----", "----|----|x---|----")
+	hits, err := Hits(a, Options{})
+	if err != nil {
+		t.Fatalf("something went wrong finding the hits - %v", err)
+	}
+
+	expected := []struct {
+		step       int
+		instrument Instrument
+	}{
+		{0, Kick},
+		{4, Snare},
+		{8, HiHat},
+	}
+	if len(hits) != len(expected) {
+		t.Fatalf("expected %d hits, got %+v", len(expected), hits)
+	}
+	for i, exp := range expected {
+		h := hits[i]
+		at := float64(exp.step) * 0.125
+		if h.Instrument != exp.instrument || math.Abs(h.Time.Seconds()-at) > 0.015 {
+			t.Fatalf("hit %d: expected a %v at %vs, got a %v at %v", i, exp.instrument, at, h.Instrument, h.Time)
+		}
+	}
+}
+
+func TestTranscribeFile(t *testing.T) {
+	p, a := loop(t, 120, 1, "x---|x---|x---|x---", "----|x---|----|x---", "--x-|--x-|--x-|--x-")
+
+	dir, err := ioutil.TempDir("", "transcribe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "loop.wav")
+	if err := wav.EncodeFile(path, a); err != nil {
+		t.Fatalf("something went wrong writing the loop - %v", err)
+	}
+
+	// The tempo may be given rather than estimated.
+	got, err := TranscribeFile(path, Options{Tempo: 120})
+	if err != nil {
+		t.Fatalf("something went wrong transcribing - %v", err)
+	}
+
+	// The pattern can be saved as any other.
+	var buf bytes.Buffer
+	if err := drum.Encode(&buf, got); err != nil {
+		t.Fatalf("something went wrong encoding - %v", err)
+	}
+	decoded, err := drum.Decode(&buf)
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	decoded.Header.Version = p.Header.Version
+	if decoded.String() != p.String() {
+		t.Fatalf("unexpected pattern.\nGot:\n%s\nExpected:\n%s", decoded, p)
+	}
+}
+
+func TestTranscribeErrors(t *testing.T) {
+	tData := []struct {
+		audio wav.Audio
+		err   error
+	}{
+		{wav.Audio{}, ErrInvalidAudio},
+		{wav.Audio{SampleRate: rate, Channels: 2, Samples: make([]float64, rate)}, ErrNoHits},
+	}
+
+	for i, exp := range tData {
+		if _, err := Transcribe(exp.audio, Options{}); !errors.Is(err, exp.err) {
+			t.Fatalf("audio %d: expected %v, got %v", i, exp.err, err)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package drum
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// The transformations below return a new pattern and leave the one given
+// alone, so they can be chained. Those working on tracks change the tracks
+// with the given IDs, or every track when no ID is given. The random ones
+// take their numbers from rng, a generator made with
+// rand.New(rand.NewSource(seed)) giving the same result for the same seed.
+
+// mapTracks returns a copy of the pattern with fn applied to the selected
+// tracks.
+func mapTracks(p Pattern, ids []uint8, fn func(t *Track)) (Pattern, error) {
+	c := p.Clone()
+	if len(ids) == 0 {
+		for i := range c.Tracks {
+			fn(&c.Tracks[i])
+		}
+		return c, nil
+	}
+
+	for _, id := range ids {
+		i, err := c.track(id)
+		if err != nil {
+			return Pattern{}, err
+		}
+		fn(&c.Tracks[i])
+	}
+	return c, nil
+}
+
+// Rotate moves the steps of the tracks n steps later, the steps falling off
+// the end coming back at the start. A negative n moves them earlier.
+func Rotate(p Pattern, n int, ids ...uint8) (Pattern, error) {
+	return mapTracks(p, ids, func(t *Track) {
+		steps := len(t.Steps)
+		if steps == 0 {
+			return
+		}
+		n := (n%steps + steps) % steps
+		t.Steps = append(append([]byte(nil), t.Steps[steps-n:]...), t.Steps[:steps-n]...)
+	})
+}
+
+// Reverse plays the tracks backwards.
+func Reverse(p Pattern, ids ...uint8) (Pattern, error) {
+	return mapTracks(p, ids, func(t *Track) {
+		for i, j := 0, len(t.Steps)-1; i < j; i, j = i+1, j-1 {
+			t.Steps[i], t.Steps[j] = t.Steps[j], t.Steps[i]
+		}
+	})
+}
+
+// Invert silences the steps of the tracks which play and plays the silent
+// ones with StepOn.
+func Invert(p Pattern, ids ...uint8) (Pattern, error) {
+	return mapTracks(p, ids, func(t *Track) {
+		for s := range t.Steps {
+			if t.Steps[s] == 0 {
+				t.Steps[s] = StepOn
+			} else {
+				t.Steps[s] = 0
+			}
+		}
+	})
+}
+
+// Thin keeps each step which plays with the probability keep, from 0 to 1,
+// and silences the others.
+func Thin(p Pattern, keep float64, rng *rand.Rand, ids ...uint8) (Pattern, error) {
+	return mapTracks(p, ids, func(t *Track) {
+		for s := range t.Steps {
+			if t.Steps[s] != 0 && rng.Float64() >= keep {
+				t.Steps[s] = 0
+			}
+		}
+	})
+}
+
+// Fill plays each silent step with the probability chance, from 0 to 1.
+func Fill(p Pattern, chance float64, rng *rand.Rand, ids ...uint8) (Pattern, error) {
+	return mapTracks(p, ids, func(t *Track) {
+		for s := range t.Steps {
+			if t.Steps[s] == 0 && rng.Float64() < chance {
+				t.Steps[s] = StepOn
+			}
+		}
+	})
+}
+
+// Humanize moves the velocity of each step which plays up or down by up to
+// amount, at random.
+func Humanize(p Pattern, amount int, rng *rand.Rand, ids ...uint8) (Pattern, error) {
+	if amount < 0 {
+		return Pattern{}, fmt.Errorf("drum: can't humanize by a negative amount %d", amount)
+	}
+	return mapTracks(p, ids, func(t *Track) {
+		for s := range t.Steps {
+			if t.Steps[s] == 0 {
+				continue
+			}
+			v := int(t.Velocity(s)) + rng.Intn(2*amount+1) - amount
+
+			// A velocity of 1 is StepOn, which plays at NormalVelocity.
+			switch {
+			case v < StepOn+1:
+				v = StepOn + 1
+			case v > 255:
+				v = 255
+			}
+			t.Steps[s] = byte(v)
+		}
+	})
+}
+
+// Euclid spreads hits as evenly as possible over the given number of steps
+// and returns the steps, starting on a hit, for use in a Track. Euclid(3, 8)
+// is the tresillo "x--x--x-". The hits are kept between 0 and steps.
+func Euclid(hits, steps int) []byte {
+	if steps <= 0 {
+		return nil
+	}
+	if hits < 0 {
+		hits = 0
+	}
+	if hits > steps {
+		hits = steps
+	}
+
+	// The classic construction is Bjorklund's algorithm, counting hits
+	// over the steps gives the same rhythm without the recursion.
+	t := make([]byte, steps)
+	for s := range t {
+		if s*hits%steps < hits {
+			t[s] = StepOn
+		}
+	}
+	return t
+}
+
+// Repeat plays a cycle of steps over and over until the given number of
+// steps is filled. Cycles which don't divide the pattern drift against it,
+// as Repeat(Euclid(3, 5), 16) drifts five against sixteen for
+// polyrhythms.
+func Repeat(cycle []byte, steps int) []byte {
+	if len(cycle) == 0 || steps <= 0 {
+		return nil
+	}
+	t := make([]byte, steps)
+	for s := range t {
+		t[s] = cycle[s%len(cycle)]
+	}
+	return t
+}
+
+// Overlay plays b on top of a. Tracks with the same ID are combined step
+// by step, the louder of the two steps playing, and the tracks only found
+// in b are added after the tracks of a. The header of a is kept and both
+// patterns must have the same number of steps.
+func Overlay(a, b Pattern) (Pattern, error) {
+	if a.steps() != b.steps() {
+		return Pattern{}, fmt.Errorf("drum: can't overlay patterns of %d and %d steps", a.steps(), b.steps())
+	}
+
+	c := a.Clone()
+	c.Trailing = nil
+	for _, t := range b.Tracks {
+		i, err := c.track(t.ID)
+		if err != nil {
+			c.Tracks = append(c.Tracks, t.Clone())
+			continue
+		}
+		for s := range c.Tracks[i].Steps {
+			if t.Velocity(s) > c.Tracks[i].Velocity(s) {
+				c.Tracks[i].Steps[s] = t.Steps[s]
+			}
+		}
+	}
+	return c, nil
+}
+
+// Concat chains the patterns into a single pattern, one after the other,
+// to make a song out of bars. Tracks are matched by ID and stay silent in
+// the bars of patterns which don't have them. The header of the first
+// pattern is kept with its swing, but not its step offsets, and every
+// pattern must have the same steps per beat.
+func Concat(patterns ...Pattern) (Pattern, error) {
+	if len(patterns) == 0 {
+		return Pattern{}, fmt.Errorf("drum: no patterns to concatenate")
+	}
+
+	c := Pattern{Header: patterns[0].Header, Timing: Timing{Swing: patterns[0].Timing.Swing}}
+	steps := 0
+	for i, p := range patterns {
+		if p.Header.stepsPerBeat() != c.Header.stepsPerBeat() {
+			return Pattern{}, fmt.Errorf("drum: pattern %d has %d steps per beat, the first one %d",
+				i, p.Header.stepsPerBeat(), c.Header.stepsPerBeat())
+		}
+
+		for _, t := range p.Tracks {
+			if _, err := c.track(t.ID); err != nil {
+				c.Tracks = append(c.Tracks, Track{ID: t.ID, Name: t.Name, Steps: make([]byte, steps)})
+			}
+		}
+		for j := range c.Tracks {
+			bar := make([]byte, p.steps())
+			for _, t := range p.Tracks {
+				if t.ID == c.Tracks[j].ID {
+					copy(bar, t.Steps)
+					break
+				}
+			}
+			c.Tracks[j].Steps = append(c.Tracks[j].Steps, bar...)
+		}
+		steps += p.steps()
+	}
+
+	if steps > 0xffff {
+		return Pattern{}, fmt.Errorf("drum: %d steps is more than a pattern can hold", steps)
+	}
+	c.Header.Steps = steps
+	return c, nil
+}
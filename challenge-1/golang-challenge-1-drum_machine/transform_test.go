@@ -0,0 +1,225 @@
+package drum
+
+import (
+	"math/rand"
+	"path"
+	"testing"
+)
+
+func TestTransforms(t *testing.T) {
+	p, err := DecodeFile(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	before := p.String()
+
+	tData := []struct {
+		name      string
+		transform func(p Pattern) (Pattern, error)
+		output    string
+	}{
+		{"rotate", func(p Pattern) (Pattern, error) { return Rotate(p, 2, 0, 5) },
+			`Saved with HW Version: 0.808-alpha
+Tempo: 98.4
+(0) kick	|--x-|----|--x-|----|
+(1) snare	|----|x---|----|x---|
+(3) hh-open	|--x-|--x-|x-x-|--x-|
+(5) cowbell	|----|----|--x-|----|
+`,
+		},
+		{"rotate back", func(p Pattern) (Pattern, error) { return Rotate(p, -17, 3) },
+			`Saved with HW Version: 0.808-alpha
+Tempo: 98.4
+(0) kick	|x---|----|x---|----|
+(1) snare	|----|x---|----|x---|
+(3) hh-open	|-x--|-x-x|-x--|-x--|
+(5) cowbell	|----|----|x---|----|
+`,
+		},
+		{"reverse", func(p Pattern) (Pattern, error) { return Reverse(p) },
+			`Saved with HW Version: 0.808-alpha
+Tempo: 98.4
+(0) kick	|----|---x|----|---x|
+(1) snare	|---x|----|---x|----|
+(3) hh-open	|-x--|-x-x|-x--|-x--|
+(5) cowbell	|----|---x|----|----|
+`,
+		},
+		{"invert", func(p Pattern) (Pattern, error) { return Invert(p, 1) },
+			`Saved with HW Version: 0.808-alpha
+Tempo: 98.4
+(0) kick	|x---|----|x---|----|
+(1) snare	|xxxx|-xxx|xxxx|-xxx|
+(3) hh-open	|--x-|--x-|x-x-|--x-|
+(5) cowbell	|----|----|x---|----|
+`,
+		},
+		{"euclid", func(p Pattern) (Pattern, error) {
+			err := p.SetSteps(5, Euclid(5, 16))
+			return p, err
+		},
+			`Saved with HW Version: 0.808-alpha
+Tempo: 98.4
+(0) kick	|x---|----|x---|----|
+(1) snare	|----|x---|----|x---|
+(3) hh-open	|--x-|--x-|x-x-|--x-|
+(5) cowbell	|x---|x--x|--x-|-x--|
+`,
+		},
+		{"polyrhythm", func(p Pattern) (Pattern, error) {
+			err := p.SetSteps(5, Repeat(Euclid(2, 3), 16))
+			return p, err
+		},
+			`Saved with HW Version: 0.808-alpha
+Tempo: 98.4
+(0) kick	|x---|----|x---|----|
+(1) snare	|----|x---|----|x---|
+(3) hh-open	|--x-|--x-|x-x-|--x-|
+(5) cowbell	|x-xx|-xx-|xx-x|x-xx|
+`,
+		},
+		{"overlay", func(p Pattern) (Pattern, error) {
+			q, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+			if err != nil {
+				return Pattern{}, err
+			}
+			return Overlay(p, q)
+		},
+			`Saved with HW Version: 0.808-alpha
+Tempo: 98.4
+(0) kick	|x---|x---|x---|x---|
+(1) snare	|----|x---|----|x---|
+(3) hh-open	|--x-|--x-|x-x-|--x-|
+(5) cowbell	|----|----|x-x-|----|
+(2) clap	|----|x-x-|----|----|
+(4) hh-close	|x---|x---|----|x--x|
+`,
+		},
+	}
+
+	for _, exp := range tData {
+		got, err := exp.transform(p.Clone())
+		if err != nil {
+			t.Fatalf("%s: something went wrong - %v", exp.name, err)
+		}
+		if got.String() != exp.output {
+			t.Fatalf("%s: unexpected pattern.\nGot:\n%s\nExpected:\n%s", exp.name, got, exp.output)
+		}
+	}
+	if p.String() != before {
+		t.Fatalf("transformations changed the original pattern:\n%s", p)
+	}
+
+	if _, err := Rotate(p, 1, 2); err == nil {
+		t.Fatalf("expected an error rotating a missing track")
+	}
+}
+
+func TestEuclid(t *testing.T) {
+	tData := []struct {
+		hits, steps int
+		exp         string
+	}{
+		{3, 8, "x--x--x-"},
+		{4, 16, "x---x---x---x---"},
+		{0, 4, "----"},
+		{5, 4, "xxxx"},
+		{3, 0, ""},
+	}
+
+	for _, exp := range tData {
+		got := string(Track{Steps: Euclid(exp.hits, exp.steps)}.letters())
+		if got != exp.exp {
+			t.Fatalf("Euclid(%d, %d): expected %q, got %q", exp.hits, exp.steps, exp.exp, got)
+		}
+	}
+}
+
+func TestRandomTransforms(t *testing.T) {
+	p, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+
+	// The same seed gives the same result.
+	apply := func(seed int64) Pattern {
+		rng := rand.New(rand.NewSource(seed))
+		q, err := Fill(p, 0.25, rng, 0)
+		if err == nil {
+			q, err = Thin(q, 0.5, rng, 3, 4)
+		}
+		if err == nil {
+			q, err = Humanize(q, 30, rng)
+		}
+		if err != nil {
+			t.Fatalf("something went wrong - %v", err)
+		}
+		return q
+	}
+	a, b := apply(42), apply(42)
+	if a.String() != b.String() || !Diff(a, b).Empty() {
+		t.Fatalf("the same seed gave different patterns:\n%s\n%s", a, b)
+	}
+
+	// Fill only adds hits, Thin only removes them, and Humanize keeps
+	// velocities around their original value.
+	for i, tr := range a.Tracks {
+		orig := p.Tracks[i]
+		for s := range tr.Steps {
+			v, o := int(tr.Velocity(s)), int(orig.Velocity(s))
+			switch {
+			case tr.ID == 0 && o > 0 && v == 0:
+				t.Fatalf("Fill removed step %d of the kick", s)
+			case (tr.ID == 3 || tr.ID == 4) && o == 0 && v > 0:
+				t.Fatalf("Thin added step %d of track %d", s, tr.ID)
+			case tr.ID != 0 && tr.ID != 3 && tr.ID != 4 && (o == 0) != (v == 0):
+				t.Fatalf("Humanize changed which steps of track %d play", tr.ID)
+			case v > 0 && o > 0 && (v < o-30 || v > o+30):
+				t.Fatalf("velocity %d of track %d step %d is too far from %d", v, tr.ID, s, o)
+			}
+		}
+	}
+
+	if _, err := Humanize(p, -1, rand.New(rand.NewSource(1))); err == nil {
+		t.Fatalf("expected an error humanizing by a negative amount")
+	}
+}
+
+func TestConcat(t *testing.T) {
+	a, err := DecodeFile(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	b := Pattern{
+		Header: Header{Steps: 8},
+		Tracks: []Track{
+			{ID: 1, Name: "snare", Steps: Euclid(2, 8)},
+			{ID: 7, Name: "clap", Steps: Euclid(3, 8)},
+		},
+	}
+
+	song, err := Concat(a, b, a)
+	if err != nil {
+		t.Fatalf("something went wrong - %v", err)
+	}
+	expected := `Saved with HW Version: 0.808-alpha
+Tempo: 98.4
+Steps: 40
+(0) kick	|x---|----|x---|----|----|----|x---|----|x---|----|
+(1) snare	|----|x---|----|x---|x---|x---|----|x---|----|x---|
+(3) hh-open	|--x-|--x-|x-x-|--x-|----|----|--x-|--x-|x-x-|--x-|
+(5) cowbell	|----|----|x---|----|----|----|----|----|x---|----|
+(7) clap	|----|----|----|----|x--x|--x-|----|----|----|----|
+`
+	if song.String() != expected {
+		t.Fatalf("unexpected song.\nGot:\n%s\nExpected:\n%s", song, expected)
+	}
+
+	b.Header.StepsPerBeat = 3
+	if _, err := Concat(a, b); err == nil {
+		t.Fatalf("expected an error concatenating different beats")
+	}
+	if _, err := Overlay(a, b); err == nil {
+		t.Fatalf("expected an error overlaying different step counts")
+	}
+}
@@ -0,0 +1,380 @@
+// Package tui implements a terminal step editor for drum patterns. The
+// tracks are shown in the grid format of drum.Track.String with a cursor
+// moving over the steps.
+package tui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	drum "github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine"
+)
+
+// ANSI escape sequences used to draw the screen.
+const (
+	clearScreen = "\x1b[H\x1b[2J"
+	reverse     = "\x1b[7m"
+	underline   = "\x1b[4m"
+	reset       = "\x1b[0m"
+)
+
+// Help lists the key bindings of the editor.
+const Help = `arrows or hjkl move, space or x toggle, X accent, r rename, t tempo,
++/- tempo by one, p play, u undo, ctrl-r redo, s save, q quit`
+
+// errTerminalClosed is returned by Run when the terminal has no more keys
+// to read before the editor was quit.
+var errTerminalClosed = errors.New("tui: terminal closed")
+
+// prompt modes.
+const (
+	noPrompt = iota
+	renamePrompt
+	tempoPrompt
+)
+
+// Editor edits a pattern on a terminal.
+type Editor struct {
+
+	// Path is the file the pattern is saved to.
+	Path string
+
+	// Save writes the pattern to Path. drum.EncodeFile is used when it is
+	// nil.
+	Save func(path string, p drum.Pattern) error
+
+	// Registry checks the pattern against the rules of its hardware
+	// version before it is saved. Patterns aren't checked when it is nil,
+	// as for a new editor.
+	Registry *drum.Registry
+
+	// Clock drives the playback cursor. The wall clock is used when it is
+	// nil.
+	Clock drum.Clock
+
+	history *drum.History
+	saved   drum.Pattern
+
+	// track and step are the position of the cursor.
+	track, step int
+
+	playing  bool
+	playStep int
+
+	prompt int
+	input  string
+	status string
+
+	// quitting is set when quit was asked with unsaved changes.
+	quitting bool
+}
+
+// NewEditor is a factory function for Editor. The editor starts without a
+// Registry.
+func NewEditor(path string, p drum.Pattern) *Editor {
+	return &Editor{
+		Path:    path,
+		history: drum.NewHistory(p),
+		saved:   p.Clone(),
+		status:  Help,
+	}
+}
+
+// Pattern returns the pattern being edited.
+func (e *Editor) Pattern() drum.Pattern {
+	return e.history.Pattern()
+}
+
+// Modified reports whether the pattern changed since it was last saved.
+func (e *Editor) Modified() bool {
+	return !drum.Diff(e.saved, e.history.Pattern()).Empty()
+}
+
+// Run draws the editor on the terminal and handles the keys read from it
+// until the editor is quit.
+func (e *Editor) Run(term io.ReadWriter) error {
+	keys := make(chan Key)
+	errs := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		r := bufio.NewReader(term)
+		for {
+			k, err := readKey(r)
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case keys <- k:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var tick <-chan time.Time
+	for {
+		if _, err := io.WriteString(term, e.Render()); err != nil {
+			return err
+		}
+
+		if e.playing && tick == nil {
+			tick = e.after(e.Pattern().Header.StepDuration())
+		}
+		if !e.playing {
+			tick = nil
+		}
+
+		select {
+		case k := <-keys:
+			if e.HandleKey(k) {
+				io.WriteString(term, clearScreen)
+				return nil
+			}
+		case err := <-errs:
+			if err == io.EOF {
+				err = errTerminalClosed
+			}
+			return err
+		case <-tick:
+			tick = nil
+			e.Tick()
+		}
+	}
+}
+
+// after returns a channel receiving the time once d has passed.
+func (e *Editor) after(d time.Duration) <-chan time.Time {
+	if e.Clock == nil {
+		return time.After(d)
+	}
+	return e.Clock.After(d)
+}
+
+// Tick moves the playback cursor to the next step.
+func (e *Editor) Tick() {
+	if !e.playing {
+		return
+	}
+	e.playStep = (e.playStep + 1) % e.steps()
+}
+
+// steps returns the number of steps of the pattern.
+func (e *Editor) steps() int {
+	steps, _ := e.history.Pattern().Header.Grid()
+	return steps
+}
+
+// HandleKey applies a key and reports whether the editor should quit.
+func (e *Editor) HandleKey(k Key) bool {
+	if k == KeyInterrupt {
+		return true
+	}
+	if e.prompt != noPrompt {
+		e.handlePrompt(k)
+		return false
+	}
+
+	quitting := e.quitting
+	e.quitting = false
+	e.status = ""
+
+	tracks := len(e.history.Pattern().Tracks)
+	switch k {
+	case KeyUp, 'k':
+		if e.track > 0 {
+			e.track--
+		}
+	case KeyDown, 'j':
+		if e.track < tracks-1 {
+			e.track++
+		}
+	case KeyLeft, 'h':
+		if e.step > 0 {
+			e.step--
+		}
+	case KeyRight, 'l':
+		if e.step < e.steps()-1 {
+			e.step++
+		}
+	case ' ', 'x':
+		e.edit(func(p *drum.Pattern, id uint8) error { return p.ToggleStep(id, e.step) })
+	case 'X':
+		e.edit(func(p *drum.Pattern, id uint8) error {
+			v := uint8(drum.AccentVelocity)
+			if p.Tracks[e.track].Velocity(e.step) > drum.NormalVelocity {
+				v = drum.StepOn
+			}
+			return p.SetStep(id, e.step, v)
+		})
+	case 'r':
+		if tracks > 0 {
+			e.prompt, e.input = renamePrompt, e.history.Pattern().Tracks[e.track].Name
+		}
+	case 't':
+		e.prompt, e.input = tempoPrompt, ""
+	case '+', '-':
+		delta := float32(1)
+		if k == '-' {
+			delta = -1
+		}
+		tempo := e.history.Pattern().Header.Tempo + delta
+		e.apply(func(p *drum.Pattern) error { return p.SetTempo(tempo) })
+	case 'p':
+		e.playing = !e.playing
+		e.playStep = 0
+	case 'u':
+		if !e.history.Undo() {
+			e.status = "nothing to undo"
+		}
+		e.clampCursor()
+	case ctrlR:
+		if !e.history.Redo() {
+			e.status = "nothing to redo"
+		}
+		e.clampCursor()
+	case 's':
+		e.save()
+	case 'q':
+		if !e.Modified() || quitting {
+			return true
+		}
+		e.quitting = true
+		e.status = "unsaved changes, press q again to quit"
+	}
+	return false
+}
+
+// handlePrompt edits the text of the prompt, applying it on enter.
+func (e *Editor) handlePrompt(k Key) {
+	switch k {
+	case KeyEscape:
+		e.prompt = noPrompt
+	case KeyBackspace:
+		if e.input != "" {
+			r := []rune(e.input)
+			e.input = string(r[:len(r)-1])
+		}
+	case KeyEnter:
+		prompt, input := e.prompt, e.input
+		e.prompt, e.input = noPrompt, ""
+		if prompt == renamePrompt {
+			e.edit(func(p *drum.Pattern, id uint8) error { return p.RenameTrack(id, input) })
+			return
+		}
+		tempo, err := strconv.ParseFloat(input, 32)
+		if err != nil {
+			e.status = fmt.Sprintf("invalid tempo %q", input)
+			return
+		}
+		e.apply(func(p *drum.Pattern) error { return p.SetTempo(float32(tempo)) })
+	default:
+		if k >= ' ' {
+			e.input += string(rune(k))
+		}
+	}
+}
+
+// edit applies an edit to the track under the cursor.
+func (e *Editor) edit(fn func(p *drum.Pattern, id uint8) error) {
+	p := e.history.Pattern()
+	if len(p.Tracks) == 0 {
+		return
+	}
+	id := p.Tracks[e.track].ID
+	e.apply(func(p *drum.Pattern) error { return fn(p, id) })
+}
+
+// apply applies an edit to the pattern, showing its error if it fails.
+func (e *Editor) apply(edit drum.Edit) {
+	if err := e.history.Apply(edit); err != nil {
+		e.status = err.Error()
+	}
+}
+
+// clampCursor keeps the cursor on the pattern after undoing or redoing.
+func (e *Editor) clampCursor() {
+	if n := len(e.history.Pattern().Tracks); e.track >= n && n > 0 {
+		e.track = n - 1
+	}
+	if n := e.steps(); e.step >= n {
+		e.step = n - 1
+	}
+}
+
+// save writes the pattern to its file.
+func (e *Editor) save() {
+	save := e.Save
+	if save == nil {
+		save = drum.EncodeFile
+	}
+	p := e.history.Pattern()
+	if e.Registry != nil {
+		if err := e.Registry.Validate(p); err != nil {
+			e.status = fmt.Sprintf("saving failed: %v", err)
+			return
+		}
+	}
+	if err := save(e.Path, p); err != nil {
+		e.status = fmt.Sprintf("saving failed: %v", err)
+		return
+	}
+	e.saved = p
+	e.status = "saved " + e.Path
+}
+
+// Render returns the screen of the editor: the name of the file, the
+// header and tracks of the pattern with the cursor in reverse video and the
+// playback position underlined, and a status line.
+func (e *Editor) Render() string {
+	p := e.history.Pattern()
+
+	var sb strings.Builder
+	sb.WriteString(clearScreen)
+	name := e.Path
+	if e.Modified() {
+		name += " [modified]"
+	}
+	if e.playing {
+		name += " [playing]"
+	}
+	sb.WriteString(name + "\r\n")
+	sb.WriteString(strings.Replace(p.Header.String(), "\n", "\r\n", -1))
+
+	_, perBeat := p.Header.Grid()
+	for i, t := range p.Tracks {
+		fmt.Fprintf(&sb, "(%d) %s\t|", t.ID, t.Name)
+		letters := t.Letters()
+		for s := range letters {
+			c := letters[s : s+1]
+			switch {
+			case i == e.track && s == e.step:
+				c = reverse + c + reset
+			case e.playing && s == e.playStep:
+				c = underline + c + reset
+			}
+			sb.WriteString(c)
+			if (s+1)%perBeat == 0 || s == len(letters)-1 {
+				sb.WriteString("|")
+			}
+		}
+		sb.WriteString("\r\n")
+	}
+
+	sb.WriteString("\r\n")
+	switch e.prompt {
+	case renamePrompt:
+		sb.WriteString("Name: " + e.input)
+	case tempoPrompt:
+		sb.WriteString("Tempo: " + e.input)
+	default:
+		sb.WriteString(strings.Replace(e.status, "\n", "\r\n", -1))
+	}
+	return sb.String()
+}
@@ -0,0 +1,194 @@
+package tui
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	drum "github.com/JessicaGreben/golang-challenges/challenge-1/golang-challenge-1-drum_machine"
+)
+
+// fakeTerminal plays a script of keys and records what is drawn.
+type fakeTerminal struct {
+	keys *strings.Reader
+	out  bytes.Buffer
+}
+
+func newFakeTerminal(script string) *fakeTerminal {
+	return &fakeTerminal{keys: strings.NewReader(script)}
+}
+
+func (t *fakeTerminal) Read(p []byte) (int, error) {
+	return t.keys.Read(p)
+}
+
+func (t *fakeTerminal) Write(p []byte) (int, error) {
+	return t.out.Write(p)
+}
+
+// fakeClock records the durations it is asked to wait and never fires.
+type fakeClock struct {
+	waits []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return time.Time{} }
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.waits = append(c.waits, d)
+	return nil
+}
+
+func load(t *testing.T) drum.Pattern {
+	p, err := drum.DecodeFile(path.Join("..", "fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	return p
+}
+
+func TestRunScript(t *testing.T) {
+	e := NewEditor("pattern_2.splice", load(t))
+	var saved []drum.Pattern
+	e.Save = func(path string, p drum.Pattern) error {
+		saved = append(saved, p)
+		return nil
+	}
+	clock := &fakeClock{}
+	e.Clock = clock
+
+	script := "ll " + // toggle kick step 2
+		"\x1b[B\x1b[CX" + // accent snare step 3
+		"jr\x7f\x7f\x7f\x7f\x7f\r" + // rename hh-open
+		"t120\r" + // set the tempo
+		"-" + // and lower it by one
+		"j\x1b[D \x1b[Du" + // toggle cowbell step 2 and undo it
+		"p" + // play
+		"s" + // save
+		"q"
+	term := newFakeTerminal(script)
+	if err := e.Run(term); err != nil {
+		t.Fatalf("something went wrong running - %v", err)
+	}
+
+	if len(saved) != 1 {
+		t.Fatalf("expected the pattern to be saved once, got %d", len(saved))
+	}
+	expected := `Saved with HW Version: 0.808-alpha
+Tempo: 119
+(0) kick	|x-x-|----|x---|----|
+(1) snare	|---X|x---|----|x---|
+(3) hh	|--x-|--x-|x-x-|--x-|
+(5) cowbell	|----|----|x---|----|
+`
+	if saved[0].String() != expected {
+		t.Fatalf("unexpected pattern saved.\nGot:\n%s\nExpected:\n%s", saved[0], expected)
+	}
+	if e.Modified() {
+		t.Fatalf("expected no changes after saving")
+	}
+
+	// Playback waits for a step at the tempo.
+	step := saved[0].Header.StepDuration()
+	if len(clock.waits) == 0 || clock.waits[0] != step {
+		t.Fatalf("expected playback to wait %v, got %v", step, clock.waits)
+	}
+
+	out := term.out.String()
+	if !strings.Contains(out, "Name: hh-open") || !strings.Contains(out, "pattern_2.splice [modified]") ||
+		!strings.Contains(out, "saved pattern_2.splice") {
+		t.Fatalf("unexpected screens:\n%q", out)
+	}
+}
+
+func TestSaveChecksRules(t *testing.T) {
+	e := NewEditor("pattern_2.splice", load(t))
+	e.Registry = drum.DefaultRegistry
+	e.Save = func(path string, p drum.Pattern) error {
+		t.Fatalf("expected a pattern breaking the rules of its version not to be saved")
+		return nil
+	}
+
+	// 0.808-alpha plays at most 300 BPM.
+	for _, k := range []Key{'t', '4', '0', '0', KeyEnter, 's'} {
+		e.HandleKey(k)
+	}
+	if !strings.Contains(e.Render(), "saving failed: drum: tempo is outside the range") || !e.Modified() {
+		t.Fatalf("expected the save to fail:\n%s", e.Render())
+	}
+}
+
+func TestQuitWithChanges(t *testing.T) {
+	e := NewEditor("pattern_2.splice", load(t))
+	if e.HandleKey('x') || e.HandleKey('q') {
+		t.Fatalf("expected the first quit to be refused with unsaved changes")
+	}
+	if !strings.Contains(e.Render(), "press q again") {
+		t.Fatalf("expected a warning about unsaved changes:\n%s", e.Render())
+	}
+	if !e.HandleKey('q') {
+		t.Fatalf("expected the second quit to be accepted")
+	}
+
+	// Leaving the terminal without quitting is an error.
+	e = NewEditor("pattern_2.splice", load(t))
+	if err := e.Run(newFakeTerminal("x")); err != errTerminalClosed {
+		t.Fatalf("expected %v, got %v", errTerminalClosed, err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	e := NewEditor("pattern_2.splice", load(t))
+	e.HandleKey('l')
+	e.HandleKey('p')
+	e.Tick()
+	e.Tick()
+	e.Tick()
+
+	screen := e.Render()
+	if !strings.Contains(screen, "(0) kick\t|x"+reverse+"-"+reset+"-"+underline+"-"+reset+"|") {
+		t.Fatalf("expected the cursor on step 1 and playback on step 3:\n%q", screen)
+	}
+	if !strings.Contains(screen, "pattern_2.splice [playing]") {
+		t.Fatalf("expected the editor to be playing:\n%q", screen)
+	}
+
+	// Invalid tempos are reported rather than applied.
+	for _, k := range []Key{'t', '0', KeyEnter} {
+		e.HandleKey(k)
+	}
+	if !strings.Contains(e.Render(), "tempo must be greater than zero") {
+		t.Fatalf("expected an invalid tempo error:\n%s", e.Render())
+	}
+}
+
+func TestReadKey(t *testing.T) {
+	tData := []struct {
+		input string
+		keys  []Key
+	}{
+		{"\x1b[A\x1b[B\x1b[C\x1b[D", []Key{KeyUp, KeyDown, KeyRight, KeyLeft}},
+		{"\x1bOA", []Key{KeyUp}},
+		{"\x1bq", []Key{KeyEscape, 'q'}},
+		{"\x1b", []Key{KeyEscape}},
+		{"\x1b[3~a\x1b[H\x1b[Fb", []Key{'a', 'b'}},
+		{"\x1b[1;5C\x1bOPc", []Key{KeyRight, 'c'}},
+		{"a\r\n\x7f\x08\x03\x12", []Key{'a', KeyEnter, KeyEnter, KeyBackspace, KeyBackspace, KeyInterrupt, ctrlR}},
+	}
+
+	for _, exp := range tData {
+		term := bytes.NewBufferString(exp.input)
+		r := bufio.NewReader(term)
+		for i, k := range exp.keys {
+			got, err := readKey(r)
+			if err != nil {
+				t.Fatalf("%q: key %d: something went wrong - %v", exp.input, i, err)
+			}
+			if got != k {
+				t.Fatalf("%q: key %d: expected %d, got %d", exp.input, i, k, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package tui
+
+import (
+	"bufio"
+	"unicode/utf8"
+)
+
+// Key is a key pressed on the terminal, either a character or one of the
+// special keys below.
+type Key rune
+
+// Special keys.
+const (
+	KeyUp Key = -(iota + 1)
+	KeyDown
+	KeyLeft
+	KeyRight
+	KeyEnter
+	KeyBackspace
+	KeyEscape
+	KeyInterrupt
+)
+
+// Control characters sent by a terminal in raw mode.
+const (
+	ctrlC     = 0x03
+	ctrlR     = 0x12
+	backspace = 0x08
+	escape    = 0x1b
+	delete    = 0x7f
+)
+
+// readKey reads the next key from the terminal. The escape sequences of
+// special keys are expected to arrive together, so an escape followed by
+// anything else is the escape key on its own. Of those sequences only the
+// arrows are keys of the editor, the others are read whole and ignored.
+func readKey(r *bufio.Reader) (Key, error) {
+	c, _, err := r.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+
+	switch c {
+	case '\r', '\n':
+		return KeyEnter, nil
+	case backspace, delete:
+		return KeyBackspace, nil
+	case ctrlC:
+		return KeyInterrupt, nil
+	case escape:
+	default:
+		if c == utf8.RuneError {
+			return readKey(r)
+		}
+		return Key(c), nil
+	}
+
+	// Arrows are sent as ESC [ A or, in application mode, ESC O A. Other
+	// keys send ESC O and a final byte, or a control sequence of ESC [,
+	// parameter and intermediate bytes, and a final byte from @ to ~.
+	if r.Buffered() < 2 {
+		return KeyEscape, nil
+	}
+	b, _ := r.Peek(2)
+	if b[0] != '[' && b[0] != 'O' {
+		return KeyEscape, nil
+	}
+	r.Discard(1)
+	final, _ := r.ReadByte()
+	if b[0] == '[' {
+		for (final < '@' || final > '~') && r.Buffered() > 0 {
+			final, _ = r.ReadByte()
+		}
+	}
+
+	arrows := map[byte]Key{'A': KeyUp, 'B': KeyDown, 'C': KeyRight, 'D': KeyLeft}
+	if k, ok := arrows[final]; ok {
+		return k, nil
+	}
+	return readKey(r)
+}
@@ -0,0 +1,180 @@
+package drum
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrUnsupportedVersion is returned when a pattern was saved by a
+	// hardware version the registry doesn't know.
+	ErrUnsupportedVersion = errors.New("drum: unsupported hardware version")
+
+	// ErrVersionRules is returned when a pattern breaks the rules of its
+	// hardware version, other than its tempo range which is reported with
+	// ErrTempoRange.
+	ErrVersionRules = errors.New("drum: pattern breaks the rules of its hardware version")
+
+	// ErrTempoRange is returned when the tempo of a pattern is outside the
+	// range of its hardware version.
+	ErrTempoRange = errors.New("drum: tempo is outside the range of the hardware version")
+)
+
+// VersionRules describes what a hardware version writes to its files.
+type VersionRules struct {
+	Version string
+
+	// MinTempo and MaxTempo bound the tempo of the patterns.
+	MinTempo, MaxTempo float32
+
+	// MaxTrackID is the highest track ID.
+	MaxTrackID uint8
+
+	// Instruments lists the names of the instruments of the hardware, the
+	// only names its tracks can have. Any name is known when it is empty.
+	Instruments []string
+
+	// Trailing is set for versions which write data after the declared
+	// payload.
+	Trailing bool
+}
+
+// Check reports whether the pattern follows the rules.
+func (r VersionRules) Check(p Pattern) error {
+	if !(p.Header.Tempo > 0) {
+		return fmt.Errorf("%w: %v", ErrInvalidTempo, p.Header.Tempo)
+	}
+	if !(p.Header.Tempo >= r.MinTempo && p.Header.Tempo <= r.MaxTempo) {
+		return fmt.Errorf("%w: %v is outside %v to %v for version %q",
+			ErrTempoRange, p.Header.Tempo, r.MinTempo, r.MaxTempo, r.Version)
+	}
+	for _, t := range p.Tracks {
+		if t.ID > r.MaxTrackID {
+			return fmt.Errorf("%w: track ID %d is above %d for version %q",
+				ErrVersionRules, t.ID, r.MaxTrackID, r.Version)
+		}
+		if !r.KnownInstrument(t.Name) {
+			return fmt.Errorf("%w: track %d plays %q, an unknown instrument for version %q",
+				ErrVersionRules, t.ID, t.Name, r.Version)
+		}
+	}
+	if len(p.Trailing) > 0 && !r.Trailing {
+		return fmt.Errorf("%w: %d unexpected bytes after the payload for version %q",
+			ErrVersionRules, len(p.Trailing), r.Version)
+	}
+	return nil
+}
+
+// KnownInstrument reports whether the hardware has an instrument with the
+// name, ignoring case.
+func (r VersionRules) KnownInstrument(name string) bool {
+	if len(r.Instruments) == 0 {
+		return true
+	}
+	for _, n := range r.Instruments {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Registry holds the rules of each known hardware version. It is safe for
+// concurrent use.
+type Registry struct {
+	mu       sync.RWMutex
+	versions map[string]VersionRules
+}
+
+// NewRegistry is a factory function for Registry.
+func NewRegistry(rules ...VersionRules) *Registry {
+	r := &Registry{versions: map[string]VersionRules{}}
+	for _, v := range rules {
+		r.Register(v)
+	}
+	return r
+}
+
+// Register adds the rules of a version, replacing any already registered
+// for it.
+func (r *Registry) Register(rules VersionRules) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.versions[rules.Version] = rules
+}
+
+// Lookup returns the rules of a version.
+func (r *Registry) Lookup(version string) (VersionRules, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rules, ok := r.versions[version]
+	return rules, ok
+}
+
+// Rules returns the rules of the version of the header.
+func (r *Registry) Rules(h Header) (VersionRules, bool) {
+	return r.Lookup(h.version())
+}
+
+// Validate checks the pattern against the rules of its version.
+func (r *Registry) Validate(p Pattern) error {
+	rules, ok := r.Rules(p.Header)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnsupportedVersion, p.Header.version())
+	}
+	return rules.Check(p)
+}
+
+// DefaultRegistry holds the hardware versions found in the field, and the
+// empty version of patterns made in software, which only needs a tempo
+// above zero. Nothing checks patterns against it unless asked to: it must
+// be given to DecodeWith or DecodeFileWith, or set as the Registry of a
+// Decoder.
+var DefaultRegistry = NewRegistry(
+	VersionRules{
+		Version:    "",
+		MinTempo:   math.SmallestNonzeroFloat32,
+		MaxTempo:   math.MaxFloat32,
+		MaxTrackID: 255,
+	},
+	VersionRules{
+		Version: "0.708-alpha",
+
+		// The alpha firmware saves tempos up to 999, beyond those it can
+		// play, so files it wrote are read as they are.
+		MinTempo:   30,
+		MaxTempo:   999,
+		MaxTrackID: 15,
+		Instruments: []string{
+			"Kick", "Snare", "HiHat", "Clap",
+		},
+
+		// The alpha firmware leaves the end of its write buffer in the
+		// file.
+		Trailing: true,
+	},
+	VersionRules{
+		Version:    "0.808-alpha",
+		MinTempo:   30,
+		MaxTempo:   300,
+		MaxTrackID: 63,
+		Instruments: []string{
+			"kick", "snare", "clap", "hh-open", "hh-close", "cowbell",
+			"low-tom", "mid-tom", "hi-tom",
+		},
+	},
+	VersionRules{
+		Version:    "0.909",
+		MinTempo:   30,
+		MaxTempo:   300,
+		MaxTrackID: 255,
+		Instruments: []string{
+			"SubKick", "Kick", "Snare", "Clap", "Rimshot", "Maracas",
+			"Low Conga", "Mid Conga", "High Conga", "Open HiHat", "Closed HiHat",
+			"Crash", "Ride",
+		},
+	},
+)
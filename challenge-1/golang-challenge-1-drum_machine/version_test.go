@@ -0,0 +1,202 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestDefaultRegistry(t *testing.T) {
+	files := []string{
+		"pattern_1.splice",
+		"pattern_2.splice",
+		"pattern_3.splice",
+		"pattern_4.splice",
+		"pattern_5.splice",
+	}
+
+	for _, f := range files {
+		p, err := DecodeFile(path.Join("fixtures", f))
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", f, err)
+		}
+		rules, ok := DefaultRegistry.Rules(p.Header)
+		if !ok {
+			t.Fatalf("%s: no rules for version %q", f, p.Header.version())
+		}
+		for _, tr := range p.Tracks {
+			if !rules.KnownInstrument(tr.Name) {
+				t.Fatalf("%s: instrument %q is unknown to version %q", f, tr.Name, rules.Version)
+			}
+		}
+	}
+}
+
+func TestDecodeVersionRules(t *testing.T) {
+	original, err := ioutil.ReadFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The version starts at offset 14 and the tempo at offset 46.
+	withVersion := func(version string) []byte {
+		data := append([]byte(nil), original...)
+		copy(data[14:46], make([]byte, 32))
+		copy(data[14:46], version)
+		return data
+	}
+	withTempo := func(tempo float32) []byte {
+		data := append([]byte(nil), original...)
+		binary.LittleEndian.PutUint32(data[46:50], math.Float32bits(tempo))
+		return data
+	}
+
+	tData := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"unknown version", withVersion("0.303"), ErrUnsupportedVersion},
+		{"tempo too high", withTempo(999), ErrTempoRange},
+		{"no tempo", withTempo(0), ErrInvalidTempo},
+		{"trailing data", append(append([]byte(nil), original...), "junk"...), ErrVersionRules},
+		{"software tempo", withVersion(""), nil},
+	}
+
+	for _, exp := range tData {
+
+		// The rules are only checked when asked for.
+		p, err := Decode(bytes.NewReader(exp.data))
+		if err != nil {
+			t.Fatalf("%s: something went wrong decoding - %v", exp.name, err)
+		}
+		if err := DefaultRegistry.Validate(p); !errors.Is(err, exp.err) {
+			t.Fatalf("%s: expected error %v, got %v", exp.name, exp.err, err)
+		}
+		if _, err := DecodeWith(bytes.NewReader(exp.data), DefaultRegistry); !errors.Is(err, exp.err) {
+			t.Fatalf("%s: expected error %v decoding with a registry, got %v", exp.name, exp.err, err)
+		}
+
+		// A decoder with a registry checks each pattern of the stream,
+		// which has no trailing data.
+		dec := NewDecoder(bytes.NewReader(exp.data))
+		dec.Registry = DefaultRegistry
+		_, err = dec.Decode()
+		if p.Trailing != nil {
+			exp.err = nil
+		}
+		if exp.err == nil && err != nil {
+			t.Fatalf("%s: something went wrong decoding with a registry - %v", exp.name, err)
+		}
+		if !errors.Is(err, exp.err) {
+			t.Fatalf("%s: expected error %v, got %v", exp.name, exp.err, err)
+		}
+	}
+
+	// Registering the version makes it supported.
+	dec := NewDecoder(bytes.NewReader(withVersion("0.303")))
+	dec.Registry = NewRegistry(VersionRules{Version: "0.303", MinTempo: 60, MaxTempo: 180, MaxTrackID: 7})
+	if _, err := dec.Decode(); err != nil {
+		t.Fatalf("something went wrong decoding a registered version - %v", err)
+	}
+}
+
+func TestDecodeFileWith(t *testing.T) {
+	tData := []struct {
+		file string
+		err  error
+	}{
+
+		// The alpha firmware writes trailing data, the later versions
+		// don't.
+		{"pattern_5.splice", nil},
+		{path.Join("malformed", "unexpected_trailing.splice"), ErrVersionRules},
+		{path.Join("malformed", "unknown_version.splice"), ErrUnsupportedVersion},
+	}
+
+	for _, exp := range tData {
+		file := path.Join("fixtures", exp.file)
+		if _, err := DecodeFile(file); err != nil {
+			t.Fatalf("%s: something went wrong decoding without a registry - %v", exp.file, err)
+		}
+		p, err := DecodeFileWith(file, DefaultRegistry)
+		if !errors.Is(err, exp.err) {
+			t.Fatalf("%s: expected error %v, got %v", exp.file, exp.err, err)
+		}
+		if exp.err == nil && len(p.Trailing) == 0 {
+			t.Fatalf("%s: expected the trailing data to be kept", exp.file)
+		}
+	}
+}
+
+func TestDecodeEdited(t *testing.T) {
+	p, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Edits may break the rules of the version, the result is still read
+	// back.
+	edits := []Edit{
+		func(p *Pattern) error { return p.SetVersion("1.0") },
+		func(p *Pattern) error { return p.SetTempo(400) },
+		func(p *Pattern) error { return p.AddTrack(Track{ID: 100, Name: "laser"}) },
+	}
+	for i, edit := range edits {
+		if err := edit(&p); err != nil {
+			t.Fatalf("edit %d failed - %v", i, err)
+		}
+		var buf bytes.Buffer
+		if err := Encode(&buf, p); err != nil {
+			t.Fatalf("edit %d: something went wrong encoding - %v", i, err)
+		}
+		if _, err := Decode(&buf); err != nil {
+			t.Fatalf("edit %d: something went wrong decoding - %v", i, err)
+		}
+	}
+}
+
+func TestVersionRules(t *testing.T) {
+	rules, _ := DefaultRegistry.Lookup("0.808-alpha")
+	p := Pattern{Header: Header{Tempo: 120}, Tracks: []Track{{ID: 0, Name: "Kick"}}}
+
+	tData := []struct {
+		edit Edit
+		err  error
+		msg  string
+	}{
+		{func(p *Pattern) error { return nil }, nil, ""},
+		{func(p *Pattern) error { return p.SetTempo(400) }, ErrTempoRange, "400 is outside 30 to 300"},
+		{func(p *Pattern) error { return p.AddTrack(Track{ID: 64, Name: "snare"}) }, ErrVersionRules, "above 63"},
+		{func(p *Pattern) error { return p.RenameTrack(0, "laser") }, ErrVersionRules, `"laser"`},
+	}
+
+	for i, exp := range tData {
+		q := p.Clone()
+		if err := exp.edit(&q); err != nil {
+			t.Fatalf("edit %d failed - %v", i, err)
+		}
+		err := rules.Check(q)
+		if !errors.Is(err, exp.err) || err != nil && !strings.Contains(err.Error(), exp.msg) {
+			t.Fatalf("edit %d: expected %v with %q, got %v", i, exp.err, exp.msg, err)
+		}
+		if errors.Is(err, ErrTempoRange) && errors.Is(err, ErrInvalidTempo) {
+			t.Fatalf("edit %d: a tempo out of range isn't an invalid tempo - %v", i, err)
+		}
+	}
+}
+
+func TestKnownInstrument(t *testing.T) {
+	rules, _ := DefaultRegistry.Lookup("0.909")
+	if !rules.KnownInstrument("low conga") || rules.KnownInstrument("theremin") {
+		t.Fatalf("unexpected instruments for 0.909")
+	}
+	if !(VersionRules{}).KnownInstrument("theremin") {
+		t.Fatalf("expected any instrument to be known without a list")
+	}
+}
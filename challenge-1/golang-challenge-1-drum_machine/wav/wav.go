@@ -0,0 +1,248 @@
+// Package wav implements the reading and writing of PCM WAV files.
+package wav
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+)
+
+// formatPCM is the audio format of uncompressed PCM data.
+const formatPCM = 1
+
+// ErrNotWAV is returned when the data is not a RIFF WAVE file.
+var ErrNotWAV = errors.New("wav: not a WAV file")
+
+// ErrUnsupported is returned for WAV files which are not 8 or 16 bit PCM.
+var ErrUnsupported = errors.New("wav: only 8 and 16 bit PCM is supported")
+
+// riffHeader is the header at the start of every WAV file.
+// ref: http://soundfile.sapp.org/doc/WaveFormat/
+type riffHeader struct {
+	ChunkID   [4]byte
+	ChunkSize uint32
+	Format    [4]byte
+}
+
+// chunkHeader precedes each sub-chunk of the file.
+type chunkHeader struct {
+	ID   [4]byte
+	Size uint32
+}
+
+// fmtChunk describes the layout of the samples in the data chunk.
+type fmtChunk struct {
+	AudioFormat   uint16
+	NumChannels   uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+}
+
+// Audio is decoded PCM audio.
+type Audio struct {
+	SampleRate int
+	Channels   int
+
+	// Samples holds the interleaved samples of each channel scaled to the
+	// range [-1, 1].
+	Samples []float64
+}
+
+// Frames returns the number of samples in each channel.
+func (a Audio) Frames() int {
+	if a.Channels == 0 {
+		return 0
+	}
+	return len(a.Samples) / a.Channels
+}
+
+// Decode reads a PCM WAV file from r.
+func Decode(r io.Reader) (Audio, error) {
+	var riff riffHeader
+	if err := binary.Read(r, binary.LittleEndian, &riff); err != nil {
+		return Audio{}, ErrNotWAV
+	}
+	if string(riff.ChunkID[:]) != "RIFF" || string(riff.Format[:]) != "WAVE" {
+		return Audio{}, ErrNotWAV
+	}
+
+	var format *fmtChunk
+	for {
+		var chunk chunkHeader
+		if err := binary.Read(r, binary.LittleEndian, &chunk); err != nil {
+			return Audio{}, fmt.Errorf("wav: no data chunk found: %v", err)
+		}
+
+		// Chunks are padded to an even number of bytes.
+		size := int64(chunk.Size) + int64(chunk.Size%2)
+
+		switch string(chunk.ID[:]) {
+		case "fmt ":
+			format = &fmtChunk{}
+			if err := binary.Read(r, binary.LittleEndian, format); err != nil {
+				return Audio{}, fmt.Errorf("wav: reading fmt chunk failed: %v", err)
+			}
+			if _, err := io.CopyN(ioutil.Discard, r, size-int64(binary.Size(format))); err != nil {
+				return Audio{}, fmt.Errorf("wav: reading fmt chunk failed: %v", err)
+			}
+
+		case "data":
+			if format == nil {
+				return Audio{}, fmt.Errorf("wav: data chunk found before fmt chunk")
+			}
+			return decodeSamples(io.LimitReader(r, int64(chunk.Size)), *format)
+
+		default:
+			if _, err := io.CopyN(ioutil.Discard, r, size); err != nil {
+				return Audio{}, fmt.Errorf("wav: skipping %q chunk failed: %v", chunk.ID, err)
+			}
+		}
+	}
+}
+
+// DecodeFile reads the PCM WAV file found at the provided path.
+func DecodeFile(path string) (Audio, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return Audio{}, err
+	}
+	defer fd.Close()
+
+	a, err := Decode(bufio.NewReader(fd))
+	if err != nil {
+		return Audio{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return a, nil
+}
+
+// decodeSamples converts the content of the data chunk into samples.
+func decodeSamples(r io.Reader, format fmtChunk) (Audio, error) {
+	if format.AudioFormat != formatPCM || format.NumChannels == 0 {
+		return Audio{}, ErrUnsupported
+	}
+
+	a := Audio{
+		SampleRate: int(format.SampleRate),
+		Channels:   int(format.NumChannels),
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Audio{}, fmt.Errorf("wav: reading data chunk failed: %v", err)
+	}
+
+	switch format.BitsPerSample {
+	case 8:
+
+		// 8 bit samples are unsigned with silence at 128.
+		a.Samples = make([]float64, len(data))
+		for i, b := range data {
+			a.Samples[i] = float64(int(b)-128) / 128
+		}
+
+	case 16:
+		a.Samples = make([]float64, len(data)/2)
+		for i := range a.Samples {
+			s := int16(binary.LittleEndian.Uint16(data[2*i:]))
+			a.Samples[i] = float64(s) / 32768
+		}
+
+	default:
+		return Audio{}, ErrUnsupported
+	}
+
+	// Drop a partial frame at the end of the data.
+	a.Samples = a.Samples[:a.Frames()*a.Channels]
+
+	return a, nil
+}
+
+// Encode writes the audio to w as a 16 bit PCM WAV file. Samples outside
+// of the range [-1, 1] are clipped.
+func Encode(w io.Writer, a Audio) error {
+	if a.Channels <= 0 || a.SampleRate <= 0 {
+		return fmt.Errorf("wav: invalid format: %d channels at %d Hz", a.Channels, a.SampleRate)
+	}
+
+	const bitsPerSample = 16
+	blockAlign := a.Channels * bitsPerSample / 8
+	dataSize := a.Frames() * blockAlign
+
+	var header struct {
+		RIFF   riffHeader
+		FmtHdr chunkHeader
+		Fmt    fmtChunk
+		Data   chunkHeader
+	}
+	header.RIFF = riffHeader{
+		ChunkID:   [4]byte{'R', 'I', 'F', 'F'},
+		ChunkSize: uint32(36 + dataSize),
+		Format:    [4]byte{'W', 'A', 'V', 'E'},
+	}
+	header.FmtHdr = chunkHeader{
+		ID:   [4]byte{'f', 'm', 't', ' '},
+		Size: uint32(binary.Size(fmtChunk{})),
+	}
+	header.Fmt = fmtChunk{
+		AudioFormat:   formatPCM,
+		NumChannels:   uint16(a.Channels),
+		SampleRate:    uint32(a.SampleRate),
+		ByteRate:      uint32(a.SampleRate * blockAlign),
+		BlockAlign:    uint16(blockAlign),
+		BitsPerSample: bitsPerSample,
+	}
+	header.Data = chunkHeader{
+		ID:   [4]byte{'d', 'a', 't', 'a'},
+		Size: uint32(dataSize),
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := binary.Write(bw, binary.LittleEndian, header); err != nil {
+		return err
+	}
+
+	var b [2]byte
+	for _, s := range a.Samples[:a.Frames()*a.Channels] {
+		binary.LittleEndian.PutUint16(b[:], uint16(quantize(s)))
+		if _, err := bw.Write(b[:]); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// EncodeFile writes the audio as a 16 bit PCM WAV file to the provided
+// path, creating or truncating it as needed.
+func EncodeFile(path string, a Audio) error {
+	fd, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := Encode(fd, a); err != nil {
+		fd.Close()
+		return err
+	}
+
+	return fd.Close()
+}
+
+// quantize converts a sample in the range [-1, 1] to a 16 bit value.
+func quantize(s float64) int16 {
+	v := math.Round(s * 32768)
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
@@ -0,0 +1,74 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	a := Audio{
+		SampleRate: 22050,
+		Channels:   2,
+		Samples:    []float64{0, 0.5, -0.5, 1, -1, 0.25, 2, -2},
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, a); err != nil {
+		t.Fatalf("something went wrong encoding - %v", err)
+	}
+	if buf.Len() != 44+len(a.Samples)*2 {
+		t.Fatalf("expected %d bytes, got %d", 44+len(a.Samples)*2, buf.Len())
+	}
+
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	if got.SampleRate != a.SampleRate || got.Channels != a.Channels {
+		t.Fatalf("format changed: got %d Hz with %d channels", got.SampleRate, got.Channels)
+	}
+
+	// Values out of range are clipped and 1 can't be represented exactly.
+	expected := []float64{0, 0.5, -0.5, 32767.0 / 32768, -1, 0.25, 32767.0 / 32768, -1}
+	for i := range expected {
+		if got.Samples[i] != expected[i] {
+			t.Fatalf("sample %d: expected %v, got %v", i, expected[i], got.Samples[i])
+		}
+	}
+}
+
+func TestDecode8Bit(t *testing.T) {
+	var buf bytes.Buffer
+	data := []byte{128, 255, 0, 192}
+	header := []interface{}{
+		riffHeader{[4]byte{'R', 'I', 'F', 'F'}, uint32(4 + 8 + 16 + 8 + 8 + len(data)), [4]byte{'W', 'A', 'V', 'E'}},
+		chunkHeader{[4]byte{'L', 'I', 'S', 'T'}, 3},
+		[4]byte{},
+		chunkHeader{[4]byte{'f', 'm', 't', ' '}, 16},
+		fmtChunk{formatPCM, 1, 8000, 8000, 1, 8},
+		chunkHeader{[4]byte{'d', 'a', 't', 'a'}, uint32(len(data))},
+	}
+	for _, h := range header {
+		binary.Write(&buf, binary.LittleEndian, h)
+	}
+	buf.Write(data)
+
+	a, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	expected := []float64{0, 127.0 / 128, -1, 0.5}
+	if a.Frames() != len(expected) {
+		t.Fatalf("expected %d frames, got %d", len(expected), a.Frames())
+	}
+	for i := range expected {
+		if a.Samples[i] != expected[i] {
+			t.Fatalf("sample %d: expected %v, got %v", i, expected[i], a.Samples[i])
+		}
+	}
+
+	if _, err := Decode(bytes.NewReader([]byte("RIFX"))); err != ErrNotWAV {
+		t.Fatalf("expected %v, got %v", ErrNotWAV, err)
+	}
+}